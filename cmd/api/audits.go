@@ -0,0 +1,299 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+// maxAuditScans is the most barcodes a scanner can send in one batch.
+const maxAuditScans = 1000
+
+func (app *application) listAuditsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Branch uuid.UUID
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Branch = app.readUUID(qs, "branch", v)
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"created_at", "closed_at", "-created_at", "-closed_at"}
+
+	if input.Status != "" {
+		v.Check(validator.PermittedValue(input.Status, models.AuditStatuses...), "status", "invalid status value")
+	}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	audits, metadata, err := app.models.Audits.GetAll(input.Branch, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audits": audits, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createAuditHandler() opens a stocktake of a branch, or of a range of its shelves.
+func (app *application) createAuditHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		BranchID  uuid.UUID `json:"branch_id"`
+		ShelfFrom string    `json:"shelf_from"`
+		ShelfTo   string    `json:"shelf_to"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	audit := &models.Audit{
+		BranchID:  input.BranchID,
+		ShelfFrom: strings.TrimSpace(input.ShelfFrom),
+		ShelfTo:   strings.TrimSpace(input.ShelfTo),
+		OpenedBy:  &user.ID,
+	}
+
+	v := validator.New()
+	if models.ValidateAudit(v, audit); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Branches.Get(audit.BranchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("branch_id", "branch does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Audits.Insert(audit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/audits/%s", audit.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"audit": audit}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showAuditHandler(w http.ResponseWriter, r *http.Request) {
+	audit, err := app.readAudit(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit": audit}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createAuditScansHandler() receives a batch of barcodes from a scanner. Barcodes
+// which were already scanned during the audit are ignored, so a scanner which lost
+// its connection can send the whole batch again.
+func (app *application) createAuditScansHandler(w http.ResponseWriter, r *http.Request) {
+	audit, err := app.readAudit(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Barcodes []string `json:"barcodes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	barcodes := make([]string, 0, len(input.Barcodes))
+	for _, barcode := range input.Barcodes {
+		if barcode = strings.TrimSpace(barcode); barcode != "" {
+			barcodes = append(barcodes, barcode)
+		}
+	}
+
+	v := validator.New()
+	v.Check(len(barcodes) > 0, "barcodes", "must contain at least one barcode")
+	v.Check(len(barcodes) <= maxAuditScans, "barcodes", fmt.Sprintf("must not contain more than %d barcodes", maxAuditScans))
+	v.Check(audit.Status == models.AuditStatusOpen, "status", "audit is closed")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	added, err := app.models.Audits.AddScans(audit, barcodes)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrAuditClosed):
+			v.AddError("status", "audit is closed")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit": audit, "added": added}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showAuditReportHandler(w http.ResponseWriter, r *http.Request) {
+	audit, err := app.readAudit(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	report, err := app.models.Audits.Report(audit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit": audit, "report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) closeAuditHandler(w http.ResponseWriter, r *http.Request) {
+	audit, err := app.readAudit(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	if v.Check(audit.Status == models.AuditStatusOpen, "status", "audit is already closed"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Audits.Close(audit)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit": audit}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The markAuditLostHandler() marks the copies which were missing when an audit was
+// closed as lost. Staff can list the IDs of the copies to mark, e.g. after checking the
+// report for copies which are just misshelved; with no IDs every missing copy which
+// hasn't turned up since is marked.
+func (app *application) markAuditLostHandler(w http.ResponseWriter, r *http.Request) {
+	audit, err := app.readAudit(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		CopyIDs []uuid.UUID `json:"copy_ids"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(audit.Status == models.AuditStatusClosed, "status", "audit must be closed first"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	lost, err := app.models.Audits.MarkMissingLost(audit, input.CopyIDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"lost": lost}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readAudit() helper fetches the audit identified by the :id URL parameter.
+func (app *application) readAudit(r *http.Request) (*models.Audit, error) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		return nil, models.ErrRecordNotFound
+	}
+	return app.models.Audits.Get(id)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+)
+
+func (app *application) listAuthorsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortSafelist = []string{"name", "created_at", "-name", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	authors, metadata, err := app.models.Authors.GetAll(input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"authors": authors, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name           string   `json:"name"`
+		AlternateNames []string `json:"alternate_names"`
+		Bio            string   `json:"bio"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	author := &models.Author{
+		Name:           input.Name,
+		AlternateNames: input.AlternateNames,
+		Bio:            input.Bio,
+	}
+
+	v := validator.New()
+	if models.ValidateAuthor(v, author); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Authors.Insert(author)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/authors/%s", author.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"author": author}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	author, err := app.models.Authors.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"author": author}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	author, err := app.models.Authors.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name           *string  `json:"name"`
+		AlternateNames []string `json:"alternate_names"`
+		Bio            *string  `json:"bio"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		author.Name = *input.Name
+	}
+	if input.AlternateNames != nil {
+		author.AlternateNames = input.AlternateNames
+	}
+	if input.Bio != nil {
+		author.Bio = *input.Bio
+	}
+
+	v := validator.New()
+	if models.ValidateAuthor(v, author); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Authors.Update(author)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"author": author}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Authors.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrAuthorHasBooks):
+			v := validator.New()
+			v.AddError("author", "cannot be deleted while they are credited on any books")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "author successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAuthorBooksHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "year")
+	input.Filters.SortSafelist = []string{"title", "year", "average_rating", "-title", "-year", "-average_rating"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Authors.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	books, metadata, err := app.models.Books.GetAllForAuthor(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"books": books, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The resolveBookAuthors() helper validates the author credits sent for a book and
+// fills in the author names, adding a validation error for any author that doesn't
+// exist. Only unexpected database errors are returned.
+func (app *application) resolveBookAuthors(v *validator.Validator, credits []*models.BookAuthor) error {
+	if models.ValidateBookAuthors(v, credits); !v.Valid() {
+		return nil
+	}
+	for _, credit := range credits {
+		author, err := app.models.Authors.Get(credit.AuthorID)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				v.AddError("authors", fmt.Sprintf("author %s does not exist", credit.AuthorID))
+				continue
+			default:
+				return err
+			}
+		}
+		credit.Name = author.Name
+	}
+	return nil
+}
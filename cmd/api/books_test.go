@@ -186,3 +186,43 @@ func TestDeleteBook(t *testing.T) {
 	}
 
 }
+
+func TestListBooksFormat(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "CSV",
+			urlPath:         "/v1/books?format=csv",
+			wantCode:        http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody:        "id,title,author,year,pages,genres,isbn10,isbn13,edition,format",
+		},
+		{
+			name:            "Unknown format",
+			urlPath:         "/v1/books?format=xml",
+			wantCode:        http.StatusUnprocessableEntity,
+			wantContentType: "application/json",
+			wantBody:        "must be json or csv",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Content-Type"), tt.wantContentType)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+)
+
+func (app *application) listBranchesHandler(w http.ResponseWriter, r *http.Request) {
+	branches, err := app.models.Branches.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"branches": branches}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createBranchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name         string              `json:"name"`
+		Address      string              `json:"address"`
+		OpeningHours models.OpeningHours `json:"opening_hours"`
+		Timezone     string              `json:"timezone"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	branch := &models.Branch{
+		Name:         input.Name,
+		Address:      input.Address,
+		OpeningHours: input.OpeningHours,
+		Timezone:     "UTC",
+	}
+	if branch.OpeningHours == nil {
+		branch.OpeningHours = models.OpeningHours{}
+	}
+	if input.Timezone != "" {
+		branch.Timezone = input.Timezone
+	}
+
+	v := validator.New()
+	if models.ValidateBranch(v, branch); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Branches.Insert(branch)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateBranch):
+			v.AddError("name", "a branch with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/branches/%s", branch.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"branch": branch}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showBranchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	branch, err := app.models.Branches.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"branch": branch}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateBranchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	branch, err := app.models.Branches.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name         *string             `json:"name"`
+		Address      *string             `json:"address"`
+		OpeningHours models.OpeningHours `json:"opening_hours"`
+		Timezone     *string             `json:"timezone"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		branch.Name = *input.Name
+	}
+	if input.Address != nil {
+		branch.Address = *input.Address
+	}
+	// The opening hours are always replaced as a whole, so sending an empty object
+	// marks the branch as closed.
+	if input.OpeningHours != nil {
+		branch.OpeningHours = input.OpeningHours
+	}
+	if input.Timezone != nil {
+		branch.Timezone = *input.Timezone
+	}
+
+	v := validator.New()
+	if models.ValidateBranch(v, branch); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Branches.Update(branch)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, models.ErrDuplicateBranch):
+			v.AddError("name", "a branch with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"branch": branch}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteBranchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Branches.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrBranchHasCopies):
+			v := validator.New()
+			v.AddError("branch", "cannot be deleted while any copies belong to it or are located at it")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrBranchHasTransfers):
+			v := validator.New()
+			v.AddError("branch", "cannot be deleted while any transfers have been made from or to it")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrBranchHasOrders):
+			v := validator.New()
+			v.AddError("branch", "cannot be deleted while any purchase orders have been placed for it")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "branch successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
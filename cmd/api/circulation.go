@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+// The circulationPolicy() helper resolves the circulation policy which applies when a
+// patron of the given type borrows the given copy: whether it may leave the library,
+// how long for and how many times it may be renewed.
+func (app *application) circulationPolicy(patronType *models.PatronType, bookCopy *models.BookCopy) (*models.ResolvedPolicy, error) {
+	policies, err := app.models.Policies.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return models.ResolvePolicy(policies, patronType, bookCopy.ItemType), nil
+}
+
+// The borrowingLimits() helper looks up the patron type of a user, and adds a
+// validation error under key if they owe more in fines than the type allows. Patrons
+// over the fine cap can't borrow, renew or place holds. The patron type is returned so
+// that callers can check its other limits.
+func (app *application) borrowingLimits(v *validator.Validator, key string, user *models.User) (*models.PatronType, error) {
+	patronType, err := app.models.PatronTypes.Get(user.PatronType)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := app.models.Fines.Balance(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	v.Check(balance <= patronType.FineCap, key, fmt.Sprintf("patron owes %d in fines, more than the limit of %d for %s patrons", balance, patronType.FineCap, patronType.Name))
+
+	return patronType, nil
+}
+
+// The allocateHolds() helper sets copies of a book which are back on the shelf aside
+// for the patrons waiting in its hold queue, until either the queue or the shelf is
+// empty. Failures are logged rather than sent to the client, because the request which
+// freed the copy has already succeeded by the time this runs.
+func (app *application) allocateHolds(bookID uuid.UUID) {
+	for {
+		expiresAt := models.DueDate(time.Now(), app.config.circulation.holdPickupPeriod)
+		hold, err := app.models.Holds.Allocate(bookID, expiresAt)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"book_id": bookID.String()})
+			return
+		}
+		if hold == nil {
+			return
+		}
+		message := "hold ready for pickup"
+		if hold.Status == models.HoldStatusInTransit {
+			message = "copy requested for transfer to hold pickup branch"
+		}
+		app.logger.PrintInfo(message, map[string]string{
+			"hold_id": hold.ID.String(),
+			"book_id": bookID.String(),
+		})
+	}
+}
+
+// The expireHolds() job expires holds which were not picked up in time and passes the
+// released copies on to the next patrons in the queue.
+func (app *application) expireHolds() error {
+	bookIDs, err := app.models.Holds.ExpireReady(time.Now())
+	if err != nil {
+		return err
+	}
+	for _, bookID := range bookIDs {
+		app.allocateHolds(bookID)
+	}
+	return nil
+}
+
+// The accrueFines() job brings the fines for loans which are still overdue up to date,
+// so that patrons see what they owe without having to return the book first.
+func (app *application) accrueFines() error {
+	charged, err := app.models.Fines.AccrueOverdue(time.Now())
+	if err != nil {
+		return err
+	}
+	app.logger.PrintInfo("fines accrued", map[string]string{"charges": strconv.Itoa(charged)})
+	return nil
+}
+
+// The sendReminders() job emails borrowers whose loans are due within the configured
+// number of days, and those whose loans are overdue. Each reminder is claimed in the
+// database before it is sent, so a reminder is never sent twice; one which fails to
+// send is released again and retried on the next run.
+func (app *application) sendReminders() error {
+	dueSoon := time.Duration(app.config.circulation.reminderDays) * 24 * time.Hour
+	reminders, err := app.models.Reminders.GetPending(time.Now(), dueSoon)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, reminder := range reminders {
+		claimed, err := app.models.Reminders.Claim(reminder)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		data := map[string]any{
+			"firstName": reminder.FirstName,
+			"title":     reminder.Title,
+			"dueDate":   reminder.DueAt.Format("Monday 2 January 2006"),
+		}
+		err = app.mailer.Send(reminder.Email, "loan_"+reminder.Kind+".tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"loan_id": reminder.LoanID.String(), "kind": reminder.Kind})
+			err = app.models.Reminders.Release(reminder)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		sent++
+	}
+
+	app.logger.PrintInfo("reminders sent", map[string]string{"reminders": strconv.Itoa(sent)})
+	return nil
+}
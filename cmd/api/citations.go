@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Danik14/library/internal/cite"
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+// maxCitations limits how many books can be cited in a single request.
+const maxCitations = 100
+
+// The showBookCitationHandler() returns a citation for a book in the format given by
+// ?format=, which is one of bibtex (the default), ris, csl-json, apa or mla.
+func (app *application) showBookCitationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	format := app.readCitationFormat(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	item, err := app.citationItem(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeCitations(w, r, format, []*cite.Item{item})
+}
+
+// The listCitationsHandler() returns citations for several books at once, given as a
+// comma-separated list of IDs in ?ids=, in the order they are listed. This is how a
+// reading list is exported to a reference manager.
+func (app *application) listCitationsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	format := app.readCitationFormat(r, v)
+
+	ids := []uuid.UUID{}
+	for _, s := range app.readCSV(r.URL.Query(), "ids", []string{}) {
+		id, err := uuid.FromString(s)
+		if err != nil {
+			v.AddError("ids", "must contain valid UUIDs")
+			break
+		}
+		ids = append(ids, id)
+	}
+	v.Check(len(ids) > 0, "ids", "must be provided")
+	v.Check(len(ids) <= maxCitations, "ids", fmt.Sprintf("must not contain more than %d books", maxCitations))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	items := []*cite.Item{}
+	for _, id := range ids {
+		item, err := app.citationItem(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				v.AddError("ids", fmt.Sprintf("book %s does not exist", id))
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		items = append(items, item)
+	}
+
+	app.writeCitations(w, r, format, items)
+}
+
+// The readCitationFormat() helper reads and checks the ?format= query parameter.
+func (app *application) readCitationFormat(r *http.Request, v *validator.Validator) string {
+	format := app.readString(r.URL.Query(), "format", cite.FormatBibTeX)
+	v.Check(validator.PermittedValue(format, cite.Formats...), "format", "must be one of bibtex, ris, csl-json, apa or mla")
+	return format
+}
+
+// The citationItem() helper fetches a book along with the people credited on it, whose
+// roles decide who is cited as an author, editor or translator.
+func (app *application) citationItem(id uuid.UUID) (*cite.Item, error) {
+	book, err := app.models.Books.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	book.Authors, err = app.models.Authors.GetAllForBook(book.ID)
+	if err != nil {
+		return nil, err
+	}
+	return cite.FromBook(book), nil
+}
+
+// The writeCitations() helper sends citations with the media type of their format
+// rather than as a JSON envelope, so that reference managers can open them directly.
+func (app *application) writeCitations(w http.ResponseWriter, r *http.Request, format string, items []*cite.Item) {
+	var buf bytes.Buffer
+	err := cite.Write(&buf, format, items)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", cite.ContentType(format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+func (app *application) listBookCopiesHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Make sure the book itself exists, so that we send a 404 rather than an empty
+	// list for an unknown book ID.
+	_, err = app.models.Books.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	copies, err := app.models.Copies.GetAllForBook(bookID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"copies": copies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createBookCopyHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Books.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Barcode         string    `json:"barcode"`
+		AccessionNumber string    `json:"accession_number"`
+		ItemType        string    `json:"item_type"`
+		ShelfMark       string    `json:"shelf_mark"`
+		HomeBranchID    uuid.UUID `json:"home_branch_id"`
+		CurrentBranchID uuid.UUID `json:"current_branch_id"`
+		Condition       string    `json:"condition"`
+		Status          string    `json:"status"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// New copies default to being ordinary books in good condition and available on
+	// the shelf at their home branch, unless the client tells us otherwise.
+	bookCopy := &models.BookCopy{
+		BookID:          bookID,
+		Barcode:         input.Barcode,
+		AccessionNumber: input.AccessionNumber,
+		ItemType:        models.DefaultItemType,
+		ShelfMark:       strings.TrimSpace(input.ShelfMark),
+		HomeBranchID:    input.HomeBranchID,
+		CurrentBranchID: input.HomeBranchID,
+		Condition:       "good",
+		Status:          models.CopyStatusAvailable,
+	}
+	if input.ItemType != "" {
+		bookCopy.ItemType = input.ItemType
+	}
+	if input.CurrentBranchID != uuid.Nil {
+		bookCopy.CurrentBranchID = input.CurrentBranchID
+	}
+	if input.Condition != "" {
+		bookCopy.Condition = input.Condition
+	}
+	if input.Status != "" {
+		bookCopy.Status = input.Status
+	}
+
+	v := validator.New()
+	// Copies only go on loan, on hold or in transit through the circulation workflows.
+	v.Check(!validator.PermittedValue(bookCopy.Status, models.CopyCirculationStatuses...), "status", "is managed by the circulation workflow")
+	err = app.checkCopyBranches(v, bookCopy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if models.ValidateBookCopy(v, bookCopy); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Copies.Insert(bookCopy)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateBarcode):
+			v.AddError("barcode", "a copy with this barcode already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrDuplicateAccessionNumber):
+			v.AddError("accession_number", "a copy with this accession number already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// A new copy on the shelf may be able to satisfy a waiting hold straight away.
+	if bookCopy.Status == models.CopyStatusAvailable {
+		app.allocateHolds(bookID)
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/books/%s/copies/%s", bookID, bookCopy.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"copy": bookCopy}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readBookCopy() helper fetches the copy identified by the :copy_id URL parameter,
+// making sure that it belongs to the book identified by :id. Copies of a different
+// book are treated as not found.
+func (app *application) readBookCopy(r *http.Request) (*models.BookCopy, error) {
+	bookID, err := app.readUUIDParam(r)
+	if err != nil {
+		return nil, models.ErrRecordNotFound
+	}
+	copyID, err := app.readNamedUUIDParam(r, "copy_id")
+	if err != nil {
+		return nil, models.ErrRecordNotFound
+	}
+	bookCopy, err := app.models.Copies.Get(copyID)
+	if err != nil {
+		return nil, err
+	}
+	if bookCopy.BookID != bookID {
+		return nil, models.ErrRecordNotFound
+	}
+	return bookCopy, nil
+}
+
+func (app *application) showBookCopyHandler(w http.ResponseWriter, r *http.Request) {
+	bookCopy, err := app.readBookCopy(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"copy": bookCopy}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateBookCopyHandler(w http.ResponseWriter, r *http.Request) {
+	bookCopy, err := app.readBookCopy(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Barcode         *string    `json:"barcode"`
+		AccessionNumber *string    `json:"accession_number"`
+		ItemType        *string    `json:"item_type"`
+		ShelfMark       *string    `json:"shelf_mark"`
+		HomeBranchID    *uuid.UUID `json:"home_branch_id"`
+		CurrentBranchID *uuid.UUID `json:"current_branch_id"`
+		Condition       *string    `json:"condition"`
+		Status          *string    `json:"status"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Barcode != nil {
+		bookCopy.Barcode = *input.Barcode
+	}
+	if input.AccessionNumber != nil {
+		bookCopy.AccessionNumber = *input.AccessionNumber
+	}
+	if input.ItemType != nil {
+		bookCopy.ItemType = *input.ItemType
+	}
+	if input.ShelfMark != nil {
+		bookCopy.ShelfMark = strings.TrimSpace(*input.ShelfMark)
+	}
+	if input.HomeBranchID != nil {
+		bookCopy.HomeBranchID = *input.HomeBranchID
+	}
+	if input.CurrentBranchID != nil {
+		bookCopy.CurrentBranchID = *input.CurrentBranchID
+	}
+	if input.Condition != nil {
+		bookCopy.Condition = *input.Condition
+	}
+	v := validator.New()
+	if input.Status != nil {
+		// Moving a copy on or off loan (or the hold shelf) has to go through the
+		// circulation workflows, so that the loan and hold records never disagree with
+		// the copy status.
+		if *input.Status != bookCopy.Status {
+			v.Check(!validator.PermittedValue(*input.Status, models.CopyCirculationStatuses...), "status", "is managed by the circulation workflow")
+			v.Check(!validator.PermittedValue(bookCopy.Status, models.CopyCirculationStatuses...), "status", "is managed by the circulation workflow")
+		}
+		bookCopy.Status = *input.Status
+	}
+
+	err = app.checkCopyBranches(v, bookCopy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if models.ValidateBookCopy(v, bookCopy); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Copies.Update(bookCopy)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, models.ErrDuplicateBarcode):
+			v.AddError("barcode", "a copy with this barcode already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrDuplicateAccessionNumber):
+			v.AddError("accession_number", "a copy with this accession number already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if bookCopy.Status == models.CopyStatusAvailable {
+		app.allocateHolds(bookCopy.BookID)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"copy": bookCopy}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteBookCopyHandler(w http.ResponseWriter, r *http.Request) {
+	bookCopy, err := app.readBookCopy(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	if v.Check(!validator.PermittedValue(bookCopy.Status, models.CopyCirculationStatuses...), "status", "a copy cannot be deleted while it is on loan, on hold or in transit"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Copies.Delete(bookCopy.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "copy successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The checkCopyBranches() helper adds a validation error for each branch of a copy
+// that doesn't exist. Only unexpected database errors are returned.
+func (app *application) checkCopyBranches(v *validator.Validator, bookCopy *models.BookCopy) error {
+	branches := map[string]uuid.UUID{
+		"home_branch_id":    bookCopy.HomeBranchID,
+		"current_branch_id": bookCopy.CurrentBranchID,
+	}
+	for key, id := range branches {
+		if id == uuid.Nil {
+			continue
+		}
+		_, err := app.models.Branches.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				v.AddError(key, "branch does not exist")
+			default:
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+func (app *application) listDigitalResourcesHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Books.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	resources, err := app.models.DigitalResources.GetAllForBooks([]uuid.UUID{bookID})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Send an empty list rather than null for books without digital resources.
+	list := resources[bookID]
+	if list == nil {
+		list = []*models.DigitalResource{}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"digital_resources": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createDigitalResourceHandler() adds a file or web page through which a book can
+// be read, which the OPDS catalog then offers as an acquisition link.
+func (app *application) createDigitalResourceHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Books.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		URL       string `json:"url"`
+		MediaType string `json:"media_type"`
+		SizeBytes int64  `json:"size_bytes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	resource := &models.DigitalResource{
+		BookID:    bookID,
+		URL:       input.URL,
+		MediaType: input.MediaType,
+		SizeBytes: input.SizeBytes,
+	}
+
+	v := validator.New()
+	if models.ValidateDigitalResource(v, resource); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.DigitalResources.Insert(resource)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateResourceURL):
+			v.AddError("url", "this book already has a digital resource with this URL")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/books/%s/digital-resources/%s", bookID, resource.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"digital_resource": resource}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteDigitalResourceHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	resourceID, err := app.readNamedUUIDParam(r, "resource_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Only delete the resource if it belongs to the book in the URL.
+	resource, err := app.models.DigitalResources.Get(resourceID)
+	if err == nil && resource.BookID != bookID {
+		err = models.ErrRecordNotFound
+	}
+	if err == nil {
+		err = app.models.DigitalResources.Delete(resourceID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "digital resource successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
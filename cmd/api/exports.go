@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/marc"
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+// The exportBooksHandler() streams the catalog as MARC records, either in the ISO 2709
+// exchange format (?format=marc, the default) or as MARCXML (?format=marcxml). The
+// title, author, genres, branch and sort parameters filter and order the books in the
+// same way as for listBooksHandler(), but every matching book is exported rather than
+// a single page.
+func (app *application) exportBooksHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	format := app.readString(qs, "format", "marc")
+	title := app.readString(qs, "title", "")
+	author := app.readString(qs, "author", "")
+	genres := app.readCSV(qs, "genres", []string{})
+	for i, genre := range genres {
+		genres[i] = models.NormalizeGenre(genre)
+	}
+	branch := app.readUUID(qs, "branch", v)
+
+	// The export isn't paginated, but the filters still check the sort parameter.
+	filters := data.Filters{
+		Page:         1,
+		PageSize:     1,
+		Sort:         app.readString(qs, "sort", "id"),
+		SortSafelist: []string{"id", "title", "author", "year", "average_rating", "ratings_count", "-id", "-title", "-author", "-year", "-average_rating", "-ratings_count"},
+	}
+
+	v.Check(validator.PermittedValue(format, "marc", "marcxml"), "format", "must be marc or marcxml")
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Nothing is written until the first book has been read, so that a failing query
+	// can still be reported with a proper error response.
+	var write func(*marc.Record) error
+	var finish func() error
+	switch format {
+	case "marcxml":
+		xw := marc.NewXMLWriter(w)
+		write, finish = xw.Write, xw.Close
+		w.Header().Set("Content-Type", "application/marcxml+xml")
+		w.Header().Set("Content-Disposition", `attachment; filename="books.xml"`)
+	default:
+		mw := marc.NewWriter(w)
+		write, finish = mw.Write, func() error { return nil }
+		w.Header().Set("Content-Type", "application/marc")
+		w.Header().Set("Content-Disposition", `attachment; filename="books.mrc"`)
+	}
+
+	started := false
+	err := app.models.Books.Each(title, author, genres, branch, filters, func(book *models.Book) error {
+		started = true
+		return write(marc.FromBook(book))
+	})
+	if err == nil {
+		err = finish()
+	}
+	if err != nil {
+		// Once the response has started it can't be turned into an error response, so
+		// the client is left with a truncated file and the error is only logged.
+		if !started {
+			w.Header().Del("Content-Disposition")
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.logError(r, err)
+	}
+}
+
+// bookCSVHeader lists the columns of a CSV export. The columns after id are the ones
+// importBooksCSVHandler() reads, so an exported file can be edited and imported again.
+var bookCSVHeader = []string{"id", "title", "author", "year", "pages", "genres", "isbn10", "isbn13", "edition", "format", "publisher", "average_rating", "ratings_count"}
+
+// bookCSVRecord returns the cells of a book's row in a CSV export.
+func bookCSVRecord(book *models.Book) []string {
+	record := []string{
+		book.ID.String(),
+		book.Title,
+		book.Author,
+		strconv.Itoa(int(book.Year)),
+		strconv.Itoa(int(book.Pages)),
+		strings.Join(book.Genres, "; "),
+		book.ISBN10,
+		book.ISBN13,
+		book.Edition,
+		book.Format,
+		book.Publisher,
+		strconv.FormatFloat(book.AverageRating, 'f', -1, 64),
+		strconv.Itoa(book.RatingsCount),
+	}
+	for i, cell := range record {
+		record[i] = escapeCSVCell(cell)
+	}
+	return record
+}
+
+// csvFormulaPrefixes are the characters which make spreadsheet programs treat a cell
+// as a formula.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// escapeCSVCell prefixes a cell which would be treated as a formula with a single
+// quote, so that a book title such as "=HYPERLINK(...)" is shown as text when an
+// export is opened in a spreadsheet.
+func escapeCSVCell(cell string) string {
+	if cell != "" && strings.ContainsRune(csvFormulaPrefixes, rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// unescapeCSVCell removes the quote added by escapeCSVCell(), so that an exported file
+// can be imported again unchanged.
+func unescapeCSVCell(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+// The writeBooksCSV() helper streams every book matching the filters as a CSV file,
+// for listBooksHandler().
+func (app *application) writeBooksCSV(w http.ResponseWriter, r *http.Request, title string, author string, genres []string, branch uuid.UUID, filters data.Filters) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="books.csv"`)
+
+	cw := csv.NewWriter(w)
+
+	started := false
+	err := app.models.Books.Each(title, author, genres, branch, filters, func(book *models.Book) error {
+		if !started {
+			started = true
+			cw.Write(bookCSVHeader)
+		}
+		cw.Write(bookCSVRecord(book))
+		return cw.Error()
+	})
+	if err == nil && !started {
+		cw.Write(bookCSVHeader)
+	}
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		if !started {
+			w.Header().Del("Content-Disposition")
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// The listUserFinesHandler() returns every entry in a user's fines ledger along with
+// the balance they currently owe.
+func (app *application) listUserFinesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Users.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	fines, err := app.models.Fines.GetAllForUser(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	balance, err := app.models.Fines.Balance(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"fines": fines, "balance": balance}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createFinePaymentHandler() records a payment made by a patron. A payment can't
+// be more than the patron currently owes.
+func (app *application) createFinePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Amount int64  `json:"amount"`
+		Note   string `json:"note"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	_, err = app.models.Users.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	balance, err := app.models.Fines.Balance(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Amount > 0, "amount", "must be greater than zero")
+	v.Check(input.Amount <= balance, "amount", "must not be more than the outstanding balance")
+	v.Check(len(input.Note) <= 500, "note", "must not be more than 500 bytes long")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Record the member of staff who took the payment.
+	staffID := app.contextGetUser(r).ID
+	fine := &models.Fine{
+		UserID:    userID,
+		Kind:      models.FineKindPayment,
+		Amount:    input.Amount,
+		Note:      input.Note,
+		CreatedBy: &staffID,
+	}
+
+	err = app.models.Fines.Insert(fine)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"fine": fine, "balance": balance - fine.Amount}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The waiveFineHandler() waives all or part of an outstanding overdue charge. If no
+// amount is given, whatever is left of the charge is waived.
+func (app *application) waiveFineHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	charge, err := app.models.Fines.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Amount *int64 `json:"amount"`
+		Note   string `json:"note"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	amount := charge.Waivable()
+	if input.Amount != nil {
+		amount = *input.Amount
+	}
+
+	// A patron's payments aren't made against particular charges, so a charge counts
+	// as paid once the balance no longer covers it. Waiving it then would leave the
+	// patron in credit.
+	balance, err := app.models.Fines.Balance(charge.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(charge.Kind == models.FineKindCharge, "fine", "only charges can be waived")
+	v.Check(charge.Kind != models.FineKindCharge || charge.Status == models.FineStatusOutstanding, "fine", fmt.Sprintf("charge is already %s", charge.Status))
+	v.Check(amount > 0, "amount", "must be greater than zero")
+	v.Check(amount <= charge.Waivable(), "amount", "must not be more than what is left of the charge")
+	v.Check(amount <= balance, "amount", "must not be more than the patron owes")
+	v.Check(input.Note != "", "note", "must be provided")
+	v.Check(len(input.Note) <= 500, "note", "must not be more than 500 bytes long")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	staffID := app.contextGetUser(r).ID
+	waiver := &models.Fine{
+		UserID:    charge.UserID,
+		LoanID:    charge.LoanID,
+		Kind:      models.FineKindWaiver,
+		Amount:    amount,
+		Note:      input.Note,
+		CreatedBy: &staffID,
+	}
+
+	err = app.models.Fines.Waive(charge, waiver)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"fine": waiver, "charge": charge}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listFineRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules, err := app.models.Fines.GetAllRules()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"fine_rules": rules}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The saveFineRuleHandler() creates or replaces the fine rule for the item type in
+// the URL. Use the item type "default" to change the rule for every other item type.
+func (app *application) saveFineRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		DailyRate int64 `json:"daily_rate"`
+		GraceDays int   `json:"grace_days"`
+		MaxAmount int64 `json:"max_amount"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	rule := &models.FineRule{
+		ItemType:  httprouter.ParamsFromContext(r.Context()).ByName("item_type"),
+		DailyRate: input.DailyRate,
+		GraceDays: input.GraceDays,
+		MaxAmount: input.MaxAmount,
+	}
+
+	v := validator.New()
+	if models.ValidateFineRule(v, rule); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Fines.SaveRule(rule)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"fine_rule": rule}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+func (app *application) listFundsHandler(w http.ResponseWriter, r *http.Request) {
+	funds, err := app.models.Funds.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"funds": funds}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createFundHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code     string `json:"code"`
+		Name     string `json:"name"`
+		Currency string `json:"currency"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	fund := &models.Fund{
+		Code:     strings.TrimSpace(input.Code),
+		Name:     strings.TrimSpace(input.Name),
+		Currency: strings.ToUpper(strings.TrimSpace(input.Currency)),
+	}
+
+	v := validator.New()
+	if models.ValidateFund(v, fund); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Funds.Insert(fund)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateFundCode):
+			v.AddError("code", "a fund with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/funds/%s", fund.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"fund": fund}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showFundHandler() sends a fund along with its balance for a fiscal year, which
+// defaults to the current one.
+func (app *application) showFundHandler(w http.ResponseWriter, r *http.Request) {
+	fund, err := app.readFund(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	fiscalYear := app.readFiscalYear(r.URL.Query(), app.currentFiscalYear(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	balances, err := app.models.Funds.Balances(fiscalYear, fund.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"fund": fund}
+	if len(balances) > 0 {
+		env["balance"] = balances[0]
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateFundHandler(w http.ResponseWriter, r *http.Request) {
+	fund, err := app.readFund(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Code     *string `json:"code"`
+		Name     *string `json:"name"`
+		Currency *string `json:"currency"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Code != nil {
+		fund.Code = strings.TrimSpace(*input.Code)
+	}
+	if input.Name != nil {
+		fund.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Currency != nil {
+		fund.Currency = strings.ToUpper(strings.TrimSpace(*input.Currency))
+	}
+
+	v := validator.New()
+	if models.ValidateFund(v, fund); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Funds.Update(fund)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, models.ErrDuplicateFundCode):
+			v.AddError("code", "a fund with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrFundCurrencyLocked):
+			v.AddError("currency", "cannot be changed once money has been allocated to the fund")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"fund": fund}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The listFundAllocationsHandler() sends the allocations to a fund, for every fiscal
+// year unless one is asked for.
+func (app *application) listFundAllocationsHandler(w http.ResponseWriter, r *http.Request) {
+	fund, err := app.readFund(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	fiscalYear := app.readFiscalYear(r.URL.Query(), 0, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	allocations, err := app.models.Funds.GetAllocations(fund.ID, fiscalYear)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"fund": fund, "allocations": allocations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createFundAllocationHandler() allocates money to a fund for a fiscal year, which
+// defaults to the current one. A negative amount takes money back.
+func (app *application) createFundAllocationHandler(w http.ResponseWriter, r *http.Request) {
+	fund, err := app.readFund(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		FiscalYear int    `json:"fiscal_year"`
+		Amount     int64  `json:"amount"`
+		Note       string `json:"note"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	allocation := &models.FundAllocation{
+		FundID:     fund.ID,
+		FiscalYear: input.FiscalYear,
+		Amount:     input.Amount,
+		Note:       strings.TrimSpace(input.Note),
+		CreatedBy:  &user.ID,
+	}
+	if allocation.FiscalYear == 0 {
+		allocation.FiscalYear = app.currentFiscalYear()
+	}
+
+	v := validator.New()
+	if models.ValidateFundAllocation(v, allocation); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Funds.InsertAllocation(allocation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"allocation": allocation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The listFundTransactionsHandler() sends the ledger of a fund, for every fiscal year
+// unless one is asked for.
+func (app *application) listFundTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	fund, err := app.readFund(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	fiscalYear := app.readFiscalYear(r.URL.Query(), 0, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	transactions, err := app.models.Funds.GetTransactions(fund.ID, fiscalYear)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"fund": fund, "transactions": transactions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showFundReportHandler() sends the balance of every fund for a fiscal year, which
+// defaults to the current one. Funds can be in different currencies, so no grand total
+// is given.
+func (app *application) showFundReportHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	fiscalYear := app.readFiscalYear(r.URL.Query(), app.currentFiscalYear(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	balances, err := app.models.Funds.Balances(fiscalYear, uuid.Nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"fiscal_year": fiscalYear, "funds": balances}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The currentFiscalYear() helper returns the fiscal year that orders placed now are paid
+// from.
+func (app *application) currentFiscalYear() int {
+	return models.FiscalYear(time.Now(), time.Month(app.config.acquisitions.fiscalYearStart))
+}
+
+// The readFiscalYear() helper reads the fiscal_year query string parameter, returning
+// defaultValue if it isn't there.
+func (app *application) readFiscalYear(qs url.Values, defaultValue int, v *validator.Validator) int {
+	fiscalYear := app.readInt(qs, "fiscal_year", defaultValue, v)
+	if qs.Get("fiscal_year") != "" {
+		v.Check(fiscalYear >= 1900 && fiscalYear <= 9999, "fiscal_year", "must be a valid year")
+	}
+	return fiscalYear
+}
+
+// The readFund() helper fetches the fund identified by the :id URL parameter.
+func (app *application) readFund(r *http.Request) (*models.Fund, error) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		return nil, models.ErrRecordNotFound
+	}
+	return app.models.Funds.Get(id)
+}
@@ -4,11 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Danik14/library/internal/data"
 	"github.com/Danik14/library/internal/models"
 	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
 )
 
 // func (app *application) listAllBooks(w http.ResponseWriter, r *http.Request) {
@@ -47,6 +49,18 @@ func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request
 		Year   int32        `json:"year"`
 		Pages  models.Pages `json:"pages"`
 		Genres []string     `json:"genres"`
+		ISBN10 string       `json:"isbn10"`
+		ISBN13 string       `json:"isbn13"`
+		// WorkID adds the book as a new edition of an existing work. If it is left
+		// out, a new work is created for the book.
+		WorkID      uuid.UUID         `json:"work_id"`
+		PublisherID *uuid.UUID        `json:"publisher_id"`
+		Edition     string            `json:"edition"`
+		PublishedOn *models.CivilTime `json:"published_on"`
+		Format      string            `json:"format"`
+		// Authors optionally credits existing author records on the book. Without it,
+		// the names in Author are credited, and added as authors if they are new.
+		Authors []*models.BookAuthor `json:"authors"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -62,11 +76,43 @@ func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request
 		Year:   input.Year,
 		Genres: input.Genres,
 		Pages:  input.Pages,
+		ISBN10: input.ISBN10,
+		ISBN13: input.ISBN13,
+
+		WorkID:      input.WorkID,
+		PublisherID: input.PublisherID,
+		Edition:     input.Edition,
+		PublishedOn: input.PublishedOn,
+		Format:      input.Format,
 	}
 
 	v := validator.New()
 
-	if models.ValidateBook(v, book); !v.Valid() {
+	err = app.checkBookReferences(v, book)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(input.Authors) > 0 {
+		err = app.resolveBookAuthors(v, input.Authors)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		// The display form of the authors can be left for us to work out.
+		if book.Author == "" {
+			book.Author = models.AuthorStatement(input.Authors)
+		}
+		book.Authors = input.Authors
+	}
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if models.ValidateBook(v, book, taxonomy); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -76,7 +122,13 @@ func (app *application) createBookHandler(w http.ResponseWriter, r *http.Request
 	// book struct with the system-generated information.
 	err = app.models.Books.Insert(book)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, models.ErrDuplicateISBN):
+			v.AddError("isbn", "a book with this ISBN already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -220,11 +272,65 @@ func (app *application) showBookHandler(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
+	book.Authors, err = app.models.Authors.GetAllForBook(book.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	book.Availability, err = app.models.Branches.AvailabilityForBook(book.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	book.Editions, err = app.siblingEditions(book)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Let the patron know where they are in the hold queue for this title, if they
+	// are waiting for it.
+	book.HoldPosition, err = app.models.Holds.QueuePosition(book.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	err = app.writeJSON(w, http.StatusOK, envelope{"book": book}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// The showBookByISBNHandler() looks up a book by the ISBN at the end of the URL path,
+// which may be in either form and may include hyphens, as read by a barcode scanner.
+func (app *application) showBookByISBNHandler(w http.ResponseWriter, r *http.Request) {
+	isbn := strings.TrimPrefix(r.URL.Path, "/v1/books/isbn/")
+
+	book, err := app.models.Books.GetByISBN(isbn)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	book.Authors, err = app.models.Authors.GetAllForBook(book.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	book.Availability, err = app.models.Branches.AvailabilityForBook(book.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"book": book}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse the plaintext activation token from the request body.
 	var input struct {
@@ -290,6 +396,7 @@ func (app *application) listBooksHandler(w http.ResponseWriter, r *http.Request)
 		Author string
 		// Year     int
 		Genres []string
+		Branch uuid.UUID
 		data.Filters
 	}
 	// Initialize a new Validator instance.
@@ -303,6 +410,12 @@ func (app *application) listBooksHandler(w http.ResponseWriter, r *http.Request)
 	input.Author = app.readString(qs, "author", "")
 	// input.Year = app.readInt(qs, "year", 0, v)
 	input.Genres = app.readCSV(qs, "genres", []string{})
+	// Genres are matched in their normalized form. Synonyms and sub-genres are
+	// resolved by the database.
+	for i, genre := range input.Genres {
+		input.Genres[i] = models.NormalizeGenre(genre)
+	}
+	input.Branch = app.readUUID(qs, "branch", v)
 	// Get the page and page_size query string values as integers. Notice that we set
 	// the default page value to 1 and default page_size to 20, and that we pass the
 	// validator instance as the final argument here.
@@ -311,7 +424,11 @@ func (app *application) listBooksHandler(w http.ResponseWriter, r *http.Request)
 	// Extract the sort query string value, falling back to "id" if it is not provided
 	// by the client (which will imply a ascending sort on movie ID).
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "author", "year", "runtime", "-id", "-title", "-author", "-year", "-runtime"}
+	input.Filters.SortSafelist = []string{"id", "title", "author", "year", "runtime", "average_rating", "ratings_count", "-id", "-title", "-author", "-year", "-runtime", "-average_rating", "-ratings_count"}
+	// With ?format=csv every matching book is sent as a CSV file instead of a page of
+	// JSON.
+	format := app.readString(qs, "format", "json")
+	v.Check(validator.PermittedValue(format, "json", "csv"), "format", "must be json or csv")
 
 	// Check the Validator instance for any errors and use the failedValidationResponse()
 	// helper to send the client a response if necessary.
@@ -319,9 +436,13 @@ func (app *application) listBooksHandler(w http.ResponseWriter, r *http.Request)
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	if format == "csv" {
+		app.writeBooksCSV(w, r, input.Title, input.Author, input.Genres, input.Branch, input.Filters)
+		return
+	}
 	// Call the GetAll() method to retrieve the books, passing in the various filter
 	// parameters.
-	books, metadata, err := app.models.Books.GetAll(input.Title, input.Author, input.Genres, input.Filters)
+	books, metadata, err := app.models.Books.GetAll(input.Title, input.Author, input.Genres, input.Branch, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -360,6 +481,16 @@ func (app *application) updateBookHandler(w http.ResponseWriter, r *http.Request
 		Year   *int32        `json:"year"`
 		Pages  *models.Pages `json:"pages"`
 		Genres []string      `json:"genres"`
+		ISBN10 *string       `json:"isbn10"`
+		ISBN13 *string       `json:"isbn13"`
+		// Changing WorkID moves the book to a different work.
+		WorkID      *uuid.UUID        `json:"work_id"`
+		PublisherID *uuid.UUID        `json:"publisher_id"`
+		Edition     *string           `json:"edition"`
+		PublishedOn *models.CivilTime `json:"published_on"`
+		Format      *string           `json:"format"`
+		// If Authors is present it replaces all of the book's author credits.
+		Authors []*models.BookAuthor `json:"authors"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -389,11 +520,59 @@ func (app *application) updateBookHandler(w http.ResponseWriter, r *http.Request
 	if input.Genres != nil {
 		book.Genres = input.Genres
 	}
+	// The two forms of the ISBN are always kept in step, so changing one of them
+	// replaces both.
+	if input.ISBN10 != nil || input.ISBN13 != nil {
+		book.ISBN10, book.ISBN13 = "", ""
+		if input.ISBN10 != nil {
+			book.ISBN10 = *input.ISBN10
+		}
+		if input.ISBN13 != nil {
+			book.ISBN13 = *input.ISBN13
+		}
+	}
+
+	if input.WorkID != nil {
+		book.WorkID = *input.WorkID
+	}
+	if input.PublisherID != nil {
+		book.PublisherID = input.PublisherID
+	}
+	if input.Edition != nil {
+		book.Edition = *input.Edition
+	}
+	if input.PublishedOn != nil {
+		book.PublishedOn = input.PublishedOn
+	}
+	if input.Format != nil {
+		book.Format = *input.Format
+	}
 
 	// Validate the updated movie record, sending the client a 422 Unprocessable Entity
 	// response if any checks fail.
 	v := validator.New()
-	if models.ValidateBook(v, book); !v.Valid() {
+	err = app.checkBookReferences(v, book)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if input.Authors != nil {
+		err = app.resolveBookAuthors(v, input.Authors)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if input.Author == nil {
+			book.Author = models.AuthorStatement(input.Authors)
+		}
+		book.Authors = input.Authors
+	}
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if models.ValidateBook(v, book, taxonomy); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -404,6 +583,9 @@ func (app *application) updateBookHandler(w http.ResponseWriter, r *http.Request
 		switch {
 		case errors.Is(err, models.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, models.ErrDuplicateISBN):
+			v.AddError("isbn", "a book with this ISBN already exists")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Danik14/library/internal/models"
 	"github.com/Danik14/library/internal/validator"
 	"github.com/julienschmidt/httprouter"
 	uuid "github.com/satori/go.uuid"
@@ -28,10 +29,16 @@ type envelope map[string]any
 // }
 
 func (app *application) readUUIDParam(r *http.Request) (uuid.UUID, error) {
+	return app.readNamedUUIDParam(r, "id")
+}
+
+// The readNamedUUIDParam() helper reads a UUID from any named URL parameter, for
+// routes which contain more than one identifier (e.g. /v1/books/:id/copies/:copy_id).
+func (app *application) readNamedUUIDParam(r *http.Request, name string) (uuid.UUID, error) {
 	params := httprouter.ParamsFromContext(r.Context())
-	id, err := uuid.FromString(params.ByName("id"))
+	id, err := uuid.FromString(params.ByName(name))
 	if err != nil {
-		return uuid.Nil, errors.New("invalid id parameter")
+		return uuid.Nil, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
@@ -163,6 +170,38 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// The readBool() helper reads a boolean value from the query string. If no matching key
+// could be found it returns the provided default value, and if the value couldn't be
+// parsed then we record an error message in the provided Validator instance.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+// The readUUID() helper reads a UUID from the query string, returning uuid.Nil if no
+// matching key could be found. If the value isn't a valid UUID then we record an error
+// message in the provided Validator instance.
+func (app *application) readUUID(qs url.Values, key string, v *validator.Validator) uuid.UUID {
+	s := qs.Get(key)
+	if s == "" {
+		return uuid.Nil
+	}
+	id, err := uuid.FromString(s)
+	if err != nil {
+		v.AddError(key, "must be a valid UUID")
+		return uuid.Nil
+	}
+	return id
+}
+
 func (app *application) readDate(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
 	// Extract the value from the query string.
 	s := qs.Get(key)
@@ -181,6 +220,17 @@ func (app *application) readDate(qs url.Values, key string, defaultValue time.Ti
 	return date
 }
 
+// The hasPermission() helper reports whether a user has been granted a specific
+// permission. It is used by handlers which allow the owner of a record to act on it
+// without the permission, so can't use the requirePermission() middleware.
+func (app *application) hasPermission(user *models.User, code string) (bool, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+	return permissions.Include(code), nil
+}
+
 // The background() helper accepts an arbitrary function as a parameter.
 func (app *application) background(fn func()) {
 	// Increment the WaitGroup counter.
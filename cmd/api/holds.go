@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+// The createHoldHandler() places a hold on a book for the authenticated user, adding
+// them to the back of the queue for that title.
+func (app *application) createHoldHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	book, err := app.models.Books.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Patrons who don't mind which edition they get can ask for ?any_edition=true,
+	// and can choose where to collect the book with ?pickup_branch=.
+	v := validator.New()
+	qs := r.URL.Query()
+	anyEdition := app.readBool(qs, "any_edition", false, v)
+	pickupBranchID := app.readUUID(qs, "pickup_branch", v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	patronType, err := app.borrowingLimits(v, "user", user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	holds, err := app.models.Holds.CountActiveForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v.Check(holds < patronType.MaxHolds, "user", fmt.Sprintf("you already have the maximum of %d active holds", patronType.MaxHolds))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	loanable, err := app.hasLoanableCopy(book, anyEdition, patronType)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if v.Check(loanable, "book_id", "none of the copies of this book can be borrowed, they are for use in the library only"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	hold := &models.Hold{
+		BookID:     book.ID,
+		UserID:     user.ID,
+		AnyEdition: anyEdition,
+	}
+
+	if pickupBranchID != uuid.Nil {
+		_, err = app.models.Branches.Get(pickupBranchID)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				v.AddError("pickup_branch", "branch does not exist")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		hold.PickupBranchID = &pickupBranchID
+	}
+
+	err = app.models.Holds.Insert(hold)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateHold):
+			v.AddError("book_id", "you already have an active hold on this book")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// If there happens to be a copy on the shelf, it can be set aside right away.
+	app.allocateHolds(book.ID)
+	hold, err = app.models.Holds.Get(hold.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/holds/%s", hold.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"hold": hold}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The cancelHoldHandler() cancels a hold. Patrons may cancel their own holds, staff
+// with the loans:write permission may cancel anybody's.
+func (app *application) cancelHoldHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	hold, err := app.models.Holds.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if hold.UserID != user.ID {
+		permitted, err := app.hasPermission(user, "loans:write")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permitted {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	v := validator.New()
+	if v.Check(hold.IsActive(), "hold", "is no longer active"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Holds.Cancel(hold)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// A copy which was waiting on the hold shelf for this patron can now go to the
+	// next person in the queue.
+	if hold.CopyID != nil {
+		app.allocateHolds(hold.BookID)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"hold": hold}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listUserHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	active := app.readBool(r.URL.Query(), "active", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Users.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	holds, err := app.models.Holds.GetAllForUser(userID, active)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"holds": holds}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listBookHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.Books.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	holds, err := app.models.Holds.GetQueueForBook(bookID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"holds": holds}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The hasLoanableCopy() helper reports whether a hold on a book could ever be filled,
+// that is whether any copy which could serve it is loanable to patrons of the given
+// type. Copies of every edition count for "any edition" holds. Books which have no
+// copies in circulation yet, e.g. ones on order, can be held.
+func (app *application) hasLoanableCopy(book *models.Book, anyEdition bool, patronType *models.PatronType) (bool, error) {
+	bookIDs := []uuid.UUID{book.ID}
+	if anyEdition {
+		editions, err := app.models.Works.GetEditions(book.WorkID)
+		if err != nil {
+			return false, err
+		}
+		bookIDs = bookIDs[:0]
+		for _, edition := range editions {
+			bookIDs = append(bookIDs, edition.ID)
+		}
+	}
+
+	policies, err := app.models.Policies.GetAll()
+	if err != nil {
+		return false, err
+	}
+
+	circulating := 0
+	for _, bookID := range bookIDs {
+		copies, err := app.models.Copies.GetAllForBook(bookID)
+		if err != nil {
+			return false, err
+		}
+		for _, bookCopy := range copies {
+			if bookCopy.Status == models.CopyStatusLost || bookCopy.Status == models.CopyStatusWithdrawn {
+				continue
+			}
+			circulating++
+			if models.ResolvePolicy(policies, patronType, bookCopy.ItemType).Loanable {
+				return true, nil
+			}
+		}
+	}
+	return circulating == 0, nil
+}
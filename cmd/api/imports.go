@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Danik14/library/internal/marc"
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+)
+
+// maxImportBytes limits the size of uploaded catalog files, which are much larger than
+// the JSON bodies accepted elsewhere.
+const maxImportBytes = 10 * 1_048_576
+
+// The importMARCHandler() adds the books described by an uploaded file of MARC
+// records, in either ISO 2709 or MARCXML form, to the catalog. With ?dry_run=true the
+// records are only checked, so that librarians can fix problems before importing.
+// Records are imported one by one and the response lists the outcome of each.
+func (app *application) importMARCHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	dryRun := app.readBool(r.URL.Query(), "dry_run", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	records, err := marc.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError), errors.Is(err, marc.ErrInvalidRecord):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if len(records) == 0 {
+		app.badRequestResponse(w, r, errors.New("body must contain at least one MARC record"))
+		return
+	}
+
+	results, err := marc.Import(app.models, records, dryRun)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Errors != nil {
+			failed++
+		}
+	}
+	summary := envelope{
+		"dry_run":  dryRun,
+		"records":  len(results),
+		"valid":    len(results) - failed,
+		"failed":   failed,
+		"results":  results,
+		"imported": 0,
+	}
+	if !dryRun {
+		summary["imported"] = len(results) - failed
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"import": summary}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// csvColumns lists the columns which books can be imported from. The first five must
+// be present; columns which aren't listed, such as the id column of an exported file,
+// are ignored.
+var csvColumns = []string{"title", "author", "year", "pages", "genres", "isbn10", "isbn13", "edition", "format"}
+
+// maxImportRows limits how many books can be imported from a CSV file, as they are all
+// inserted in a single transaction.
+const maxImportRows = 5000
+
+// The importBooksCSVHandler() adds the books in an uploaded CSV file to the catalog.
+// The first row names the columns, and genres are separated by semicolons. Every row
+// is validated first: if any row is invalid nothing is imported and the errors are
+// reported by row number, counting the header as row 1. Otherwise all the books are
+// inserted in a single transaction.
+func (app *application) importBooksCSVHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	cr := csv.NewReader(r.Body)
+	cr.TrimLeadingSpace = true
+	// Rows may leave out trailing empty cells.
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		switch {
+		case errors.Is(err, io.EOF):
+			app.badRequestResponse(w, r, errors.New("body must contain a CSV header row"))
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		// Spreadsheet programs often start the file with a UTF-8 byte order mark.
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF")))
+		if _, exists := columns[name]; exists {
+			app.badRequestResponse(w, r, fmt.Errorf("header contains column %q more than once", name))
+			return
+		}
+		columns[name] = i
+	}
+	for _, name := range csvColumns[:5] {
+		if _, ok := columns[name]; !ok {
+			app.badRequestResponse(w, r, fmt.Errorf("header must contain a %q column", name))
+			return
+		}
+	}
+
+	taxonomy, err := app.models.Genres.Taxonomy()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	books := []*models.Book{}
+	rowErrors := map[string]map[string]string{}
+	seen := map[string]int{}
+	for row := 2; ; row++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if len(books) == maxImportRows {
+			app.badRequestResponse(w, r, fmt.Errorf("body must not contain more than %d books", maxImportRows))
+			return
+		}
+
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(unescapeCSVCell(strings.TrimSpace(record[i])))
+			}
+			return ""
+		}
+
+		v := validator.New()
+		book := &models.Book{
+			Title:   cell("title"),
+			Author:  cell("author"),
+			Genres:  []string{},
+			ISBN10:  cell("isbn10"),
+			ISBN13:  cell("isbn13"),
+			Edition: cell("edition"),
+			Format:  cell("format"),
+		}
+		if year, err := strconv.ParseInt(cell("year"), 10, 32); err == nil {
+			book.Year = int32(year)
+		} else {
+			v.AddError("year", "must be an integer value")
+		}
+		if pages, err := strconv.ParseUint(cell("pages"), 10, 32); err == nil {
+			book.Pages = models.Pages(pages)
+		} else {
+			v.AddError("pages", "must be a positive integer value")
+		}
+		for _, genre := range strings.Split(cell("genres"), ";") {
+			if genre = strings.TrimSpace(genre); genre != "" {
+				book.Genres = append(book.Genres, genre)
+			}
+		}
+
+		models.ValidateBook(v, book, taxonomy)
+
+		if book.ISBN13 != "" && v.Valid() {
+			if other, ok := seen[book.ISBN13]; ok {
+				v.AddError("isbn", fmt.Sprintf("is the same as in row %d", other))
+			}
+			seen[book.ISBN13] = row
+
+			_, err := app.models.Books.GetByISBN(book.ISBN13)
+			switch {
+			case err == nil:
+				v.AddError("isbn", "a book with this ISBN already exists")
+			case !errors.Is(err, models.ErrRecordNotFound):
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		if !v.Valid() {
+			rowErrors[fmt.Sprintf("row %d", row)] = v.Errors
+		}
+		books = append(books, book)
+	}
+
+	if len(books) == 0 {
+		app.badRequestResponse(w, r, errors.New("body must contain at least one book"))
+		return
+	}
+	if len(rowErrors) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, rowErrors)
+		return
+	}
+
+	err = app.models.Books.InsertAll(books)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateISBN):
+			v := validator.New()
+			v.AddError("isbn", "a book with the same ISBN as one in the file has just been added")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"imported": len(books), "books": books}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Danik14/library/internal/assert"
+	"github.com/Danik14/library/internal/models"
+)
+
+// duplicateISBNBookModel fails every InsertAll() as if another request had added a
+// book with one of the same ISBNs first.
+type duplicateISBNBookModel struct {
+	models.MockBookModel
+}
+
+func (b duplicateISBNBookModel) InsertAll(books []*models.Book) error {
+	return models.ErrDuplicateISBN
+}
+
+func TestImportBooksCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantBody []string
+	}{
+		{
+			name:     "Empty body",
+			body:     "",
+			wantCode: http.StatusBadRequest,
+			wantBody: []string{"body must contain a CSV header row"},
+		},
+		{
+			name:     "Missing column",
+			body:     "title,author,year,pages\nDune,Frank Herbert,1965,412\n",
+			wantCode: http.StatusBadRequest,
+			wantBody: []string{`header must contain a \"genres\" column`},
+		},
+		{
+			name:     "Repeated column",
+			body:     "title,author,year,pages,genres,Title\n",
+			wantCode: http.StatusBadRequest,
+			wantBody: []string{`header contains column \"title\" more than once`},
+		},
+		{
+			name:     "Header only",
+			body:     "title,author,year,pages,genres\n",
+			wantCode: http.StatusBadRequest,
+			wantBody: []string{"body must contain at least one book"},
+		},
+		{
+			name: "Row errors",
+			body: "title,author,year,pages,genres\n" +
+				"Dune,Frank Herbert,1965,412,science fiction\n" +
+				",Ursula K. Le Guin,soon,-1,\n",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{
+				`"row 3"`,
+				`"title": "must be provided"`,
+				`"year": "must be an integer value"`,
+				`"pages": "must be a positive integer value"`,
+				`"genres": "must contain at least 1 genre"`,
+			},
+		},
+		{
+			name: "Duplicate ISBN in file",
+			body: "title,author,year,pages,genres,isbn13\n" +
+				"The Art of Electronics,Paul Horowitz,1980,716,electronics,978-0-306-40615-7\n" +
+				"The Art of Electronics,Paul Horowitz,1980,716,electronics,9780306406157\n",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{`"row 3"`, `"isbn": "is the same as in row 2"`},
+		},
+		{
+			name: "Valid",
+			body: "\uFEFFid,Title,Author,Year,Pages,Genres,ISBN13\n" +
+				"1,Dune,Frank Herbert,1965,412,science fiction; classics,\n" +
+				"2,'=SUM(A1:A2),Someone,2001,10,spreadsheets,9780306406157\n",
+			wantCode: http.StatusCreated,
+			wantBody: []string{
+				`"imported": 2`,
+				`"classics"`,
+				`"title": "=SUM(A1:A2)"`,
+				`"isbn10": "0306406152"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/books/import", strings.NewReader(tt.body))
+			app.importBooksCSVHandler(rr, r)
+
+			assert.Equal(t, rr.Code, tt.wantCode)
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, rr.Body.String(), want)
+			}
+		})
+	}
+
+	t.Run("Duplicate ISBN on insert", func(t *testing.T) {
+		app := newTestApplication(t)
+		app.models.Books = duplicateISBNBookModel{}
+
+		rr := httptest.NewRecorder()
+		body := "title,author,year,pages,genres,isbn13\nDune,Frank Herbert,1965,412,science fiction,9780306406157\n"
+		r := httptest.NewRequest(http.MethodPost, "/v1/books/import", strings.NewReader(body))
+		app.importBooksCSVHandler(rr, r)
+
+		assert.Equal(t, rr.Code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, rr.Body.String(), "has just been added")
+	})
+}
+
+func TestEscapeCSVCell(t *testing.T) {
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{"", ""},
+		{"Dune", "Dune"},
+		{"=HYPERLINK(\"http://example.com\")", "'=HYPERLINK(\"http://example.com\")"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tTab", "'\tTab"},
+		{"1-2", "1-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cell, func(t *testing.T) {
+			got := escapeCSVCell(tt.cell)
+			assert.Equal(t, got, tt.want)
+			assert.Equal(t, unescapeCSVCell(got), tt.cell)
+		})
+	}
+}
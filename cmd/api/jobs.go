@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// The startJobs() method launches the periodic maintenance jobs which run inside the
+// API process. They all stop when the given context is cancelled.
+func (app *application) startJobs(ctx context.Context) {
+	app.schedule(ctx, "expire holds", time.Hour, app.expireHolds)
+	app.schedule(ctx, "accrue fines", 24*time.Hour, app.accrueFines)
+	app.schedule(ctx, "send reminders", 24*time.Hour, app.sendReminders)
+}
+
+// The schedule() helper runs fn at startup and then every interval in a background
+// goroutine until ctx is cancelled. Running it at startup means a job still runs if the
+// process restarts more often than the interval; the jobs are all safe to run again
+// early. The goroutine is tracked by app.wg, so a graceful shutdown waits for a run
+// that is in progress to finish. A panic or error in one run is logged and doesn't
+// stop the following runs.
+func (app *application) schedule(ctx context.Context, name string, interval time.Duration, fn func() error) {
+	app.background(func() {
+		app.runJob(name, fn)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				app.runJob(name, fn)
+			}
+		}
+	})
+}
+
+func (app *application) runJob(name string, fn func() error) {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), map[string]string{"job": name})
+		}
+	}()
+	err := fn()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"job": name})
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+func (app *application) createLoanHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		CopyID uuid.UUID `json:"copy_id"`
+		UserID uuid.UUID `json:"user_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.CopyID != uuid.Nil, "copy_id", "must be provided")
+	v.Check(input.UserID != uuid.Nil, "user_id", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Look up the borrower. Only activated accounts are allowed to borrow books.
+	borrower, err := app.models.Users.Get(input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("user_id", "user does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !borrower.Activated {
+		v.AddError("user_id", "borrower account must be activated")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	patronType, err := app.borrowingLimits(v, "user_id", borrower)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	loans, err := app.models.Loans.CountActiveForUser(borrower.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v.Check(loans < patronType.MaxLoans, "user_id", fmt.Sprintf("borrower already has the maximum of %d loans", patronType.MaxLoans))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	bookCopy, err := app.models.Copies.Get(input.CopyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("copy_id", "copy does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	policy, err := app.circulationPolicy(patronType, bookCopy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !policy.Loanable {
+		v.AddError("copy_id", "copy is for use in the library only")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The due date is always calculated here on the server, never accepted from the
+	// client.
+	loan := &models.Loan{
+		CopyID: bookCopy.ID,
+		UserID: borrower.ID,
+		DueAt:  models.DueDate(time.Now(), policy.LoanPeriod()),
+	}
+
+	err = app.models.Loans.Checkout(loan)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrCopyUnavailable):
+			v.AddError("copy_id", "copy is not available for loan")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Checking out may have released a different copy that was set aside for this
+	// borrower, so give the rest of the queue a chance at it.
+	app.allocateHolds(loan.BookID)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/loans/%s", loan.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"loan": loan}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showLoanHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	loan, err := app.models.Loans.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"loan": loan}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) returnLoanHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	loan, err := app.models.Loans.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	if v.Check(loan.IsActive(), "loan", "has already been returned"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Loans.Return(loan)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Charge the borrower for any days the copy was late. The loan has already been
+	// returned at this point, so a failure here is logged rather than sent to the
+	// client.
+	_, err = app.models.Fines.AccrueForLoan(loan.ID, time.Now())
+	if err != nil {
+		app.logError(r, err)
+	}
+
+	// The returned copy goes to the next patron waiting for the title, if any.
+	app.allocateHolds(loan.BookID)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"loan": loan}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listUserLoansHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Active bool
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Active = app.readBool(qs, "active", false, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"created_at", "due_at", "-created_at", "-due_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Users.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	loans, metadata, err := app.models.Loans.GetAllForUser(userID, input.Active, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"loans": loans, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The renewLoanHandler() extends an active loan by a full loan period from today.
+// Patrons may renew their own loans, staff with the loans:write permission may renew
+// anybody's. A loan can't be renewed more than the configured number of times, or
+// while another patron is waiting in the hold queue for the title.
+func (app *application) renewLoanHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	loan, err := app.models.Loans.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if loan.UserID != user.ID {
+		permitted, err := app.hasPermission(user, "loans:write")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permitted {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	v := validator.New()
+	if v.Check(loan.IsActive(), "loan", "has already been returned"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	queue, err := app.models.Holds.GetQueueForBook(loan.BookID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	waiting := false
+	for _, hold := range queue {
+		if hold.UserID != loan.UserID && hold.Status == models.HoldStatusWaiting {
+			waiting = true
+			break
+		}
+	}
+
+	borrower, err := app.models.Users.Get(loan.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	patronType, err := app.borrowingLimits(v, "loan", borrower)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	bookCopy, err := app.models.Copies.Get(loan.CopyID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	policy, err := app.circulationPolicy(patronType, bookCopy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v.Check(loan.Renewals < policy.MaxRenewals, "loan", fmt.Sprintf("cannot be renewed more than %d times", policy.MaxRenewals))
+	v.Check(!waiting, "loan", "cannot be renewed because another patron has a hold on this book")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Charge for any days an overdue loan is already late before the due date moves,
+	// otherwise they would be lost.
+	_, err = app.models.Fines.AccrueForLoan(loan.ID, time.Now())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Renewing never brings the due date forward, e.g. if the loan period has been
+	// shortened since the book was checked out.
+	dueAt := models.DueDate(time.Now(), policy.LoanPeriod())
+	if dueAt.After(loan.DueAt) {
+		loan.DueAt = dueAt
+	}
+
+	err = app.models.Loans.Renew(loan)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"loan": loan}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -209,3 +209,28 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	// Wrap this with the requireActivatedUser() middleware before returning it.
 	return app.requireActivatedUser(fn)
 }
+
+// Checks that the authenticated user is either the user identified by the :id URL
+// parameter, or has been granted the given permission. This lets patrons see their own
+// records while staff can see everyone's.
+func (app *application) requireSelfOrPermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		id, err := app.readUUIDParam(r)
+		if err == nil && id == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+		permitted, err := app.hasPermission(user, code)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permitted {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return app.requireActivatedUser(fn)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/oai"
+)
+
+// oaiBatchSize is how many headers or records are sent in each part of a list. The
+// harvester asks for the rest with the resumption token.
+const oaiBatchSize = 100
+
+// The oaiHandler() answers OAI-PMH requests, which harvesters send either in the
+// query string or as a form. Protocol errors are reported in the XML response with a
+// 200 OK status, as the protocol requires. Unlike the rest of the API the endpoint
+// doesn't require authentication, as harvesters can't log in, and only bibliographic
+// metadata is exposed.
+func (app *application) oaiHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	req, oaiErr := oai.ParseRequest(app.oaiBaseURL(r), r.Form)
+	resp := oai.NewResponse(req, time.Now())
+	if oaiErr == nil {
+		switch req.Verb {
+		case oai.VerbIdentify:
+			err = app.oaiIdentify(r, resp)
+		case oai.VerbListMetadataFormats:
+			oaiErr, err = app.oaiListMetadataFormats(resp, req)
+		case oai.VerbListSets:
+			oaiErr, err = app.oaiListSets(resp, req)
+		case oai.VerbGetRecord:
+			oaiErr, err = app.oaiGetRecord(resp, req)
+		case oai.VerbListIdentifiers, oai.VerbListRecords:
+			oaiErr, err = app.oaiList(resp, req)
+		}
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if oaiErr != nil {
+		resp.Errors = append(resp.Errors, oaiErr)
+	}
+
+	var buf bytes.Buffer
+	err = resp.Write(&buf)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func (app *application) oaiIdentify(r *http.Request, resp *oai.Response) error {
+	earliest, err := app.models.Books.EarliestUpdate()
+	if err != nil {
+		return err
+	}
+	if earliest.IsZero() {
+		earliest = time.Now()
+	}
+
+	// Deleted books aren't kept track of, so harvesters have to harvest the whole
+	// catalog again from time to time to notice them.
+	resp.Identify = &oai.Identify{
+		RepositoryName:    app.config.oai.repositoryName,
+		BaseURL:           app.oaiBaseURL(r),
+		ProtocolVersion:   "2.0",
+		AdminEmail:        []string{app.config.oai.adminEmail},
+		EarliestDatestamp: oai.Datestamp(earliest),
+		DeletedRecord:     "no",
+		Granularity:       "YYYY-MM-DDThh:mm:ssZ",
+	}
+	return nil
+}
+
+func (app *application) oaiListMetadataFormats(resp *oai.Response, req *oai.Request) (*oai.Error, error) {
+	if req.Identifier != "" {
+		_, oaiErr, err := app.oaiBook(req.Identifier)
+		if oaiErr != nil || err != nil {
+			return oaiErr, err
+		}
+	}
+
+	resp.ListMetadataFormats = &oai.ListMetadataFormats{Formats: []oai.MetadataFormat{oai.DublinCoreFormat}}
+	return nil, nil
+}
+
+// The oaiListSets() helper lists the genres as sets. The list is always sent whole,
+// so resumption tokens are never valid.
+func (app *application) oaiListSets(resp *oai.Response, req *oai.Request) (*oai.Error, error) {
+	if req.ResumptionToken != "" {
+		return &oai.Error{Code: oai.CodeBadResumptionToken, Message: "the resumption token is invalid"}, nil
+	}
+
+	genres, err := app.models.Genres.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(genres) == 0 {
+		return &oai.Error{Code: oai.CodeNoSetHierarchy, Message: "the repository has no genres"}, nil
+	}
+
+	sets, _ := oai.Sets(genres)
+	resp.ListSets = &oai.ListSets{Sets: sets}
+	return nil, nil
+}
+
+func (app *application) oaiGetRecord(resp *oai.Response, req *oai.Request) (*oai.Error, error) {
+	if req.MetadataPrefix != oai.DublinCoreFormat.Prefix {
+		return &oai.Error{Code: oai.CodeCannotDisseminateFormat, Message: "only oai_dc is supported"}, nil
+	}
+
+	book, oaiErr, err := app.oaiBook(req.Identifier)
+	if oaiErr != nil || err != nil {
+		return oaiErr, err
+	}
+
+	genres, err := app.models.Genres.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	_, specs := oai.Sets(genres)
+
+	resp.GetRecord = &oai.GetRecord{Record: app.oaiRecord(book, specs, true)}
+	return nil, nil
+}
+
+// The oaiList() helper answers both ListIdentifiers and ListRecords, which select
+// books in the same way and differ only in whether the metadata is sent. Books are
+// listed in the order they were last updated, a batch at a time.
+func (app *application) oaiList(resp *oai.Response, req *oai.Request) (*oai.Error, error) {
+	selection, oaiErr := req.Selection()
+	if oaiErr != nil {
+		return oaiErr, nil
+	}
+	if selection.MetadataPrefix != oai.DublinCoreFormat.Prefix {
+		return &oai.Error{Code: oai.CodeCannotDisseminateFormat, Message: "only oai_dc is supported"}, nil
+	}
+
+	genres, err := app.models.Genres.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	sets, specs := oai.Sets(genres)
+
+	genre := ""
+	if selection.Set != "" {
+		if len(sets) == 0 {
+			return &oai.Error{Code: oai.CodeNoSetHierarchy, Message: "the repository has no genres"}, nil
+		}
+		for _, set := range sets {
+			if set.Spec == selection.Set {
+				genre = set.Name
+			}
+		}
+		if genre == "" {
+			return &oai.Error{Code: oai.CodeNoRecordsMatch, Message: "there is no such set"}, nil
+		}
+	}
+
+	// Fetch one more book than is sent, to find out whether the list goes on.
+	books, err := app.models.Books.Harvest(selection.From, selection.Until, genre, selection.After, selection.AfterID, oaiBatchSize+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(books) == 0 {
+		return &oai.Error{Code: oai.CodeNoRecordsMatch, Message: "no records match the request"}, nil
+	}
+
+	var token *oai.ResumptionToken
+	if len(books) > oaiBatchSize {
+		books = books[:oaiBatchSize]
+		last := books[len(books)-1]
+		token = &oai.ResumptionToken{Token: selection.ResumptionToken(last.UpdatedAt, last.ID)}
+	} else if selection.Resumed {
+		token = &oai.ResumptionToken{}
+	}
+
+	withMetadata := req.Verb == oai.VerbListRecords
+	if withMetadata {
+		resp.ListRecords = &oai.ListRecords{ResumptionToken: token}
+	} else {
+		resp.ListIdentifiers = &oai.ListIdentifiers{ResumptionToken: token}
+	}
+	for _, book := range books {
+		record := app.oaiRecord(book, specs, withMetadata)
+		if withMetadata {
+			resp.ListRecords.Records = append(resp.ListRecords.Records, record)
+		} else {
+			resp.ListIdentifiers.Headers = append(resp.ListIdentifiers.Headers, record.Header)
+		}
+	}
+	return nil, nil
+}
+
+// The oaiBook() helper fetches the book with an OAI identifier, reporting
+// idDoesNotExist if it isn't one of ours or the book doesn't exist.
+func (app *application) oaiBook(identifier string) (*models.Book, *oai.Error, error) {
+	notFound := &oai.Error{Code: oai.CodeIDDoesNotExist, Message: "there is no record with this identifier"}
+
+	id, ok := oai.ParseIdentifier(app.config.oai.repositoryID, identifier)
+	if !ok {
+		return nil, notFound, nil
+	}
+	book, err := app.models.Books.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			return nil, notFound, nil
+		default:
+			return nil, nil, err
+		}
+	}
+	return book, nil, nil
+}
+
+// The oaiRecord() helper describes a book as a record, placing it in the sets of its
+// genres.
+func (app *application) oaiRecord(book *models.Book, specs map[string]string, withMetadata bool) *oai.Record {
+	record := &oai.Record{
+		Header: &oai.Header{
+			Identifier: oai.Identifier(app.config.oai.repositoryID, book.ID),
+			Datestamp:  oai.Datestamp(book.UpdatedAt),
+		},
+	}
+	for _, genre := range book.Genres {
+		if spec, ok := specs[genre]; ok {
+			record.Header.SetSpecs = append(record.Header.SetSpecs, spec)
+		}
+	}
+	if withMetadata {
+		record.Metadata = &oai.Metadata{DC: oai.NewDublinCore(book)}
+	}
+	return record
+}
+
+// The oaiBaseURL() helper returns the URL of the OAI-PMH endpoint, as the harvester
+// reached it.
+func (app *application) oaiBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/oai"
+}
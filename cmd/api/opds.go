@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/opds"
+	"github.com/Danik14/library/internal/validator"
+	"github.com/julienschmidt/httprouter"
+	uuid "github.com/satori/go.uuid"
+)
+
+// The OPDS catalog is served in two versions side by side: /opds/1.2 as Atom and
+// /opds/2.0 as JSON. Both are built from the same feeds.
+const (
+	opdsVersion1 = "1.2"
+	opdsVersion2 = "2.0"
+)
+
+// The opdsRootHandler() returns the start of the catalog, a navigation feed leading to
+// all books, and to books by genre and by author.
+func (app *application) opdsRootHandler(w http.ResponseWriter, r *http.Request) {
+	version, ok := app.readOPDSVersion(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	feed := &opds.Feed{
+		ID:      "urn:library:opds",
+		Title:   "Library catalog",
+		Updated: time.Now(),
+		Links:   app.opdsLinks(r, version, false),
+		Entries: []*opds.Entry{
+			{
+				ID:      "urn:library:opds:books",
+				Title:   "All books",
+				Summary: "Every book in the catalog, by title.",
+				Link:    app.opdsLink(version, opds.RelSubsection, "/books", nil, true),
+			},
+			{
+				ID:      "urn:library:opds:genres",
+				Title:   "By genre",
+				Summary: "Browse the catalog by genre.",
+				Link:    app.opdsLink(version, opds.RelSubsection, "/genres", nil, false),
+			},
+			{
+				ID:      "urn:library:opds:authors",
+				Title:   "By author",
+				Summary: "Browse the catalog by author.",
+				Link:    app.opdsLink(version, opds.RelSubsection, "/authors", nil, false),
+			},
+		},
+	}
+
+	app.writeOPDS(w, r, version, feed)
+}
+
+// The opdsBooksHandler() returns an acquisition feed with a page of books, filtered in
+// the same way as listBooksHandler(). ?query= searches the titles and ?author= the
+// author field. ?genre= and ?author_id= are what the genre and author feeds link to;
+// the books of an author are those on which they are credited, so they aren't mixed up
+// with books by authors with a similar name. Books with digital resources have an
+// acquisition link for each of them.
+func (app *application) opdsBooksHandler(w http.ResponseWriter, r *http.Request) {
+	version, ok := app.readOPDSVersion(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	query := app.readString(qs, "query", "")
+	author := app.readString(qs, "author", "")
+	authorID := app.readUUID(qs, "author_id", v)
+	genres := []string{}
+	if genre := app.readString(qs, "genre", ""); genre != "" {
+		genres = append(genres, models.NormalizeGenre(genre))
+	}
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", "title"),
+		SortSafelist: []string{"title", "author", "year", "-title", "-author", "-year"},
+	}
+	if authorID != uuid.Nil {
+		v.Check(query == "" && author == "" && len(genres) == 0, "author_id", "must not be combined with query, author or genre")
+	}
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var credited *models.Author
+	var books []*models.Book
+	var metadata data.Metadata
+	var err error
+	if authorID != uuid.Nil {
+		credited, err = app.models.Authors.Get(authorID)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		books, metadata, err = app.models.Books.GetAllForAuthor(authorID, filters)
+	} else {
+		books, metadata, err = app.models.Books.GetAll(query, author, genres, uuid.Nil, filters)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ids := make([]uuid.UUID, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+	resources, err := app.models.DigitalResources.GetAllForBooks(ids)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	feed := &opds.Feed{
+		ID:           "urn:library:opds:books",
+		Title:        "All books",
+		Updated:      time.Now(),
+		Links:        append(app.opdsLinks(r, version, true), app.opdsPageLinks(version, "/books", qs, metadata)...),
+		Publications: []*opds.Publication{},
+		Page:         &opds.Page{TotalItems: metadata.TotalRecords, ItemsPerPage: filters.PageSize, CurrentPage: filters.Page},
+	}
+	switch {
+	case credited != nil:
+		feed.Title = "Books by " + credited.Name
+	case query != "":
+		feed.Title = "Search results for " + strconv.Quote(query)
+	case author != "":
+		feed.Title = "Books by " + author
+	case len(genres) > 0:
+		feed.Title = "Books in " + qs.Get("genre")
+	}
+
+	for _, book := range books {
+		publication := opds.FromBook(book, resources[book.ID])
+		publication.Links = append(publication.Links, opds.Link{
+			Rel:  opds.RelAlternate,
+			Href: "/v1/books/" + book.ID.String(),
+			Type: "application/json",
+		})
+		feed.Publications = append(feed.Publications, publication)
+	}
+
+	app.writeOPDS(w, r, version, feed)
+}
+
+// The opdsGenresHandler() returns a navigation feed for the genres directly below the
+// genre given by ?parent=, or for the top-level genres if there is no parent. Genres
+// with sub-genres lead to a feed of their own, and the rest to their books. The books
+// of a genre include those of its sub-genres, so below a parent there is also an entry
+// for all of the parent's books.
+func (app *application) opdsGenresHandler(w http.ResponseWriter, r *http.Request) {
+	version, ok := app.readOPDSVersion(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	parentID := app.readUUID(r.URL.Query(), "parent", v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	genres, err := app.models.Genres.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var parent *models.Genre
+	hasChildren := map[uuid.UUID]bool{}
+	for _, genre := range genres {
+		if genre.ID == parentID {
+			parent = genre
+		}
+		if genre.ParentID != nil {
+			hasChildren[*genre.ParentID] = true
+		}
+	}
+	if parentID != uuid.Nil && parent == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	feed := &opds.Feed{
+		ID:      "urn:library:opds:genres",
+		Title:   "Genres",
+		Updated: time.Now(),
+		Links:   app.opdsLinks(r, version, false),
+		Entries: []*opds.Entry{},
+	}
+	if parent != nil {
+		feed.ID += ":" + parent.ID.String()
+		feed.Title = parent.Name
+		feed.Entries = append(feed.Entries, &opds.Entry{
+			ID:    "urn:library:opds:genres:" + parent.ID.String() + ":all",
+			Title: "All " + parent.Name,
+			Link:  app.opdsLink(version, opds.RelSubsection, "/books", url.Values{"genre": {parent.Name}}, true),
+		})
+
+		up := url.Values{}
+		if parent.ParentID != nil {
+			up.Set("parent", parent.ParentID.String())
+		}
+		feed.Links = append(feed.Links, app.opdsLink(version, opds.RelUp, "/genres", up, false))
+	}
+
+	for _, genre := range genres {
+		if parent == nil && genre.ParentID != nil || parent != nil && (genre.ParentID == nil || *genre.ParentID != parent.ID) {
+			continue
+		}
+		entry := &opds.Entry{
+			ID:    "urn:library:opds:genres:" + genre.ID.String(),
+			Title: genre.Name,
+			Link:  app.opdsLink(version, opds.RelSubsection, "/books", url.Values{"genre": {genre.Name}}, true),
+		}
+		if hasChildren[genre.ID] {
+			entry.Link = app.opdsLink(version, opds.RelSubsection, "/genres", url.Values{"parent": {genre.ID.String()}}, false)
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	app.writeOPDS(w, r, version, feed)
+}
+
+// The opdsAuthorsHandler() returns a navigation feed with a page of authors in
+// alphabetical order, each leading to their books.
+func (app *application) opdsAuthorsHandler(w http.ResponseWriter, r *http.Request) {
+	version, ok := app.readOPDSVersion(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 50, v),
+		Sort:         "name",
+		SortSafelist: []string{"name"},
+	}
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	authors, metadata, err := app.models.Authors.GetAll("", filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	feed := &opds.Feed{
+		ID:      "urn:library:opds:authors",
+		Title:   "Authors",
+		Updated: time.Now(),
+		Links:   append(app.opdsLinks(r, version, false), app.opdsPageLinks(version, "/authors", qs, metadata)...),
+		Entries: []*opds.Entry{},
+		Page:    &opds.Page{TotalItems: metadata.TotalRecords, ItemsPerPage: filters.PageSize, CurrentPage: filters.Page},
+	}
+	for _, author := range authors {
+		feed.Entries = append(feed.Entries, &opds.Entry{
+			ID:    "urn:library:opds:authors:" + author.ID.String(),
+			Title: author.Name,
+			Link:  app.opdsLink(version, opds.RelSubsection, "/books", url.Values{"author_id": {author.ID.String()}}, true),
+		})
+	}
+
+	app.writeOPDS(w, r, version, feed)
+}
+
+// The opdsSearchHandler() returns the OpenSearch description which OPDS 1.2 clients
+// read to find out how to search the catalog.
+func (app *application) opdsSearchHandler(w http.ResponseWriter, r *http.Request) {
+	version, ok := app.readOPDSVersion(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	results := app.opdsLink(version, "", "/books", nil, true)
+	results.Href += "?query={searchTerms}"
+
+	var buf bytes.Buffer
+	err := opds.WriteOpenSearch(&buf, "Library", "Search the library catalog by title.", results)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", opds.MediaTypeOpenSearch)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// The readOPDSVersion() helper reads the version of the catalog from the URL, and
+// reports whether it is one we serve.
+func (app *application) readOPDSVersion(r *http.Request) (string, bool) {
+	version := httprouter.ParamsFromContext(r.Context()).ByName("version")
+	return version, version == opdsVersion1 || version == opdsVersion2
+}
+
+// The opdsLink() helper returns a link to one of the feeds of the given version of the
+// catalog, with the media type clients expect of it.
+func (app *application) opdsLink(version, rel, path string, qs url.Values, acquisition bool) opds.Link {
+	link := opds.Link{Rel: rel, Href: "/opds/" + version + path, Type: opds.MediaTypeJSON}
+	if len(qs) > 0 {
+		link.Href += "?" + qs.Encode()
+	}
+	if version == opdsVersion1 {
+		link.Type = opds.MediaTypeNavigation
+		if acquisition {
+			link.Type = opds.MediaTypeAcquisition
+		}
+	}
+	return link
+}
+
+// The opdsLinks() helper returns the links every feed has: to itself, to the start of
+// the catalog and to the search. OPDS 2.0 clients search with a URI template, while
+// OPDS 1.2 clients read an OpenSearch description.
+func (app *application) opdsLinks(r *http.Request, version string, acquisition bool) []opds.Link {
+	self := app.opdsLink(version, opds.RelSelf, "", nil, acquisition)
+	self.Href = r.URL.RequestURI()
+
+	search := opds.Link{Rel: opds.RelSearch, Href: "/opds/" + version + "/search", Type: opds.MediaTypeOpenSearch}
+	if version == opdsVersion2 {
+		search = app.opdsLink(version, opds.RelSearch, "/books{?query}", nil, true)
+		search.Templated = true
+	}
+
+	return []opds.Link{self, app.opdsLink(version, opds.RelStart, "", nil, false), search}
+}
+
+// The opdsPageLinks() helper returns the links to the first, previous, next and last
+// pages of a paginated feed, keeping the rest of the query string.
+func (app *application) opdsPageLinks(version, path string, qs url.Values, metadata data.Metadata) []opds.Link {
+	if metadata.LastPage == 0 {
+		return nil
+	}
+
+	acquisition := path == "/books"
+	page := func(rel string, n int) opds.Link {
+		values := url.Values{}
+		for key, value := range qs {
+			values[key] = value
+		}
+		values.Set("page", strconv.Itoa(n))
+		return app.opdsLink(version, rel, path, values, acquisition)
+	}
+
+	links := []opds.Link{page(opds.RelFirst, metadata.FirstPage)}
+	if metadata.CurrentPage > metadata.FirstPage {
+		links = append(links, page(opds.RelPrevious, metadata.CurrentPage-1))
+	}
+	if metadata.CurrentPage < metadata.LastPage {
+		links = append(links, page(opds.RelNext, metadata.CurrentPage+1))
+	}
+	return append(links, page(opds.RelLast, metadata.LastPage))
+}
+
+// The writeOPDS() helper sends a feed as Atom or JSON, depending on the version of the
+// catalog it belongs to.
+func (app *application) writeOPDS(w http.ResponseWriter, r *http.Request, version string, feed *opds.Feed) {
+	var buf bytes.Buffer
+	var err error
+	contentType := opds.MediaTypeJSON
+	if version == opdsVersion1 {
+		err = opds.WriteAtom(&buf, feed)
+		contentType = opds.MediaTypeNavigation
+		if feed.IsAcquisition() {
+			contentType = opds.MediaTypeAcquisition
+		}
+	} else {
+		err = opds.WriteJSON(&buf, feed)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+func (app *application) listOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Branch uuid.UUID
+		Fund   uuid.UUID
+		Status string
+		Vendor string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Branch = app.readUUID(qs, "branch", v)
+	input.Fund = app.readUUID(qs, "fund", v)
+	input.Status = app.readString(qs, "status", "")
+	input.Vendor = app.readString(qs, "vendor", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"created_at", "received_at", "title", "vendor", "-created_at", "-received_at", "-title", "-vendor"}
+
+	if input.Status != "" {
+		v.Check(validator.PermittedValue(input.Status, models.OrderStatuses...), "status", "invalid status value")
+	}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	orders, metadata, err := app.models.Orders.GetAll(input.Branch, input.Fund, input.Status, input.Vendor, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"orders": orders, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createOrderHandler() places a purchase order, encumbering its total against its
+// fund in the current fiscal year. Giving a suggestion_id converts an open suggestion
+// into the order, in which case the title, author and ISBN default to those of the
+// suggestion.
+func (app *application) createOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SuggestionID *uuid.UUID `json:"suggestion_id"`
+		Title        string     `json:"title"`
+		Author       string     `json:"author"`
+		ISBN         string     `json:"isbn"`
+		Vendor       string     `json:"vendor"`
+		Quantity     int32      `json:"quantity"`
+		UnitPrice    int64      `json:"unit_price"`
+		FundID       *uuid.UUID `json:"fund_id"`
+		BranchID     uuid.UUID  `json:"branch_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	order := &models.PurchaseOrder{
+		SuggestionID: input.SuggestionID,
+		Title:        strings.TrimSpace(input.Title),
+		Author:       strings.TrimSpace(input.Author),
+		ISBN13:       input.ISBN,
+		Vendor:       strings.TrimSpace(input.Vendor),
+		Quantity:     input.Quantity,
+		UnitPrice:    input.UnitPrice,
+		FundID:       input.FundID,
+		FiscalYear:   app.currentFiscalYear(),
+		BranchID:     input.BranchID,
+		OrderedBy:    &user.ID,
+	}
+
+	v := validator.New()
+
+	if input.SuggestionID != nil {
+		suggestion, err := app.models.Suggestions.Get(*input.SuggestionID)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				v.AddError("suggestion_id", "suggestion does not exist")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		v.Check(suggestion.IsOpen(), "suggestion_id", fmt.Sprintf("suggestion is %s", suggestion.Status))
+		if order.Title == "" {
+			order.Title = suggestion.Title
+		}
+		if order.Author == "" {
+			order.Author = suggestion.Author
+		}
+		if order.ISBN13 == "" {
+			order.ISBN13 = suggestion.ISBN13
+		}
+	}
+
+	if models.ValidatePurchaseOrder(v, order); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.checkOrderReferences(v, order)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Orders.Insert(order)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, models.ErrInsufficientFunds):
+			v.AddError("fund_id", "fund does not have enough money available for this order")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/orders/%s", order.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"order": order}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order, err := app.readOrder(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The updateOrderHandler() changes an order which hasn't been received, cancelled or
+// invoiced. Moving it to another fund or fiscal_year moves its encumbrance too, which
+// is how orders placed before funds were introduced are moved to the right fiscal
+// year, as they were put in the calendar year they were placed in.
+func (app *application) updateOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order, err := app.readOrder(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Title      *string    `json:"title"`
+		Author     *string    `json:"author"`
+		ISBN       *string    `json:"isbn"`
+		Vendor     *string    `json:"vendor"`
+		Quantity   *int32     `json:"quantity"`
+		UnitPrice  *int64     `json:"unit_price"`
+		FundID     *uuid.UUID `json:"fund_id"`
+		FiscalYear *int       `json:"fiscal_year"`
+		BranchID   *uuid.UUID `json:"branch_id"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	currency := order.Currency
+
+	if input.Title != nil {
+		order.Title = strings.TrimSpace(*input.Title)
+	}
+	if input.Author != nil {
+		order.Author = strings.TrimSpace(*input.Author)
+	}
+	if input.ISBN != nil {
+		order.ISBN13 = *input.ISBN
+	}
+	if input.Vendor != nil {
+		order.Vendor = strings.TrimSpace(*input.Vendor)
+	}
+	if input.Quantity != nil {
+		order.Quantity = *input.Quantity
+	}
+	if input.UnitPrice != nil {
+		order.UnitPrice = *input.UnitPrice
+	}
+	if input.FundID != nil {
+		order.FundID = input.FundID
+	}
+	if input.FiscalYear != nil {
+		order.FiscalYear = *input.FiscalYear
+	}
+	if input.BranchID != nil {
+		order.BranchID = *input.BranchID
+	}
+
+	v := validator.New()
+	v.Check(order.Status == models.OrderStatusOrdered, "status", fmt.Sprintf("order is already %s", order.Status))
+	v.Check(!order.IsInvoiced(), "status", "order has already been invoiced")
+	if models.ValidatePurchaseOrder(v, order); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.checkOrderReferences(v, order)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// The unit price is in minor units of the fund's currency, so it can't be carried
+	// over to a fund in another currency.
+	if v.Valid() && order.Currency != currency && input.UnitPrice == nil {
+		v.AddError("unit_price", fmt.Sprintf("must be given again in %s, the currency of the new fund", order.Currency))
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Orders.Update(order)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, models.ErrInsufficientFunds):
+			v.AddError("fund_id", "fund does not have enough money available for this order")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order, err := app.readOrder(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	v.Check(order.Status == models.OrderStatusOrdered, "status", fmt.Sprintf("order is already %s", order.Status))
+	v.Check(!order.IsInvoiced(), "status", "order has already been invoiced")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Orders.Cancel(order)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The receiveOrderHandler() checks in the copies of an order when they arrive. The
+// copies are added to the book given by book_id, which must have the order's ISBN if
+// it has one, or failing that to the book in the catalog with the order's ISBN. If
+// there's no such book, a new one is catalogued from the order, with the details in
+// "book" which the order doesn't have. Errors in the book and in each copy are
+// reported separately, as with CSV imports.
+func (app *application) receiveOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order, err := app.readOrder(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		BookID *uuid.UUID `json:"book_id"`
+		Book   struct {
+			Year        int32             `json:"year"`
+			Pages       models.Pages      `json:"pages"`
+			Genres      []string          `json:"genres"`
+			WorkID      uuid.UUID         `json:"work_id"`
+			PublisherID *uuid.UUID        `json:"publisher_id"`
+			Edition     string            `json:"edition"`
+			PublishedOn *models.CivilTime `json:"published_on"`
+			Format      string            `json:"format"`
+		} `json:"book"`
+		Copies []struct {
+			Barcode         string `json:"barcode"`
+			AccessionNumber string `json:"accession_number"`
+			ItemType        string `json:"item_type"`
+			ShelfMark       string `json:"shelf_mark"`
+		} `json:"copies"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(order.Status == models.OrderStatusOrdered, "status", fmt.Sprintf("order is already %s", order.Status))
+	v.Check(len(input.Copies) == int(order.Quantity), "copies", fmt.Sprintf("must list the %d copies ordered", order.Quantity))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var book *models.Book
+	switch {
+	case input.BookID != nil:
+		book, err = app.models.Books.Get(*input.BookID)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				v.AddError("book_id", "book does not exist")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if order.ISBN13 != "" && book.ISBN13 != order.ISBN13 {
+			v.AddError("book_id", fmt.Sprintf("must be the book with the ordered ISBN %s", order.ISBN13))
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	case order.ISBN13 != "":
+		book, err = app.models.Books.GetByISBN(order.ISBN13)
+		if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	errs := map[string]any{}
+
+	if book == nil {
+		book = &models.Book{
+			Title:       order.Title,
+			Author:      order.Author,
+			Year:        input.Book.Year,
+			Pages:       input.Book.Pages,
+			Genres:      input.Book.Genres,
+			ISBN13:      order.ISBN13,
+			WorkID:      input.Book.WorkID,
+			PublisherID: input.Book.PublisherID,
+			Edition:     input.Book.Edition,
+			PublishedOn: input.Book.PublishedOn,
+			Format:      input.Book.Format,
+		}
+
+		bv := validator.New()
+		err = app.checkBookReferences(bv, book)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		taxonomy, err := app.models.Genres.Taxonomy()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if models.ValidateBook(bv, book, taxonomy); !bv.Valid() {
+			errs["book"] = bv.Errors
+		}
+	}
+
+	copies := make([]*models.BookCopy, len(input.Copies))
+	barcodes := map[string]int{}
+	accessionNumbers := map[string]int{}
+	for i, in := range input.Copies {
+		bookCopy := &models.BookCopy{
+			Barcode:         in.Barcode,
+			AccessionNumber: in.AccessionNumber,
+			ItemType:        models.DefaultItemType,
+			ShelfMark:       strings.TrimSpace(in.ShelfMark),
+			HomeBranchID:    order.BranchID,
+			CurrentBranchID: order.BranchID,
+			Condition:       "new",
+			Status:          models.CopyStatusAvailable,
+		}
+		if in.ItemType != "" {
+			bookCopy.ItemType = in.ItemType
+		}
+
+		cv := validator.New()
+		models.ValidateBookCopy(cv, bookCopy)
+		if other, ok := barcodes[bookCopy.Barcode]; ok {
+			cv.AddError("barcode", fmt.Sprintf("is the same as copy %d", other))
+		}
+		if other, ok := accessionNumbers[bookCopy.AccessionNumber]; ok {
+			cv.AddError("accession_number", fmt.Sprintf("is the same as copy %d", other))
+		}
+		barcodes[bookCopy.Barcode] = i + 1
+		accessionNumbers[bookCopy.AccessionNumber] = i + 1
+
+		if !cv.Valid() {
+			errs[fmt.Sprintf("copy %d", i+1)] = cv.Errors
+		}
+		copies[i] = bookCopy
+	}
+
+	if len(errs) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, errs)
+		return
+	}
+
+	err = app.models.Orders.Receive(order, book, copies)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, models.ErrDuplicateISBN):
+			v.AddError("isbn", "a book with this ISBN has just been added")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrDuplicateBarcode):
+			v.AddError("barcode", "a copy with one of these barcodes already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, models.ErrDuplicateAccessionNumber):
+			v.AddError("accession_number", "a copy with one of these accession numbers already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The new copies may be able to satisfy waiting holds straight away.
+	app.allocateHolds(book.ID)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"order": order, "book": book, "copies": copies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The invoiceOrderHandler() records the vendor's invoice for an order, which can come
+// before or after the copies are received. The order's encumbrance is released and the
+// invoiced amount is charged to its fund.
+func (app *application) invoiceOrderHandler(w http.ResponseWriter, r *http.Request) {
+	order, err := app.readOrder(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		InvoiceNumber string `json:"invoice_number"`
+		Amount        *int64 `json:"amount"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	input.InvoiceNumber = strings.TrimSpace(input.InvoiceNumber)
+
+	v := validator.New()
+	v.Check(order.Status != models.OrderStatusCancelled, "status", "order is cancelled")
+	v.Check(!order.IsInvoiced(), "status", "order has already been invoiced")
+	v.Check(input.InvoiceNumber != "", "invoice_number", "must be provided")
+	v.Check(len(input.InvoiceNumber) <= 100, "invoice_number", "must not be more than 100 bytes long")
+	v.Check(input.Amount != nil, "amount", "must be provided")
+	v.Check(input.Amount == nil || *input.Amount >= 0, "amount", "must not be negative")
+	v.Check(input.Amount == nil || *input.Amount <= models.MaxAmount, "amount", fmt.Sprintf("must not be more than %d", int64(models.MaxAmount)))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	order.InvoiceNumber = input.InvoiceNumber
+	order.InvoicedAmount = input.Amount
+
+	err = app.models.Orders.Invoice(order)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The checkOrderReferences() helper adds a validation error for the branch or fund of
+// an order if it doesn't exist, and sets the order's currency to that of its fund.
+func (app *application) checkOrderReferences(v *validator.Validator, order *models.PurchaseOrder) error {
+	_, err := app.models.Branches.Get(order.BranchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("branch_id", "branch does not exist")
+		default:
+			return err
+		}
+	}
+	if order.FundID != nil {
+		fund, err := app.models.Funds.Get(*order.FundID)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				v.AddError("fund_id", "fund does not exist")
+			default:
+				return err
+			}
+		} else {
+			order.Currency = fund.Currency
+		}
+	}
+	return nil
+}
+
+// The readOrder() helper fetches the purchase order identified by the :id URL
+// parameter.
+func (app *application) readOrder(r *http.Request) (*models.PurchaseOrder, error) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		return nil, models.ErrRecordNotFound
+	}
+	return app.models.Orders.Get(id)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (app *application) listPatronTypesHandler(w http.ResponseWriter, r *http.Request) {
+	patronTypes, err := app.models.PatronTypes.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"patron_types": patronTypes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The savePatronTypeHandler() creates or replaces the patron type with the code in the
+// URL. Replacing a patron type needs the version it was read at, so that concurrent
+// changes aren't lost. Changes to the limits apply to every patron of the type
+// straight away, but loans which are already out keep their due dates.
+func (app *application) savePatronTypeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name           string `json:"name"`
+		MaxLoans       int    `json:"max_loans"`
+		LoanPeriodDays int    `json:"loan_period_days"`
+		MaxHolds       int    `json:"max_holds"`
+		MaxRenewals    int    `json:"max_renewals"`
+		FineCap        int64  `json:"fine_cap"`
+		Version        int32  `json:"version"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	patronType := &models.PatronType{
+		Code:           httprouter.ParamsFromContext(r.Context()).ByName("code"),
+		Name:           input.Name,
+		MaxLoans:       input.MaxLoans,
+		LoanPeriodDays: input.LoanPeriodDays,
+		MaxHolds:       input.MaxHolds,
+		MaxRenewals:    input.MaxRenewals,
+		FineCap:        input.FineCap,
+		Version:        input.Version,
+	}
+
+	v := validator.New()
+	if models.ValidatePatronType(v, patronType); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.PatronTypes.Save(patronType)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"patron_type": patronType}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deletePatronTypeHandler(w http.ResponseWriter, r *http.Request) {
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+
+	err := app.models.PatronTypes.Delete(code)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, models.ErrPatronTypeInUse):
+			v := validator.New()
+			v.AddError("code", "patron type is still assigned to users")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "patron type successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The updateUserPatronTypeHandler() moves a user to a different patron type. This is
+// kept apart from updateUserHandler() so that patrons can't change their own limits.
+func (app *application) updateUserPatronTypeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		PatronType string `json:"patron_type"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.PatronType != "", "patron_type", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.PatronTypes.Get(input.PatronType)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("patron_type", "patron type does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	user.PatronType = input.PatronType
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The seedDefaultPatronType() method applies the deprecated -loan-period and
+// -max-renewals flags, which predate patron types, to the default patron type. They are
+// only applied if they were given, and then on every startup.
+func (app *application) seedDefaultPatronType() error {
+	loanPeriod := app.config.circulation.loanPeriod
+	maxRenewals := app.config.circulation.maxRenewals
+	if loanPeriod == 0 && maxRenewals < 0 {
+		return nil
+	}
+
+	app.logger.PrintInfo("the -loan-period and -max-renewals flags are deprecated, set the limits of patron types instead", map[string]string{
+		"patron_type": models.DefaultPatronType,
+	})
+
+	patronType, err := app.models.PatronTypes.Get(models.DefaultPatronType)
+	if err != nil {
+		return err
+	}
+	if loanPeriod != 0 {
+		patronType.LoanPeriodDays = int(math.Ceil(loanPeriod.Hours() / 24))
+	}
+	if maxRenewals >= 0 {
+		patronType.MaxRenewals = maxRenewals
+	}
+
+	v := validator.New()
+	if models.ValidatePatronType(v, patronType); !v.Valid() {
+		return fmt.Errorf("invalid -loan-period or -max-renewals: %v", v.Errors)
+	}
+
+	return app.models.PatronTypes.Save(patronType)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	"github.com/julienschmidt/httprouter"
+	uuid "github.com/satori/go.uuid"
+)
+
+func (app *application) listPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	policies, err := app.models.Policies.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"policies": policies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The savePolicyHandler() creates or replaces the circulation policy for the patron
+// type and item type in the URL. Use "any" in place of either type for a policy which
+// applies to all of them.
+func (app *application) savePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Loanable       *bool `json:"loanable"`
+		LoanPeriodDays *int  `json:"loan_period_days"`
+		MaxRenewals    *int  `json:"max_renewals"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	params := httprouter.ParamsFromContext(r.Context())
+	policy := &models.CirculationPolicy{
+		PatronType:     params.ByName("patron_type"),
+		ItemType:       params.ByName("item_type"),
+		Loanable:       true,
+		LoanPeriodDays: input.LoanPeriodDays,
+		MaxRenewals:    input.MaxRenewals,
+	}
+	if input.Loanable != nil {
+		policy.Loanable = *input.Loanable
+	}
+
+	v := validator.New()
+	if models.ValidateCirculationPolicy(v, policy); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if policy.PatronType != models.AnyType {
+		_, err = app.models.PatronTypes.Get(policy.PatronType)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				v.AddError("patron_type", "patron type does not exist")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	err = app.models.Policies.Save(policy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"policy": policy}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deletePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	err := app.models.Policies.Delete(params.ByName("patron_type"), params.ByName("item_type"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "policy successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The resolvePolicyHandler() explains which circulation policy applies when the user
+// given by ?user= borrows the copy given by ?copy=, and the rules which follow from it.
+func (app *application) resolvePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	userID := app.readUUID(qs, "user", v)
+	copyID := app.readUUID(qs, "copy", v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	v.Check(userID != uuid.Nil, "user", "must be provided")
+	v.Check(copyID != uuid.Nil, "copy", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("user", "user does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	bookCopy, err := app.models.Copies.Get(copyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("copy", "copy does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	patronType, err := app.models.PatronTypes.Get(user.PatronType)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	policy, err := app.circulationPolicy(patronType, bookCopy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"policy": policy}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -20,17 +21,164 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodPatch, "/v1/users/:id", app.updateUserHandler)
 	router.HandlerFunc(http.MethodDelete, "/v1/users/:id", app.deleteUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/:id/loans", app.requireSelfOrPermission("loans:read", app.listUserLoansHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/:id/holds", app.requireSelfOrPermission("loans:read", app.listUserHoldsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/:id/fines", app.requireSelfOrPermission("fines:read", app.listUserFinesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/:id/fines/payments", app.requirePermission("fines:write", app.createFinePaymentHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/:id/patron-type", app.requirePermission("users:write", app.updateUserPatronTypeHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/patron-types", app.requirePermission("users:read", app.listPatronTypesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/patron-types/:code", app.requirePermission("users:write", app.savePatronTypeHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/patron-types/:code", app.requirePermission("users:write", app.deletePatronTypeHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/policies", app.requirePermission("loans:read", app.listPoliciesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/policies/resolve", app.requirePermission("loans:read", app.resolvePolicyHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/policies/:patron_type/:item_type", app.requirePermission("loans:write", app.savePolicyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/policies/:patron_type/:item_type", app.requirePermission("loans:write", app.deletePolicyHandler))
 
 	router.HandlerFunc(http.MethodPatch, "/v1/books/:id", app.requirePermission("books:write", app.updateBookHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/books/:id", app.requirePermission("books:read", app.showBookHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/books", app.requirePermission("books:read", app.listBooksHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/books", app.requirePermission("books:write", app.createBookHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/books/:id", app.requirePermission("books:write", app.deleteBookHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/imports/marc", app.requirePermission("books:write", app.importMARCHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/citations", app.requirePermission("books:read", app.listCitationsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/authors", app.requirePermission("books:read", app.listAuthorsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/authors", app.requirePermission("books:write", app.createAuthorHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/authors/:id", app.requirePermission("books:read", app.showAuthorHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/authors/:id", app.requirePermission("books:write", app.updateAuthorHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/authors/:id", app.requirePermission("books:write", app.deleteAuthorHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/authors/:id/books", app.requirePermission("books:read", app.listAuthorBooksHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.requirePermission("books:read", app.listGenresHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/genres", app.requirePermission("books:write", app.createGenreHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/genres/:id", app.requirePermission("books:read", app.showGenreHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/genres/:id", app.requirePermission("books:write", app.updateGenreHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/genres/:id", app.requirePermission("books:write", app.deleteGenreHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/genres/:id/merge", app.requirePermission("books:write", app.mergeGenreHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/works/:id", app.requirePermission("books:read", app.showWorkHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/works/:id", app.requirePermission("books:write", app.updateWorkHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/publishers", app.requirePermission("books:read", app.listPublishersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/publishers", app.requirePermission("books:write", app.createPublisherHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/publishers/:id", app.requirePermission("books:read", app.showPublisherHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/publishers/:id", app.requirePermission("books:write", app.updatePublisherHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/publishers/:id", app.requirePermission("books:write", app.deletePublisherHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/branches", app.requirePermission("books:read", app.listBranchesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/branches", app.requirePermission("books:write", app.createBranchHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/branches/:id", app.requirePermission("books:read", app.showBranchHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/branches/:id", app.requirePermission("books:write", app.updateBranchHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/branches/:id", app.requirePermission("books:write", app.deleteBranchHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/copies", app.requirePermission("books:read", app.listBookCopiesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:id/copies", app.requirePermission("books:write", app.createBookCopyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/copies/:copy_id", app.requirePermission("books:read", app.showBookCopyHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/books/:id/copies/:copy_id", app.requirePermission("books:write", app.updateBookCopyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/books/:id/copies/:copy_id", app.requirePermission("books:write", app.deleteBookCopyHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/cite", app.requirePermission("books:read", app.showBookCitationHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/digital-resources", app.requirePermission("books:read", app.listDigitalResourcesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:id/digital-resources", app.requirePermission("books:write", app.createDigitalResourceHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/books/:id/digital-resources/:resource_id", app.requirePermission("books:write", app.deleteDigitalResourceHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/holds", app.requirePermission("loans:read", app.listBookHoldsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:id/holds", app.requirePermission("books:read", app.createHoldHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/holds/:id", app.requireActivatedUser(app.cancelHoldHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/reviews", app.requirePermission("books:read", app.listBookReviewsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:id/reviews", app.requirePermission("books:read", app.createReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/reviews/:review_id", app.requirePermission("books:read", app.showReviewHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/books/:id/reviews/:review_id", app.requirePermission("books:read", app.updateReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/books/:id/reviews/:review_id", app.requirePermission("books:read", app.deleteReviewHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/transfers", app.requirePermission("loans:read", app.listTransfersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/transfers", app.requirePermission("loans:write", app.createTransferHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/transfers/scan", app.requirePermission("loans:write", app.scanTransferHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/transfers/:id", app.requirePermission("loans:read", app.showTransferHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/transfers/:id/ship", app.requirePermission("loans:write", app.shipTransferHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/transfers/:id/receive", app.requirePermission("loans:write", app.receiveTransferHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/transfers/:id/cancel", app.requirePermission("loans:write", app.cancelTransferHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/audits", app.requirePermission("books:read", app.listAuditsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/audits", app.requirePermission("books:write", app.createAuditHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/audits/:id", app.requirePermission("books:read", app.showAuditHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/audits/:id/scans", app.requirePermission("books:write", app.createAuditScansHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/audits/:id/report", app.requirePermission("books:read", app.showAuditReportHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/audits/:id/close", app.requirePermission("books:write", app.closeAuditHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/audits/:id/mark-lost", app.requirePermission("books:write", app.markAuditLostHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/suggestions", app.requireActivatedUser(app.listSuggestionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/suggestions", app.requireActivatedUser(app.createSuggestionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/suggestions/:id", app.requireActivatedUser(app.showSuggestionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/suggestions/:id/vote", app.requireActivatedUser(app.voteSuggestionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/suggestions/:id/vote", app.requireActivatedUser(app.unvoteSuggestionHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/suggestions/:id/review", app.requirePermission("acquisitions:write", app.reviewSuggestionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/orders", app.requirePermission("acquisitions:read", app.listOrdersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/orders", app.requirePermission("acquisitions:write", app.createOrderHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/orders/:id", app.requirePermission("acquisitions:read", app.showOrderHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/orders/:id", app.requirePermission("acquisitions:write", app.updateOrderHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/orders/:id/cancel", app.requirePermission("acquisitions:write", app.cancelOrderHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/orders/:id/receive", app.requirePermission("acquisitions:write", app.receiveOrderHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/orders/:id/invoice", app.requirePermission("acquisitions:write", app.invoiceOrderHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/funds", app.requirePermission("acquisitions:read", app.listFundsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/funds", app.requirePermission("acquisitions:write", app.createFundHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/funds/:id", app.requirePermission("acquisitions:read", app.showFundHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/funds/:id", app.requirePermission("acquisitions:write", app.updateFundHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/funds/:id/allocations", app.requirePermission("acquisitions:read", app.listFundAllocationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/funds/:id/allocations", app.requirePermission("acquisitions:write", app.createFundAllocationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/funds/:id/transactions", app.requirePermission("acquisitions:read", app.listFundTransactionsHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/loans", app.requirePermission("loans:write", app.createLoanHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/loans/:id", app.requirePermission("loans:read", app.showLoanHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/loans/:id/return", app.requirePermission("loans:write", app.returnLoanHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/loans/:id/renew", app.requireActivatedUser(app.renewLoanHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/fines/:id/waive", app.requirePermission("fines:write", app.waiveFineHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/fine-rules", app.requirePermission("fines:read", app.listFineRulesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/fine-rules/:item_type", app.requirePermission("fines:write", app.saveFineRuleHandler))
+
+	router.HandlerFunc(http.MethodGet, "/opds/:version", app.requirePermission("books:read", app.opdsRootHandler))
+	router.HandlerFunc(http.MethodGet, "/opds/:version/books", app.requirePermission("books:read", app.opdsBooksHandler))
+	router.HandlerFunc(http.MethodGet, "/opds/:version/genres", app.requirePermission("books:read", app.opdsGenresHandler))
+	router.HandlerFunc(http.MethodGet, "/opds/:version/authors", app.requirePermission("books:read", app.opdsAuthorsHandler))
+	router.HandlerFunc(http.MethodGet, "/opds/:version/search", app.requirePermission("books:read", app.opdsSearchHandler))
+
+	router.HandlerFunc(http.MethodGet, "/oai", app.oaiHandler)
+	router.HandlerFunc(http.MethodPost, "/oai", app.oaiHandler)
+	router.HandlerFunc(http.MethodGet, "/sru", app.sruHandler)
 
 	router.HandlerFunc(http.MethodGet, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 
+	// httprouter doesn't allow a static path segment in the same position as the :id
+	// wildcard, so ISBN lookups, imports, exports and the fund report are dispatched
+	// before the request reaches the router.
+	showBookByISBN := app.requirePermission("books:read", app.showBookByISBNHandler)
+	exportBooks := app.requirePermission("books:read", app.exportBooksHandler)
+	importBooks := app.requirePermission("books:write", app.importBooksCSVHandler)
+	showFundReport := app.requirePermission("acquisitions:read", app.showFundReportHandler)
+	mux := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/books/isbn/"):
+			showBookByISBN(w, r)
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/books/export":
+			exportBooks(w, r)
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/books/import":
+			importBooks(w, r)
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/funds/report":
+			showFundReport(w, r)
+		default:
+			router.ServeHTTP(w, r)
+		}
+	})
+
 	// Wrap the router with the panic recovery middleware.
-	return app.recoverPanic(app.rateLimit(app.authenticate(router)))
+	return app.recoverPanic(app.rateLimit(app.authenticate(mux)))
 }
 
 func (app *application) routesTest() http.Handler {
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/Danik14/library/internal/cql"
+	"github.com/Danik14/library/internal/sru"
+)
+
+// The sruHandler() answers SRU explain and searchRetrieve requests. As with OAI-PMH,
+// problems with the request are reported as diagnostics in a 200 OK response, and the
+// endpoint is public so that other library systems can search the catalog. The server
+// is described with the repository name and contact given for OAI-PMH.
+func (app *application) sruHandler(w http.ResponseWriter, r *http.Request) {
+	req, diag := sru.ParseRequest(r.URL.Query())
+
+	var resp any
+	switch req.Operation {
+	case sru.OperationExplain:
+		resp = sru.NewExplainResponse(app.sruExplain(r), sruDiagnostics(diag)...)
+	default:
+		search := &sru.SearchRetrieveResponse{Version: sru.Version}
+		if diag == nil {
+			var err error
+			diag, err = app.sruSearch(search, req)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		search.Diagnostics = sru.NewDiagnostics(sruDiagnostics(diag)...)
+		resp = search
+	}
+
+	var buf bytes.Buffer
+	err := sru.Write(&buf, resp)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// The sruSearch() helper runs the query of a searchRetrieve request, filling in the
+// response with the page of records the client asked for.
+func (app *application) sruSearch(resp *sru.SearchRetrieveResponse, req *sru.Request) (*sru.Diagnostic, error) {
+	query, err := cql.Parse(req.Query)
+	if err != nil {
+		return sru.QueryDiagnostic(err), nil
+	}
+
+	books, total, err := app.models.Books.Search(query, req.MaximumRecords, req.StartRecord-1)
+	if err != nil {
+		if diag := sru.QueryDiagnostic(err); diag != nil {
+			return diag, nil
+		}
+		return nil, err
+	}
+
+	resp.NumberOfRecords = total
+	if req.StartRecord > 1 && req.StartRecord > total {
+		return sru.NewDiagnostic(sru.DiagFirstRecordOutOfRange, strconv.Itoa(req.StartRecord), "there are fewer records than that"), nil
+	}
+	if len(books) > 0 {
+		resp.Records = &sru.Records{}
+		for i, book := range books {
+			resp.Records.Records = append(resp.Records.Records, sru.NewRecord(book, req.RecordSchema, req.StartRecord+i))
+		}
+	}
+	if next := req.StartRecord + len(books); len(books) > 0 && next <= total {
+		resp.NextRecordPosition = next
+	}
+	return nil, nil
+}
+
+// The sruExplain() helper describes the server as the client reached it.
+func (app *application) sruExplain(r *http.Request) *sru.Explain {
+	host, port := r.Host, 80
+	if r.TLS != nil {
+		port = 443
+	}
+	if h, p, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+		if n, err := strconv.Atoi(p); err == nil {
+			port = n
+		}
+	}
+	return sru.NewExplain(host, port, "sru", app.config.oai.repositoryName, app.config.oai.adminEmail)
+}
+
+// The sruDiagnostics() helper returns a diagnostic as a list, which is empty if it is nil.
+func sruDiagnostics(diag *sru.Diagnostic) []*sru.Diagnostic {
+	if diag == nil {
+		return nil
+	}
+	return []*sru.Diagnostic{diag}
+}
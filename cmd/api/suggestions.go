@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+)
+
+func (app *application) listSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-votes")
+	input.Filters.SortSafelist = []string{"created_at", "votes", "title", "-created_at", "-votes", "-title"}
+
+	if input.Status != "" {
+		v.Check(validator.PermittedValue(input.Status, models.SuggestionStatuses...), "status", "invalid status value")
+	}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, metadata, err := app.models.Suggestions.GetAll(input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createSuggestionHandler() lets a patron ask for a book to be bought. Books the
+// library already has, or which someone has already suggested, are refused so that
+// patrons place holds or vote instead.
+func (app *application) createSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title  string `json:"title"`
+		Author string `json:"author"`
+		ISBN   string `json:"isbn"`
+		Note   string `json:"note"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	suggestion := &models.Suggestion{
+		SuggestedBy: &user.ID,
+		Title:       strings.TrimSpace(input.Title),
+		Author:      strings.TrimSpace(input.Author),
+		ISBN13:      input.ISBN,
+		Note:        strings.TrimSpace(input.Note),
+	}
+
+	v := validator.New()
+	if models.ValidateSuggestion(v, suggestion); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if suggestion.ISBN13 != "" {
+		_, err = app.models.Books.GetByISBN(suggestion.ISBN13)
+		switch {
+		case err == nil:
+			v.AddError("isbn", "the library already has this book")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		case !errors.Is(err, models.ErrRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.models.Suggestions.Insert(suggestion)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateSuggestion):
+			v.AddError("isbn", "this book has already been suggested")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/suggestions/%s", suggestion.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"suggestion": suggestion}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	suggestion, err := app.readSuggestion(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestion": suggestion}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) voteSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	suggestion, err := app.readSuggestion(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	if v.Check(suggestion.IsOpen(), "status", fmt.Sprintf("suggestion is %s", suggestion.Status)); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	err = app.models.Suggestions.Vote(suggestion, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestion": suggestion}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unvoteSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	suggestion, err := app.readSuggestion(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	err = app.models.Suggestions.Unvote(suggestion, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestion": suggestion}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The reviewSuggestionHandler() lets staff accept or reject a suggestion, optionally
+// with a note for the patron. Accepted suggestions can be reviewed again until they
+// are ordered.
+func (app *application) reviewSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	suggestion, err := app.readSuggestion(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(suggestion.IsOpen(), "status", fmt.Sprintf("suggestion is already %s", suggestion.Status))
+	v.Check(validator.PermittedValue(input.Status, models.SuggestionStatusAccepted, models.SuggestionStatusRejected), "status", "must be accepted or rejected")
+	v.Check(len(input.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	suggestion.Status = input.Status
+	suggestion.ReviewNote = strings.TrimSpace(input.Note)
+	suggestion.ReviewedBy = &user.ID
+
+	err = app.models.Suggestions.Review(suggestion)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestion": suggestion}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readSuggestion() helper fetches the suggestion identified by the :id URL
+// parameter.
+func (app *application) readSuggestion(r *http.Request) (*models.Suggestion, error) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		return nil, models.ErrRecordNotFound
+	}
+	return app.models.Suggestions.Get(id)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+func (app *application) listTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Branch uuid.UUID
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Branch = app.readUUID(qs, "branch", v)
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "created_at")
+	input.Filters.SortSafelist = []string{"created_at", "shipped_at", "received_at", "-created_at", "-shipped_at", "-received_at"}
+
+	if input.Status != "" {
+		v.Check(validator.PermittedValue(input.Status, models.TransferStatuses...), "status", "invalid status value")
+	}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	transfers, metadata, err := app.models.Transfers.GetAll(input.Branch, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"transfers": transfers, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createTransferHandler() lets staff send an available copy to another branch,
+// e.g. to rebalance stock between branches.
+func (app *application) createTransferHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		CopyID     uuid.UUID `json:"copy_id"`
+		ToBranchID uuid.UUID `json:"to_branch_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.CopyID != uuid.Nil, "copy_id", "must be provided")
+	v.Check(input.ToBranchID != uuid.Nil, "to_branch_id", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	bookCopy, err := app.models.Copies.Get(input.CopyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("copy_id", "copy does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	_, err = app.models.Branches.Get(input.ToBranchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("to_branch_id", "branch does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if v.Check(bookCopy.CurrentBranchID != input.ToBranchID, "to_branch_id", "copy is already at this branch"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	transfer := &models.Transfer{
+		CopyID:      bookCopy.ID,
+		ToBranchID:  input.ToBranchID,
+		RequestedBy: &user.ID,
+	}
+
+	err = app.models.Transfers.Insert(transfer)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrCopyUnavailable):
+			v.AddError("copy_id", "copy is not available for transfer")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/transfers/%s", transfer.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"transfer": transfer}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showTransferHandler(w http.ResponseWriter, r *http.Request) {
+	transfer, err := app.readTransfer(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"transfer": transfer}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) shipTransferHandler(w http.ResponseWriter, r *http.Request) {
+	transfer, err := app.readTransfer(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.advanceTransfer(w, r, transfer, models.TransferStatusRequested)
+}
+
+func (app *application) receiveTransferHandler(w http.ResponseWriter, r *http.Request) {
+	transfer, err := app.readTransfer(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.advanceTransfer(w, r, transfer, models.TransferStatusInTransit)
+}
+
+// The scanTransferHandler() is used by the barcode scanners at the circulation desk.
+// Scanning a copy which has been requested for transfer ships it, and scanning a copy
+// which is in transit receives it, so staff don't need to look up the transfer.
+func (app *application) scanTransferHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Barcode string `json:"barcode"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Barcode != "", "barcode", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	bookCopy, err := app.models.Copies.GetByBarcode(input.Barcode)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("barcode", "no copy has this barcode")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	transfer, err := app.models.Transfers.GetActiveForCopy(bookCopy.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			v.AddError("barcode", "copy is not being transferred")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.advanceTransfer(w, r, transfer, transfer.Status)
+}
+
+// The advanceTransfer() helper moves a transfer on from the given status to the next
+// one in its lifecycle and sends the updated transfer to the client.
+func (app *application) advanceTransfer(w http.ResponseWriter, r *http.Request, transfer *models.Transfer, from string) {
+	v := validator.New()
+	var err error
+
+	switch {
+	case from == models.TransferStatusRequested && transfer.Status == from:
+		err = app.models.Transfers.Ship(transfer)
+	case from == models.TransferStatusInTransit && transfer.Status == from:
+		expiresAt := models.DueDate(time.Now(), app.config.circulation.holdPickupPeriod)
+		err = app.models.Transfers.Receive(transfer, expiresAt)
+	default:
+		v.AddError("status", fmt.Sprintf("transfer is %s", transfer.Status))
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// A copy which arrived without a hold waiting for it is back in circulation at
+	// its new branch.
+	if transfer.Status == models.TransferStatusReceived {
+		app.allocateHolds(transfer.BookID)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"transfer": transfer}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancelTransferHandler(w http.ResponseWriter, r *http.Request) {
+	transfer, err := app.readTransfer(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	if v.Check(transfer.Status == models.TransferStatusRequested, "status", "only transfers which haven't been shipped can be cancelled"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Transfers.Cancel(transfer)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The copy is back on the shelf where it was, and a hold it was being sent for is
+	// waiting again for a different copy.
+	app.allocateHolds(transfer.BookID)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"transfer": transfer}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readTransfer() helper fetches the transfer identified by the :id URL parameter.
+func (app *application) readTransfer(r *http.Request) (*models.Transfer, error) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		return nil, models.ErrRecordNotFound
+	}
+	return app.models.Transfers.Get(id)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+// The showWorkHandler() returns a work along with all of its editions.
+func (app *application) showWorkHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	work, err := app.models.Works.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	editions, err := app.models.Works.GetEditions(work.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"work": work, "editions": editions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateWorkHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readUUIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	work, err := app.models.Works.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Title *string `json:"title"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Title != nil {
+		work.Title = *input.Title
+	}
+
+	v := validator.New()
+	if models.ValidateWork(v, work); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Works.Update(work)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"work": work}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The checkBookReferences() helper adds a validation error if the work or publisher
+// that a book refers to doesn't exist. Only unexpected database errors are returned.
+func (app *application) checkBookReferences(v *validator.Validator, book *models.Book) error {
+	if book.WorkID != uuid.Nil {
+		_, err := app.models.Works.Get(book.WorkID)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				v.AddError("work_id", "work does not exist")
+			default:
+				return err
+			}
+		}
+	}
+	if book.PublisherID != nil {
+		_, err := app.models.Publishers.Get(*book.PublisherID)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRecordNotFound):
+				v.AddError("publisher_id", "publisher does not exist")
+			default:
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The siblingEditions() helper returns the editions of a book's work, other than the
+// book itself.
+func (app *application) siblingEditions(book *models.Book) ([]*models.Edition, error) {
+	editions, err := app.models.Works.GetEditions(book.WorkID)
+	if err != nil {
+		return nil, err
+	}
+	siblings := []*models.Edition{}
+	for _, edition := range editions {
+		if edition.ID != book.ID {
+			siblings = append(siblings, edition)
+		}
+	}
+	return siblings, nil
+}
@@ -0,0 +1,136 @@
+// Command marcimport adds the books described by files of MARC records to the
+// catalog, in the same way as the POST /v1/imports/marc endpoint.
+//
+// Usage:
+//
+//	marcimport [-dry-run] [-db-dsn dsn] file...
+//
+// Each file may be ISO 2709 or MARCXML; use "-" to read from standard input. The
+// database DSN defaults to the DB_DSN environment variable, which can also be set in a
+// .env file. The command exits with status 1 if any record couldn't be imported.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Danik14/library/internal/marc"
+	"github.com/Danik14/library/internal/models"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	// A missing .env file is fine, the DSN can come from the environment or a flag.
+	_ = godotenv.Load()
+
+	dsn := flag.String("db-dsn", os.Getenv("DB_DSN"), "PostgreSQL DSN")
+	dryRun := flag.Bool("dry-run", false, "Check the records without importing them")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := openDB(*dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	failed := 0
+	for _, name := range flag.Args() {
+		n, err := importFile(models.NewModels(db), name, *dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			os.Exit(1)
+		}
+		failed += n
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// importFile imports the records in one file, printing the outcome of each record, and
+// returns how many of them failed.
+func importFile(m models.Models, name string, dryRun bool) (int, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	records, err := marc.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	results, err := marc.Import(m, records, dryRun)
+	if err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for _, result := range results {
+		label := fmt.Sprintf("%s: record %d", name, result.Record)
+		if result.ControlNumber != "" {
+			label += fmt.Sprintf(" (%s)", result.ControlNumber)
+		}
+
+		if result.Errors != nil {
+			failed++
+			keys := make([]string, 0, len(result.Errors))
+			for key := range result.Errors {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Printf("%s: %s %s\n", label, key, result.Errors[key])
+			}
+			continue
+		}
+
+		switch {
+		case dryRun:
+			fmt.Printf("%s: ok %q\n", label, result.Book.Title)
+		default:
+			fmt.Printf("%s: imported %q as %s\n", label, result.Book.Title, result.Book.ID)
+		}
+	}
+
+	fmt.Printf("%s: %d records, %d failed\n", name, len(results), failed)
+	return failed, nil
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,477 @@
+// Package cite formats citations for books in the reference manager formats BibTeX,
+// RIS and CSL-JSON, and as plain text in the APA and MLA styles.
+package cite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Danik14/library/internal/models"
+)
+
+// Define constants for the citation formats.
+const (
+	FormatBibTeX  = "bibtex"
+	FormatRIS     = "ris"
+	FormatCSLJSON = "csl-json"
+	FormatAPA     = "apa"
+	FormatMLA     = "mla"
+)
+
+var Formats = []string{FormatBibTeX, FormatRIS, FormatCSLJSON, FormatAPA, FormatMLA}
+
+// ContentType returns the media type of citations in the given format.
+func ContentType(format string) string {
+	switch format {
+	case FormatBibTeX:
+		return "application/x-bibtex; charset=utf-8"
+	case FormatRIS:
+		return "application/x-research-info-systems; charset=utf-8"
+	case FormatCSLJSON:
+		return "application/vnd.citationstyles.csl+json"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Name is a person's name, split into the parts that citation styles need.
+type Name struct {
+	Family string `json:"family"`
+	Given  string `json:"given,omitempty"`
+}
+
+// ParseName splits a name into family and given names. Names written surname first,
+// e.g. "Tolkien, J. R. R.", are split at the comma. Otherwise the last word is taken to
+// be the family name.
+func ParseName(name string) Name {
+	name = strings.TrimSpace(name)
+	if family, given, ok := strings.Cut(name, ", "); ok {
+		return Name{Family: strings.TrimSpace(family), Given: strings.TrimSpace(given)}
+	}
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return Name{Family: name}
+	}
+	return Name{Family: name[i+1:], Given: strings.TrimSpace(name[:i])}
+}
+
+// Item holds the details of a book which citations are made from.
+type Item struct {
+	ID          string
+	Title       string
+	Authors     []Name
+	Editors     []Name
+	Translators []Name
+	Publisher   string
+	Year        int
+	Edition     string
+	ISBN        string
+	Pages       int
+}
+
+// authorSeparatorRX matches the separators between the names in a book's author field.
+// Commas aren't among them, as they also separate a family name from the given names,
+// as in "Tolkien, J. R. R.".
+var authorSeparatorRX = regexp.MustCompile(`\s*(?:;|&|\sand\s)\s*`)
+
+// FromBook collects the details of a book for citing it. The people credited on the
+// book are used if they are known; otherwise the authors are taken from the display
+// form of the author, in which names are separated by semicolons, ampersands or "and".
+func FromBook(book *models.Book) *Item {
+	item := &Item{
+		ID:        book.ID.String(),
+		Title:     book.Title,
+		Publisher: book.Publisher,
+		Year:      int(book.Year),
+		Edition:   book.Edition,
+		ISBN:      book.ISBN13,
+		Pages:     int(book.Pages),
+	}
+	if item.ISBN == "" {
+		item.ISBN = book.ISBN10
+	}
+
+	for _, credit := range book.Authors {
+		name := ParseName(credit.Name)
+		switch credit.Role {
+		case models.AuthorRoleAuthor:
+			item.Authors = append(item.Authors, name)
+		case models.AuthorRoleEditor:
+			item.Editors = append(item.Editors, name)
+		case models.AuthorRoleTranslator:
+			item.Translators = append(item.Translators, name)
+		}
+	}
+	if len(item.Authors) == 0 && len(item.Editors) == 0 && book.Author != "" {
+		for _, name := range authorSeparatorRX.Split(book.Author, -1) {
+			if name = strings.TrimSpace(name); name != "" {
+				item.Authors = append(item.Authors, ParseName(name))
+			}
+		}
+	}
+
+	return item
+}
+
+// Write writes citations for the items in the given format. BibTeX and RIS entries,
+// and APA and MLA citations, are separated by blank lines; CSL-JSON is always written
+// as an array.
+func Write(w io.Writer, format string, items []*Item) error {
+	var buf bytes.Buffer
+	switch format {
+	case FormatBibTeX:
+		keys := map[string]int{}
+		for i, item := range items {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			writeBibTeX(&buf, item, keys)
+		}
+	case FormatRIS:
+		for i, item := range items {
+			if i > 0 {
+				buf.WriteString("\r\n")
+			}
+			writeRIS(&buf, item)
+		}
+	case FormatCSLJSON:
+		entries := make([]map[string]any, 0, len(items))
+		for _, item := range items {
+			entries = append(entries, cslJSON(item))
+		}
+		js, err := json.MarshalIndent(entries, "", "\t")
+		if err != nil {
+			return err
+		}
+		buf.Write(js)
+		buf.WriteString("\n")
+	case FormatAPA, FormatMLA:
+		for i, item := range items {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			if format == FormatAPA {
+				buf.WriteString(APA(item))
+			} else {
+				buf.WriteString(MLA(item))
+			}
+			buf.WriteString("\n")
+		}
+	default:
+		return fmt.Errorf("cite: unknown format %q", format)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// bibtexKeySuffix returns the letters added to the nth duplicate BibTeX key, counting
+// from 0: a to z, then aa, ab and so on.
+func bibtexKeySuffix(n int) string {
+	suffix := ""
+	for n++; n > 0; n /= 26 {
+		n--
+		suffix = string(rune('a'+n%26)) + suffix
+	}
+	return suffix
+}
+
+func writeBibTeX(buf *bytes.Buffer, item *Item, keys map[string]int) {
+	// The key is the first author's family name and the year, with letters added to
+	// tell apart books which would otherwise get the same key.
+	key := "book"
+	if len(item.Authors) > 0 {
+		key = asciiLower(item.Authors[0].Family)
+	} else if len(item.Editors) > 0 {
+		key = asciiLower(item.Editors[0].Family)
+	}
+	if item.Year > 0 {
+		key += strconv.Itoa(item.Year)
+	}
+	if n := keys[key]; n > 0 {
+		keys[key]++
+		key += bibtexKeySuffix(n - 1)
+	} else {
+		keys[key] = 1
+	}
+
+	fmt.Fprintf(buf, "@book{%s,\n", key)
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(buf, "  %s = {%s},\n", name, bibtexEscape(value))
+		}
+	}
+	field("author", bibtexNames(item.Authors))
+	field("editor", bibtexNames(item.Editors))
+	field("title", item.Title)
+	field("edition", item.Edition)
+	field("publisher", item.Publisher)
+	if item.Year > 0 {
+		field("year", strconv.Itoa(item.Year))
+	}
+	field("isbn", item.ISBN)
+	if item.Pages > 0 {
+		field("pagetotal", strconv.Itoa(item.Pages))
+	}
+	buf.WriteString("}\n")
+}
+
+func bibtexNames(names []Name) string {
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		if name.Given == "" {
+			parts = append(parts, name.Family)
+			continue
+		}
+		parts = append(parts, name.Family+", "+name.Given)
+	}
+	return strings.Join(parts, " and ")
+}
+
+var bibtexReplacer = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	"{", `\{`,
+	"}", `\}`,
+	"&", `\&`,
+	"%", `\%`,
+	"$", `\$`,
+	"#", `\#`,
+	"_", `\_`,
+	"~", `\textasciitilde{}`,
+	"^", `\textasciicircum{}`,
+)
+
+func bibtexEscape(s string) string {
+	return bibtexReplacer.Replace(s)
+}
+
+func asciiLower(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "book"
+	}
+	return b.String()
+}
+
+func writeRIS(buf *bytes.Buffer, item *Item) {
+	tag := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(buf, "%s  - %s\r\n", name, value)
+		}
+	}
+	tag("TY", "BOOK")
+	for _, name := range item.Authors {
+		tag("AU", bibtexNames([]Name{name}))
+	}
+	for _, name := range item.Editors {
+		tag("A3", bibtexNames([]Name{name}))
+	}
+	for _, name := range item.Translators {
+		tag("A4", bibtexNames([]Name{name}))
+	}
+	tag("TI", item.Title)
+	tag("ET", item.Edition)
+	tag("PB", item.Publisher)
+	if item.Year > 0 {
+		tag("PY", strconv.Itoa(item.Year))
+	}
+	tag("SN", item.ISBN)
+	if item.Pages > 0 {
+		tag("SP", strconv.Itoa(item.Pages))
+	}
+	tag("ID", item.ID)
+	buf.WriteString("ER  - \r\n")
+}
+
+func cslJSON(item *Item) map[string]any {
+	entry := map[string]any{
+		"id":    item.ID,
+		"type":  "book",
+		"title": item.Title,
+	}
+	if len(item.Authors) > 0 {
+		entry["author"] = item.Authors
+	}
+	if len(item.Editors) > 0 {
+		entry["editor"] = item.Editors
+	}
+	if len(item.Translators) > 0 {
+		entry["translator"] = item.Translators
+	}
+	if item.Publisher != "" {
+		entry["publisher"] = item.Publisher
+	}
+	if item.Year > 0 {
+		entry["issued"] = map[string]any{"date-parts": [][]int{{item.Year}}}
+	}
+	if item.Edition != "" {
+		entry["edition"] = item.Edition
+	}
+	if item.ISBN != "" {
+		entry["ISBN"] = item.ISBN
+	}
+	if item.Pages > 0 {
+		entry["number-of-pages"] = strconv.Itoa(item.Pages)
+	}
+	return entry
+}
+
+// APA formats a citation in the style of the 7th edition of the APA Publication
+// Manual, e.g. "Tolkien, J. R. R. (1937). The hobbit. Allen & Unwin." Books without
+// authors are cited by their editors.
+func APA(item *Item) string {
+	var b strings.Builder
+
+	names, editors := item.Authors, false
+	if len(names) == 0 {
+		names, editors = item.Editors, true
+	}
+	if len(names) > 0 {
+		parts := make([]string, 0, len(names))
+		for _, name := range names {
+			part := name.Family
+			if name.Given != "" {
+				part += ", " + initials(name.Given)
+			}
+			parts = append(parts, part)
+		}
+		b.WriteString(joinNames(parts, ", & ", ", & "))
+		if editors {
+			if len(names) == 1 {
+				b.WriteString(" (Ed.)")
+			} else {
+				b.WriteString(" (Eds.)")
+			}
+		}
+		b.WriteString(" ")
+	}
+
+	if item.Year > 0 {
+		fmt.Fprintf(&b, "(%d). ", item.Year)
+	} else {
+		b.WriteString("(n.d.). ")
+	}
+
+	b.WriteString(item.Title)
+	if item.Edition != "" {
+		fmt.Fprintf(&b, " (%s)", abbreviateEdition(item.Edition))
+	}
+	b.WriteString(".")
+
+	if item.Publisher != "" {
+		b.WriteString(" " + endSentence(item.Publisher))
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// MLA formats a citation in the style of the 9th edition of the MLA Handbook, e.g.
+// "Tolkien, J. R. R. The Hobbit. Allen & Unwin, 1937." Three or more authors are
+// shortened to the first followed by "et al."
+func MLA(item *Item) string {
+	var b strings.Builder
+
+	names := item.Authors
+	switch len(names) {
+	case 0:
+	case 1:
+		b.WriteString(endSentence(invertedName(names[0])) + " ")
+	case 2:
+		b.WriteString(endSentence(invertedName(names[0])+", and "+displayName(names[1])) + " ")
+	default:
+		b.WriteString(invertedName(names[0]) + ", et al. ")
+	}
+
+	b.WriteString(endSentence(item.Title))
+
+	var publication []string
+	if item.Edition != "" {
+		publication = append(publication, abbreviateEdition(item.Edition))
+	}
+	if item.Publisher != "" {
+		publication = append(publication, item.Publisher)
+	}
+	if item.Year > 0 {
+		publication = append(publication, strconv.Itoa(item.Year))
+	}
+	if len(publication) > 0 {
+		b.WriteString(" " + endSentence(strings.Join(publication, ", ")))
+	}
+
+	return b.String()
+}
+
+// initials shortens given names to their initials, keeping the hyphen in hyphenated
+// names, e.g. "Jean-Paul" becomes "J.-P.".
+func initials(given string) string {
+	var words []string
+	for _, word := range strings.Fields(given) {
+		var parts []string
+		for _, part := range strings.Split(word, "-") {
+			r := []rune(strings.TrimSuffix(part, "."))
+			if len(r) > 0 {
+				parts = append(parts, string(r[0])+".")
+			}
+		}
+		words = append(words, strings.Join(parts, "-"))
+	}
+	return strings.Join(words, " ")
+}
+
+func invertedName(name Name) string {
+	if name.Given == "" {
+		return name.Family
+	}
+	return name.Family + ", " + name.Given
+}
+
+func displayName(name Name) string {
+	return strings.TrimSpace(name.Given + " " + name.Family)
+}
+
+// joinNames joins names with commas, using last before the final name, or pair when
+// there are only two names.
+func joinNames(names []string, last, pair string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	case 2:
+		return names[0] + pair + names[1]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + last + names[len(names)-1]
+}
+
+// abbreviateEdition shortens the word edition, e.g. "2nd edition" becomes "2nd ed.".
+func abbreviateEdition(edition string) string {
+	edition = strings.TrimSpace(edition)
+	lower := strings.ToLower(edition)
+	switch {
+	case strings.HasSuffix(lower, " edition"):
+		return edition[:len(edition)-len("edition")] + "ed."
+	case strings.HasSuffix(lower, " ed"):
+		return edition + "."
+	}
+	return edition
+}
+
+// endSentence adds a full stop unless s already ends with punctuation.
+func endSentence(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.ContainsAny(s[len(s)-1:], ".?!") {
+		return s
+	}
+	return s + "."
+}
@@ -0,0 +1,221 @@
+package cite
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Danik14/library/internal/assert"
+	"github.com/Danik14/library/internal/models"
+)
+
+var hobbit = &Item{
+	ID:        "7b2d4c1e-0000-4000-8000-000000000001",
+	Title:     "The Hobbit",
+	Authors:   []Name{{Family: "Tolkien", Given: "J. R. R."}},
+	Publisher: "Allen & Unwin",
+	Year:      1937,
+	Edition:   "4th edition",
+	ISBN:      "9780261102217",
+	Pages:     310,
+}
+
+var goodOmens = &Item{
+	ID:        "7b2d4c1e-0000-4000-8000-000000000002",
+	Title:     "Good Omens",
+	Authors:   []Name{{Family: "Pratchett", Given: "Terry"}, {Family: "Gaiman", Given: "Neil"}},
+	Publisher: "Gollancz",
+	Year:      1990,
+}
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		name string
+		want Name
+	}{
+		{name: "J. R. R. Tolkien", want: Name{Family: "Tolkien", Given: "J. R. R."}},
+		{name: "Tolkien, J. R. R.", want: Name{Family: "Tolkien", Given: "J. R. R."}},
+		{name: "Homer", want: Name{Family: "Homer"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, ParseName(tt.name), tt.want)
+		})
+	}
+}
+
+func TestFromBook(t *testing.T) {
+	tests := []struct {
+		name        string
+		book        *models.Book
+		wantAuthors []Name
+		wantEditors []Name
+	}{
+		{
+			name:        "Inverted name",
+			book:        &models.Book{Author: "Tolkien, J. R. R."},
+			wantAuthors: []Name{{Family: "Tolkien", Given: "J. R. R."}},
+		},
+		{
+			name:        "Semicolons",
+			book:        &models.Book{Author: "Pratchett, Terry; Gaiman, Neil"},
+			wantAuthors: []Name{{Family: "Pratchett", Given: "Terry"}, {Family: "Gaiman", Given: "Neil"}},
+		},
+		{
+			name:        "And",
+			book:        &models.Book{Author: "Terry Pratchett and Neil Gaiman"},
+			wantAuthors: []Name{{Family: "Pratchett", Given: "Terry"}, {Family: "Gaiman", Given: "Neil"}},
+		},
+		{
+			name:        "Ampersand",
+			book:        &models.Book{Author: "Terry Pratchett & Neil Gaiman"},
+			wantAuthors: []Name{{Family: "Pratchett", Given: "Terry"}, {Family: "Gaiman", Given: "Neil"}},
+		},
+		{
+			name: "Credits",
+			book: &models.Book{
+				Author: "ignored",
+				Authors: []*models.BookAuthor{
+					{Name: "Homer", Role: models.AuthorRoleAuthor},
+					{Name: "Fagles, Robert", Role: models.AuthorRoleTranslator},
+					{Name: "Knox, Bernard", Role: models.AuthorRoleEditor},
+				},
+			},
+			wantAuthors: []Name{{Family: "Homer"}},
+			wantEditors: []Name{{Family: "Knox", Given: "Bernard"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := FromBook(tt.book)
+			assert.Equal(t, len(item.Authors), len(tt.wantAuthors))
+			for i := range tt.wantAuthors {
+				if i < len(item.Authors) {
+					assert.Equal(t, item.Authors[i], tt.wantAuthors[i])
+				}
+			}
+			assert.Equal(t, len(item.Editors), len(tt.wantEditors))
+			for i := range tt.wantEditors {
+				if i < len(item.Editors) {
+					assert.Equal(t, item.Editors[i], tt.wantEditors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBibTeXKeySuffix(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{n: 0, want: "a"},
+		{n: 25, want: "z"},
+		{n: 26, want: "aa"},
+		{n: 27, want: "ab"},
+		{n: 51, want: "az"},
+		{n: 52, want: "ba"},
+		{n: 701, want: "zz"},
+		{n: 702, want: "aaa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, bibtexKeySuffix(tt.n), tt.want)
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		items  []*Item
+		want   []string
+	}{
+		{
+			name:   "BibTeX",
+			format: FormatBibTeX,
+			items:  []*Item{hobbit, hobbit},
+			want: []string{
+				"@book{tolkien1937,\n",
+				"@book{tolkien1937a,\n",
+				"  author = {Tolkien, J. R. R.},\n",
+				"  publisher = {Allen \\& Unwin},\n",
+				"  year = {1937},\n",
+			},
+		},
+		{
+			name:   "RIS",
+			format: FormatRIS,
+			items:  []*Item{goodOmens},
+			want: []string{
+				"TY  - BOOK\r\n",
+				"AU  - Pratchett, Terry\r\nAU  - Gaiman, Neil\r\n",
+				"PY  - 1990\r\n",
+				"ER  - \r\n",
+			},
+		},
+		{
+			name:   "APA",
+			format: FormatAPA,
+			items:  []*Item{hobbit, goodOmens},
+			want: []string{
+				"Tolkien, J. R. R. (1937). The Hobbit (4th ed.). Allen & Unwin.\n\n",
+				"Pratchett, T., & Gaiman, N. (1990). Good Omens. Gollancz.\n",
+			},
+		},
+		{
+			name:   "MLA",
+			format: FormatMLA,
+			items:  []*Item{hobbit, goodOmens},
+			want: []string{
+				"Tolkien, J. R. R. The Hobbit. 4th ed., Allen & Unwin, 1937.\n",
+				"Pratchett, Terry, and Neil Gaiman. Good Omens. Gollancz, 1990.\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NilError(t, Write(&buf, tt.format, tt.items))
+			for _, want := range tt.want {
+				assert.StringContains(t, buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestWriteCSLJSON(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NilError(t, Write(&buf, FormatCSLJSON, []*Item{hobbit}))
+
+	var entries []struct {
+		ID     string `json:"id"`
+		Type   string `json:"type"`
+		Author []Name `json:"author"`
+		Issued struct {
+			DateParts [][]int `json:"date-parts"`
+		} `json:"issued"`
+	}
+	assert.NilError(t, json.Unmarshal(buf.Bytes(), &entries))
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].ID, hobbit.ID)
+	assert.Equal(t, entries[0].Type, "book")
+	assert.Equal(t, entries[0].Author[0], hobbit.Authors[0])
+	assert.Equal(t, entries[0].Issued.DateParts[0][0], 1937)
+}
+
+func TestAPAThreeAuthors(t *testing.T) {
+	item := &Item{
+		Title:   "Structure and Interpretation of Computer Programs",
+		Authors: []Name{{"Abelson", "Harold"}, {"Sussman", "Gerald Jay"}, {"Sussman", "Julie"}},
+	}
+	got := APA(item)
+	assert.Equal(t, got, "Abelson, H., Sussman, G. J., & Sussman, J. (n.d.). Structure and Interpretation of Computer Programs.")
+	assert.Equal(t, strings.HasPrefix(MLA(item), "Abelson, Harold, et al. "), true)
+}
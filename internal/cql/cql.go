@@ -0,0 +1,297 @@
+// Package cql parses queries in the Contextual Query Language, which library systems
+// use to search each other's catalogs through SRU, and helps translate them into SQL.
+//
+// Search clauses, the booleans and, or and not, and parentheses are supported, e.g.
+//
+//	title any "hobbit silmarillion" and (author = tolkien or subject == fantasy)
+//
+// Relation modifiers, prefix assignments and proximity aren't.
+package cql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrSyntax              = errors.New("query syntax error")
+	ErrUnsupportedIndex    = errors.New("unsupported index")
+	ErrUnsupportedRelation = errors.New("unsupported relation")
+	ErrUnsupportedBoolean  = errors.New("unsupported boolean operator")
+	ErrMasking             = errors.New("masking characters are not supported")
+)
+
+// Node is a parsed query: either a Clause or a Boolean combining two queries.
+type Node interface {
+	String() string
+}
+
+// Clause is a search clause, e.g. title = hobbit. A clause which is only a term has the
+// index cql.serverchoice and the relation "=". Index names and relations are in lower
+// case. Masked is set if the term contains unescaped masking characters (* or ?).
+type Clause struct {
+	Index    string
+	Relation string
+	Term     string
+	Masked   bool
+}
+
+func (c *Clause) String() string {
+	return fmt.Sprintf("%s %s %q", c.Index, c.Relation, c.Term)
+}
+
+// Boolean combines two queries with and, or or not. "a not b" matches what a matches
+// and b doesn't.
+type Boolean struct {
+	Operator string
+	Left     Node
+	Right    Node
+}
+
+func (b *Boolean) String() string {
+	return fmt.Sprintf("(%s %s %s)", b.Left, b.Operator, b.Right)
+}
+
+// ServerChoice is the index of clauses which don't name one.
+const ServerChoice = "cql.serverchoice"
+
+var (
+	symbolRelations = []string{"==", "<>", "<=", ">=", "=", "<", ">"}
+	namedRelations  = map[string]bool{"any": true, "all": true, "adj": true, "exact": true, "within": true, "encloses": true}
+	booleans        = map[string]bool{"and": true, "or": true, "not": true, "prox": true}
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenOpen
+	tokenClose
+	tokenRelation
+	tokenWord
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	// masked is set for terms containing unescaped masking characters.
+	masked bool
+}
+
+// lex splits a query into tokens. Quoted strings can contain escaped quotes, and the
+// backslashes of escaped masking characters are dropped.
+func lex(query string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen, value: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose, value: ")"})
+			i++
+		case c == '/':
+			return nil, fmt.Errorf("%w: modifiers are not supported", ErrSyntax)
+		case strings.ContainsRune("=<>", rune(c)):
+			for _, relation := range symbolRelations {
+				if strings.HasPrefix(query[i:], relation) {
+					tokens = append(tokens, token{kind: tokenRelation, value: relation})
+					i += len(relation)
+					break
+				}
+			}
+		case c == '"':
+			var b strings.Builder
+			masked := false
+			j := i + 1
+			for ; j < len(query) && query[j] != '"'; j++ {
+				switch {
+				case query[j] == '\\' && j+1 < len(query):
+					j++
+					b.WriteByte(query[j])
+				case query[j] == '*' || query[j] == '?':
+					masked = true
+					b.WriteByte(query[j])
+				default:
+					b.WriteByte(query[j])
+				}
+			}
+			if j == len(query) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrSyntax)
+			}
+			tokens = append(tokens, token{kind: tokenString, value: b.String(), masked: masked})
+			i = j + 1
+		default:
+			var b strings.Builder
+			masked := false
+			j := i
+			for ; j < len(query) && !strings.ContainsRune(" \t\r\n()=<>\"/", rune(query[j])); j++ {
+				switch {
+				case query[j] == '\\' && j+1 < len(query):
+					j++
+					b.WriteByte(query[j])
+				case query[j] == '*' || query[j] == '?':
+					masked = true
+					b.WriteByte(query[j])
+				default:
+					b.WriteByte(query[j])
+				}
+			}
+			tokens = append(tokens, token{kind: tokenWord, value: b.String(), masked: masked})
+			i = j
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek(n int) token {
+	if p.pos+n >= len(p.tokens) {
+		return token{kind: tokenEOF}
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *parser) next() token {
+	t := p.peek(0)
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+// Parse parses a query. Errors wrap ErrSyntax, or ErrUnsupportedBoolean for prox.
+func Parse(query string) (Node, error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	node, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(0); t.kind != tokenEOF {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, t.value)
+	}
+	return node, nil
+}
+
+// query parses clauses joined by booleans, which all have the same precedence and
+// are applied from left to right.
+func (p *parser) query() (Node, error) {
+	left, err := p.clause()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek(0)
+		operator := strings.ToLower(t.value)
+		if t.kind != tokenWord || !booleans[operator] {
+			return left, nil
+		}
+		if operator == "prox" {
+			return nil, fmt.Errorf("%w: prox", ErrUnsupportedBoolean)
+		}
+		p.next()
+
+		right, err := p.clause()
+		if err != nil {
+			return nil, err
+		}
+		left = &Boolean{Operator: operator, Left: left, Right: right}
+	}
+}
+
+func (p *parser) clause() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenOpen:
+		node, err := p.query()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenClose {
+			return nil, fmt.Errorf("%w: missing closing parenthesis", ErrSyntax)
+		}
+		return node, nil
+	case tokenWord, tokenString:
+	default:
+		return nil, fmt.Errorf("%w: expected a search term", ErrSyntax)
+	}
+
+	// The first term is an index if a relation follows it.
+	relation := p.peek(0)
+	switch {
+	case t.kind == tokenWord && relation.kind == tokenRelation:
+	case t.kind == tokenWord && relation.kind == tokenWord && namedRelations[strings.ToLower(relation.value)]:
+	default:
+		return &Clause{Index: ServerChoice, Relation: "=", Term: t.value, Masked: t.masked}, nil
+	}
+	p.next()
+
+	term := p.next()
+	if term.kind != tokenWord && term.kind != tokenString {
+		return nil, fmt.Errorf("%w: expected a search term after %q", ErrSyntax, relation.value)
+	}
+	return &Clause{
+		Index:    strings.ToLower(t.value),
+		Relation: strings.ToLower(relation.value),
+		Term:     term.value,
+		Masked:   term.masked,
+	}, nil
+}
+
+// Translate turns a query into an SQL condition. The clauses are translated by fn,
+// which calls arg to add a value to the placeholder parameters and get its
+// placeholder. Parameters are numbered from offset+1, so that they can follow those
+// of the rest of the statement.
+func Translate(node Node, offset int, fn func(clause *Clause, arg func(any) string) (string, error)) (string, []any, error) {
+	args := []any{}
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", offset+len(args))
+	}
+
+	var translate func(node Node) (string, error)
+	translate = func(node Node) (string, error) {
+		switch node := node.(type) {
+		case *Clause:
+			return fn(node, arg)
+		case *Boolean:
+			left, err := translate(node.Left)
+			if err != nil {
+				return "", err
+			}
+			right, err := translate(node.Right)
+			if err != nil {
+				return "", err
+			}
+			switch node.Operator {
+			case "and":
+				return "(" + left + " AND " + right + ")", nil
+			case "or":
+				return "(" + left + " OR " + right + ")", nil
+			case "not":
+				return "(" + left + " AND NOT " + right + ")", nil
+			}
+			return "", fmt.Errorf("%w: %s", ErrUnsupportedBoolean, node.Operator)
+		}
+		return "", fmt.Errorf("cql: unknown node %T", node)
+	}
+
+	condition, err := translate(node)
+	if err != nil {
+		return "", nil, err
+	}
+	return condition, args, nil
+}
@@ -0,0 +1,68 @@
+package cql
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Danik14/library/internal/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr error
+	}{
+		{name: "Term", query: "hobbit", want: `cql.serverchoice = "hobbit"`},
+		{name: "Clause", query: "Title = hobbit", want: `title = "hobbit"`},
+		{name: "Quoted term", query: `dc.title adj "the \"hobbit\""`, want: `dc.title adj "the \"hobbit\""`},
+		{name: "Quoted relation", query: `author "any"`, wantErr: ErrSyntax},
+		{name: "Booleans from left to right", query: "a or b AND c", want: `((cql.serverchoice = "a" or cql.serverchoice = "b") and cql.serverchoice = "c")`},
+		{name: "Parentheses", query: "a not (subject == fantasy or isbn = 123)", want: `(cql.serverchoice = "a" not (subject == "fantasy" or isbn = "123"))`},
+		{name: "Missing parenthesis", query: "(a and b", wantErr: ErrSyntax},
+		{name: "Missing term", query: "title =", wantErr: ErrSyntax},
+		{name: "Unterminated string", query: `title = "hobbit`, wantErr: ErrSyntax},
+		{name: "Modifier", query: "title =/stem hobbit", wantErr: ErrSyntax},
+		{name: "Trailing boolean", query: "a and", wantErr: ErrSyntax},
+		{name: "Prox", query: "a prox b", wantErr: ErrUnsupportedBoolean},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := Parse(tt.query)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v; want %v", err, tt.wantErr)
+				}
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, node.String(), tt.want)
+		})
+	}
+}
+
+func TestMasked(t *testing.T) {
+	node, err := Parse(`title = hob* and title = "what\?"`)
+	assert.NilError(t, err)
+
+	b := node.(*Boolean)
+	assert.Equal(t, b.Left.(*Clause).Masked, true)
+	assert.Equal(t, b.Right.(*Clause).Masked, false)
+	assert.Equal(t, b.Right.(*Clause).Term, "what?")
+}
+
+func TestTranslate(t *testing.T) {
+	node, err := Parse("a and (b or c) not d")
+	assert.NilError(t, err)
+
+	condition, args, err := Translate(node, 2, func(clause *Clause, arg func(any) string) (string, error) {
+		return "x = " + arg(strings.ToUpper(clause.Term)), nil
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, condition, "((x = $3 AND (x = $4 OR x = $5)) AND NOT x = $6)")
+	assert.Equal(t, len(args), 4)
+	assert.Equal(t, args[3].(string), "D")
+}
@@ -0,0 +1,300 @@
+package marc
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/validator"
+)
+
+var (
+	yearRX  = regexp.MustCompile(`[0-9]{4}`)
+	pagesRX = regexp.MustCompile(`([0-9]+)\s*(?:p\.|pages?\b)`)
+)
+
+// ToBook maps the bibliographic fields of a record onto a book:
+//
+//	245 $a $b  title and subtitle
+//	100 $a     main author, or 110 $a for a corporate author
+//	008, 264, 260  year of publication
+//	250 $a     edition
+//	300 $a     number of pages
+//	020 $a     ISBN
+//	650 $a, 655 $a  subjects and genres
+//
+// The ISBD punctuation which catalogers put at the end of subfields is removed. The
+// book isn't validated, so fields missing from the record are left empty.
+func ToBook(record *Record) *models.Book {
+	book := &models.Book{Genres: []string{}}
+
+	for _, field := range record.DataFields("245") {
+		book.Title = trimISBD(field.Subfield('a'))
+		if subtitle := trimISBD(field.Subfield('b')); subtitle != "" {
+			book.Title += ": " + subtitle
+		}
+		break
+	}
+
+	for _, field := range record.DataFields("100") {
+		book.Author = trimISBD(field.Subfield('a'))
+		// First indicator 1 means the name is written surname first.
+		if field.Ind1 == '1' {
+			book.Author = invertName(book.Author)
+		}
+		break
+	}
+	if book.Author == "" {
+		for _, field := range record.DataFields("110") {
+			book.Author = trimISBD(field.Subfield('a'))
+			break
+		}
+	}
+
+	book.Year = publicationYear(record)
+
+	for _, field := range record.DataFields("250") {
+		book.Edition = trimISBD(field.Subfield('a'))
+		break
+	}
+
+	for _, field := range record.DataFields("300") {
+		if m := pagesRX.FindStringSubmatch(field.Subfield('a')); m != nil {
+			pages, _ := strconv.Atoi(m[1])
+			book.Pages = models.Pages(pages)
+		}
+		break
+	}
+
+	for _, field := range record.DataFields("020") {
+		// The ISBN is often followed by a qualifier, e.g. "0451526538 (pbk.)".
+		isbn := models.NormalizeISBN(strings.SplitN(strings.TrimSpace(field.Subfield('a')), " ", 2)[0])
+		switch len(isbn) {
+		case 10:
+			book.ISBN10 = isbn
+		case 13:
+			book.ISBN13 = isbn
+		default:
+			continue
+		}
+		break
+	}
+
+	for _, tag := range []string{"650", "655"} {
+		for _, field := range record.DataFields(tag) {
+			subject := trimISBD(field.Subfield('a'))
+			if subject != "" && !contains(book.Genres, subject) {
+				book.Genres = append(book.Genres, subject)
+			}
+		}
+	}
+
+	return book
+}
+
+// FromBook describes a book as a MARC record, using the same fields that ToBook()
+// reads. The author is recorded in the order it is displayed in, and the genres as
+// uncontrolled genre terms.
+func FromBook(book *models.Book) *Record {
+	record := &Record{Leader: DefaultLeader}
+	control := func(tag, value string) {
+		record.Fields = append(record.Fields, &Field{Tag: tag, Value: value})
+	}
+	data := func(tag string, ind1, ind2 byte, subfields ...*Subfield) {
+		record.Fields = append(record.Fields, &Field{Tag: tag, Ind1: ind1, Ind2: ind2, Subfields: subfields})
+	}
+
+	control("001", book.ID.String())
+
+	// 008 is fixed-length: date entered, type of date and year, then blanks for the
+	// material-specific positions and an undetermined language.
+	date := "nuuuu"
+	if book.Year > 0 {
+		date = fmt.Sprintf("s%04d", book.Year)
+	}
+	control("008", fmt.Sprintf("%s%s    xx %17s%s d", book.CreatedAt.Format("060102"), date, "", "und"))
+
+	for _, isbn := range []string{book.ISBN13, book.ISBN10} {
+		if isbn != "" {
+			data("020", ' ', ' ', &Subfield{Code: 'a', Value: isbn})
+		}
+	}
+
+	titleInd1 := byte('0')
+	if book.Author != "" {
+		data("100", '0', ' ', &Subfield{Code: 'a', Value: book.Author})
+		titleInd1 = '1'
+	}
+
+	if title, subtitle, ok := strings.Cut(book.Title, ": "); ok {
+		data("245", titleInd1, '0', &Subfield{Code: 'a', Value: title + " :"}, &Subfield{Code: 'b', Value: subtitle})
+	} else {
+		data("245", titleInd1, '0', &Subfield{Code: 'a', Value: book.Title})
+	}
+
+	if book.Edition != "" {
+		data("250", ' ', ' ', &Subfield{Code: 'a', Value: book.Edition})
+	}
+
+	var publication []*Subfield
+	if book.Publisher != "" {
+		publication = append(publication, &Subfield{Code: 'b', Value: book.Publisher})
+	}
+	if book.Year > 0 {
+		publication = append(publication, &Subfield{Code: 'c', Value: strconv.Itoa(int(book.Year))})
+	}
+	if len(publication) > 0 {
+		data("264", ' ', '1', publication...)
+	}
+
+	if book.Pages > 0 {
+		data("300", ' ', ' ', &Subfield{Code: 'a', Value: fmt.Sprintf("%d pages", book.Pages)})
+	}
+
+	for _, genre := range book.Genres {
+		data("655", ' ', '4', &Subfield{Code: 'a', Value: genre})
+	}
+
+	return record
+}
+
+// publicationYear takes the year from the fixed-length data in the 008 field, falling
+// back to the date of publication in the 264 or 260 field.
+func publicationYear(record *Record) int32 {
+	if f008 := record.ControlField("008"); len(f008) >= 11 {
+		if year, err := strconv.Atoi(f008[7:11]); err == nil && year > 0 {
+			return int32(year)
+		}
+	}
+	for _, tag := range []string{"264", "260"} {
+		for _, field := range record.DataFields(tag) {
+			if m := yearRX.FindString(field.Subfield('c')); m != "" {
+				year, _ := strconv.Atoi(m)
+				return int32(year)
+			}
+		}
+	}
+	return 0
+}
+
+// trimISBD removes the punctuation and spaces which separate the parts of a catalog
+// entry, e.g. "The hobbit :" becomes "The hobbit". A full stop is only removed if it
+// doesn't end an abbreviation such as "J. R. R.".
+func trimISBD(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimRight(s, " /:;,=")
+	if strings.HasSuffix(s, ".") && !strings.HasSuffix(s, "..") {
+		i := strings.LastIndexAny(s[:len(s)-1], " .")
+		if len(s)-1-(i+1) > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// invertName turns a name written surname first, e.g. "Tolkien, J. R. R.", into the
+// form it is displayed in.
+func invertName(name string) string {
+	surname, forenames, ok := strings.Cut(name, ", ")
+	if !ok {
+		return name
+	}
+	return forenames + " " + surname
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Result is the outcome of importing a single record. Records are numbered from 1 in
+// the order they appear in the file. Errors holds the validation errors for records
+// which couldn't be imported.
+type Result struct {
+	Record        int               `json:"record"`
+	ControlNumber string            `json:"control_number,omitempty"`
+	Book          *models.Book      `json:"book,omitempty"`
+	Errors        map[string]string `json:"errors,omitempty"`
+}
+
+// Import maps the records to books, validates them and, unless dryRun is set, adds the
+// valid ones to the catalog. Each record is imported on its own, so one bad record
+// doesn't stop the others. Subject headings which are known genres become the book's
+// genres; if none of them are, the headings are kept so that the validation errors
+// name them. An error is only returned if the database couldn't be queried.
+func Import(m models.Models, records []*Record, dryRun bool) ([]*Result, error) {
+	taxonomy, err := m.Genres.Taxonomy()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*Result{}
+	seen := map[string]bool{}
+	for i, record := range records {
+		book := ToBook(record)
+		book.Genres = knownGenres(book.Genres, taxonomy)
+
+		result := &Result{
+			Record:        i + 1,
+			ControlNumber: strings.TrimSpace(record.ControlField("001")),
+			Book:          book,
+		}
+		results = append(results, result)
+
+		v := validator.New()
+		models.ValidateBook(v, book, taxonomy)
+
+		if book.ISBN13 != "" && v.Valid() {
+			v.Check(!seen[book.ISBN13], "isbn", "another record in the file has the same ISBN")
+			seen[book.ISBN13] = true
+
+			_, err := m.Books.GetByISBN(book.ISBN13)
+			switch {
+			case err == nil:
+				v.AddError("isbn", "a book with this ISBN already exists")
+			case !errors.Is(err, models.ErrRecordNotFound):
+				return nil, err
+			}
+		}
+
+		if !v.Valid() {
+			result.Errors = v.Errors
+			continue
+		}
+		if dryRun {
+			continue
+		}
+
+		err = m.Books.Insert(book)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrDuplicateISBN):
+				result.Errors = map[string]string{"isbn": "a book with this ISBN already exists"}
+			default:
+				return nil, err
+			}
+		}
+	}
+
+	return results, nil
+}
+
+func knownGenres(subjects []string, taxonomy models.GenreTaxonomy) []string {
+	genres := []string{}
+	for _, subject := range subjects {
+		if canonical, ok := taxonomy.Canonical(subject); ok && !contains(genres, canonical) && len(genres) < 5 {
+			genres = append(genres, canonical)
+		}
+	}
+	if len(genres) == 0 {
+		return subjects
+	}
+	return genres
+}
@@ -0,0 +1,195 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Reader reads records in the ISO 2709 exchange format. Record data is assumed to be
+// UTF-8, which is what leader position 09 = 'a' declares; MARC-8 records are read byte
+// for byte.
+type Reader struct {
+	r     *bufio.Reader
+	count int
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF once there are no more records. Line breaks
+// between records, which some systems add, are skipped.
+func (r *Reader) Read() (*Record, error) {
+	for {
+		b, err := r.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != '\r' && b[0] != '\n' {
+			break
+		}
+		r.r.ReadByte()
+	}
+	r.count++
+
+	head, err := r.r.Peek(5)
+	if err != nil {
+		return nil, r.errorf("truncated record length")
+	}
+	length, err := strconv.Atoi(string(head))
+	if err != nil || length < 25 {
+		return nil, r.errorf("bad record length %q", head)
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(r.r, data)
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, r.errorf("record is shorter than its length of %d bytes", length)
+		}
+		return nil, err
+	}
+
+	record, err := parseISO2709(data)
+	if err != nil {
+		return nil, fmt.Errorf("record %d: %w", r.count, err)
+	}
+	return record, nil
+}
+
+func (r *Reader) errorf(format string, args ...any) error {
+	return fmt.Errorf("record %d: %w: %s", r.count, ErrInvalidRecord, fmt.Sprintf(format, args...))
+}
+
+func parseISO2709(data []byte) (*Record, error) {
+	if data[len(data)-1] != recordTerminator {
+		return nil, fmt.Errorf("%w: missing record terminator", ErrInvalidRecord)
+	}
+
+	record := &Record{Leader: string(data[:24])}
+
+	base, err := strconv.Atoi(string(data[12:17]))
+	if err != nil || base <= 24 || base > len(data) {
+		return nil, fmt.Errorf("%w: bad base address %q", ErrInvalidRecord, data[12:17])
+	}
+	if data[base-1] != fieldTerminator {
+		return nil, fmt.Errorf("%w: missing directory terminator", ErrInvalidRecord)
+	}
+
+	directory := data[24 : base-1]
+	if len(directory)%12 != 0 {
+		return nil, fmt.Errorf("%w: directory length is not a multiple of 12", ErrInvalidRecord)
+	}
+
+	for i := 0; i < len(directory); i += 12 {
+		entry := directory[i : i+12]
+		tag := string(entry[:3])
+		length, err1 := strconv.Atoi(string(entry[3:7]))
+		start, err2 := strconv.Atoi(string(entry[7:12]))
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("%w: bad directory entry for field %s", ErrInvalidRecord, tag)
+		}
+		begin := base + start
+		end := begin + length
+		if length < 1 || start < 0 || end > len(data)-1 {
+			return nil, fmt.Errorf("%w: field %s lies outside the record", ErrInvalidRecord, tag)
+		}
+
+		raw := data[begin:end]
+		if raw[len(raw)-1] == fieldTerminator {
+			raw = raw[:len(raw)-1]
+		}
+		record.Fields = append(record.Fields, parseField(tag, raw))
+	}
+
+	return record, nil
+}
+
+func parseField(tag string, raw []byte) *Field {
+	field := &Field{Tag: tag}
+	if IsControlTag(tag) {
+		field.Value = string(raw)
+		return field
+	}
+
+	field.Ind1, field.Ind2 = ' ', ' '
+	if len(raw) >= 2 {
+		field.Ind1, field.Ind2 = raw[0], raw[1]
+		raw = raw[2:]
+	}
+
+	// Anything before the first delimiter isn't part of a subfield, so it is dropped.
+	chunks := bytes.Split(raw, []byte{subfieldDelimiter})
+	for _, chunk := range chunks[1:] {
+		if len(chunk) == 0 {
+			continue
+		}
+		field.Subfields = append(field.Subfields, &Subfield{Code: chunk[0], Value: string(chunk[1:])})
+	}
+	return field
+}
+
+// Writer writes records in the ISO 2709 exchange format. The record length and base
+// address in the leader are filled in as each record is written.
+type Writer struct {
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write writes a single record. Records which are too large for the format's length
+// fields are rejected with ErrInvalidRecord.
+func (w *Writer) Write(record *Record) error {
+	var directory, data bytes.Buffer
+	for _, field := range record.Fields {
+		start := data.Len()
+		if IsControlTag(field.Tag) {
+			data.WriteString(field.Value)
+		} else {
+			data.WriteByte(field.Ind1)
+			data.WriteByte(field.Ind2)
+			for _, subfield := range field.Subfields {
+				data.WriteByte(subfieldDelimiter)
+				data.WriteByte(subfield.Code)
+				data.WriteString(subfield.Value)
+			}
+		}
+		data.WriteByte(fieldTerminator)
+
+		length := data.Len() - start
+		if len(field.Tag) != 3 || length > 9999 || start > 99999 {
+			return fmt.Errorf("%w: field %s is too long", ErrInvalidRecord, field.Tag)
+		}
+		fmt.Fprintf(&directory, "%s%04d%05d", field.Tag, length, start)
+	}
+
+	base := 24 + directory.Len() + 1
+	length := base + data.Len() + 1
+	if length > 99999 {
+		return fmt.Errorf("%w: record is longer than 99999 bytes", ErrInvalidRecord)
+	}
+
+	leader := []byte(record.Leader)
+	if len(leader) != 24 {
+		leader = []byte(DefaultLeader)
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+
+	var buf bytes.Buffer
+	buf.Grow(length)
+	buf.Write(leader)
+	buf.Write(directory.Bytes())
+	buf.WriteByte(fieldTerminator)
+	buf.Write(data.Bytes())
+	buf.WriteByte(recordTerminator)
+
+	_, err := w.w.Write(buf.Bytes())
+	return err
+}
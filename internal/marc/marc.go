@@ -0,0 +1,129 @@
+// Package marc reads and writes MARC 21 bibliographic records, in both the ISO 2709
+// exchange format and MARCXML.
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrInvalidRecord = errors.New("marc: invalid record")
+)
+
+// Define the separator characters used by ISO 2709.
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+)
+
+// DefaultLeader is the leader of a new monograph record with UTF-8 data. The record
+// length and base address are filled in when the record is written.
+const DefaultLeader = "00000nam a2200000uu 4500"
+
+// Record is a single MARC record. Fields are kept in the order they were read in.
+type Record struct {
+	Leader string
+	Fields []*Field
+}
+
+// Field is either a control field (tags 001 to 009), which only has a value, or a data
+// field, which has two indicators and a list of subfields.
+type Field struct {
+	Tag       string
+	Value     string
+	Ind1      byte
+	Ind2      byte
+	Subfields []*Subfield
+}
+
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// IsControlTag reports whether fields with the given tag are control fields.
+func IsControlTag(tag string) bool {
+	return strings.HasPrefix(tag, "00")
+}
+
+// ControlField returns the value of the first control field with the given tag, or the
+// empty string if the record doesn't have one.
+func (r *Record) ControlField(tag string) string {
+	for _, field := range r.Fields {
+		if field.Tag == tag {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// DataFields returns every field with the given tag, in record order.
+func (r *Record) DataFields(tag string) []*Field {
+	var fields []*Field
+	for _, field := range r.Fields {
+		if field.Tag == tag {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Subfield returns the value of the first subfield with the given code, or the empty
+// string if there isn't one.
+func (f *Field) Subfield(code byte) string {
+	for _, subfield := range f.Subfields {
+		if subfield.Code == code {
+			return subfield.Value
+		}
+	}
+	return ""
+}
+
+// ReadAll reads every record from r. MARCXML is recognized by its leading '<', and
+// anything else is read as ISO 2709.
+func ReadAll(r io.Reader) ([]*Record, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return []*Record{}, nil
+			}
+			return nil, err
+		}
+		if !isSpace(b[0]) {
+			break
+		}
+		br.ReadByte()
+	}
+
+	// Skip a UTF-8 byte order mark, which some tools put in front of XML files.
+	if b, _ := br.Peek(3); bytes.Equal(b, []byte("\xEF\xBB\xBF")) {
+		br.Discard(3)
+	}
+	if b, _ := br.Peek(1); len(b) == 1 && b[0] == '<' {
+		return ReadXML(br)
+	}
+
+	records := []*Record{}
+	reader := NewReader(br)
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
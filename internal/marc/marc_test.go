@@ -0,0 +1,251 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Danik14/library/internal/assert"
+	"github.com/Danik14/library/internal/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// iso2709 assembles a binary record from fields given as tag and raw content, with
+// "$" standing for the subfield delimiter.
+func iso2709(fields ...[2]string) string {
+	var directory, data strings.Builder
+	for _, f := range fields {
+		content := strings.ReplaceAll(f[1], "$", "\x1F") + "\x1E"
+		fmt.Fprintf(&directory, "%s%04d%05d", f[0], len(content), data.Len())
+		data.WriteString(content)
+	}
+	base := 24 + directory.Len() + 1
+	length := base + data.Len() + 1
+	leader := fmt.Sprintf("%05dnam a22%05d i 4500", length, base)
+	return leader + directory.String() + "\x1E" + data.String() + "\x1D"
+}
+
+var hobbit = [][2]string{
+	{"001", "ocm00012345"},
+	{"008", "780101s1937    enk           000 1 eng d"},
+	{"020", "  $a0261102214 (pbk.)"},
+	{"100", "1 $aTolkien, J. R. R.,$d1892-1973."},
+	{"245", "14$aThe hobbit :$bor, There and back again /$cJ.R.R. Tolkien."},
+	{"250", "  $a4th ed."},
+	{"300", "  $a310 p. :$bill. ;$c20 cm."},
+	{"650", " 0$aFantasy.$vJuvenile fiction."},
+	{"655", " 7$aFantasy fiction.$2lcgft"},
+}
+
+const hobbitXML = `<?xml version="1.0" encoding="UTF-8"?>
+<marc:collection xmlns:marc="http://www.loc.gov/MARC21/slim">
+  <marc:record>
+    <marc:leader>00000nam a2200000 i 4500</marc:leader>
+    <marc:controlfield tag="001">ocm00012345</marc:controlfield>
+    <marc:controlfield tag="008">780101s1937    enk           000 1 eng d</marc:controlfield>
+    <marc:datafield tag="020" ind1=" " ind2=" ">
+      <marc:subfield code="a">0261102214 (pbk.)</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="100" ind1="1" ind2=" ">
+      <marc:subfield code="a">Tolkien, J. R. R.,</marc:subfield>
+      <marc:subfield code="d">1892-1973.</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="245" ind1="1" ind2="4">
+      <marc:subfield code="a">The hobbit :</marc:subfield>
+      <marc:subfield code="b">or, There and back again /</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="250" ind1=" " ind2=" ">
+      <marc:subfield code="a">4th ed.</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="300" ind1=" " ind2=" ">
+      <marc:subfield code="a">310 p. :</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="650" ind1=" " ind2="0">
+      <marc:subfield code="a">Fantasy.</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="655" ind1=" " ind2="7">
+      <marc:subfield code="a">Fantasy fiction.</marc:subfield>
+    </marc:datafield>
+  </marc:record>
+</marc:collection>`
+
+func TestReadAll(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "ISO 2709",
+			input: iso2709(hobbit...),
+		},
+		{
+			name:  "ISO 2709 with line breaks",
+			input: iso2709(hobbit...) + "\n" + iso2709(hobbit...) + "\n",
+		},
+		{
+			name:  "MARCXML",
+			input: hobbitXML,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := ReadAll(strings.NewReader(tt.input))
+			assert.NilError(t, err)
+			if len(records) == 0 {
+				t.Fatal("got no records")
+			}
+
+			record := records[0]
+			assert.Equal(t, record.ControlField("001"), "ocm00012345")
+			assert.Equal(t, len(record.DataFields("245")), 1)
+
+			title := record.DataFields("245")[0]
+			assert.Equal(t, title.Ind1, byte('1'))
+			assert.Equal(t, title.Ind2, byte('4'))
+			assert.Equal(t, title.Subfield('a'), "The hobbit :")
+
+			book := ToBook(record)
+			assert.Equal(t, book.Title, "The hobbit: or, There and back again")
+			assert.Equal(t, book.Author, "J. R. R. Tolkien")
+			assert.Equal(t, book.Year, int32(1937))
+			assert.Equal(t, int(book.Pages), 310)
+			assert.Equal(t, book.Edition, "4th ed")
+			assert.Equal(t, book.ISBN10, "0261102214")
+			assert.Equal(t, strings.Join(book.Genres, "|"), "Fantasy|Fantasy fiction")
+		})
+	}
+}
+
+func TestReadAllInvalid(t *testing.T) {
+	record := iso2709(hobbit...)
+	// The first directory entry is for the 001 field: its tag, 4-digit length and
+	// 5-digit starting position.
+	entry := record[24:36]
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "Bad length",
+			input: "abcde" + record[5:],
+		},
+		{
+			name:  "Truncated",
+			input: record[:len(record)-10],
+		},
+		{
+			name:  "Missing record terminator",
+			input: record[:len(record)-1] + "x",
+		},
+		{
+			name:  "Negative field length",
+			input: record[:24] + entry[:3] + "-001" + entry[7:] + record[36:],
+		},
+		{
+			name:  "Negative field start",
+			input: record[:24] + entry[:7] + "-0001" + record[36:],
+		},
+		{
+			name:  "Zero field length",
+			input: record[:24] + entry[:3] + "0000" + entry[7:] + record[36:],
+		},
+		{
+			name:  "Malformed XML",
+			input: `<collection><record><leader>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadAll(strings.NewReader(tt.input))
+			if !errors.Is(err, ErrInvalidRecord) {
+				t.Errorf("got: %v; want: %v", err, ErrInvalidRecord)
+			}
+		})
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	book := &models.Book{
+		ID:        uuid.NewV4(),
+		CreatedAt: time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC),
+		Title:     "The hobbit: or, There and back again",
+		Author:    "J. R. R. Tolkien",
+		Year:      1937,
+		Pages:     310,
+		Genres:    []string{"Fantasy", "Children's fiction"},
+		ISBN10:    "0261102214",
+		ISBN13:    "9780261102217",
+		Edition:   "4th edition",
+		Publisher: "Allen & Unwin",
+	}
+
+	tests := []struct {
+		name  string
+		write func(w io.Writer, records ...*Record) error
+	}{
+		{
+			name: "ISO 2709",
+			write: func(w io.Writer, records ...*Record) error {
+				mw := NewWriter(w)
+				for _, record := range records {
+					if err := mw.Write(record); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name: "MARCXML",
+			write: func(w io.Writer, records ...*Record) error {
+				xw := NewXMLWriter(w)
+				for _, record := range records {
+					if err := xw.Write(record); err != nil {
+						return err
+					}
+				}
+				return xw.Close()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NilError(t, tt.write(&buf, FromBook(book), FromBook(book)))
+
+			records, err := ReadAll(&buf)
+			assert.NilError(t, err)
+			assert.Equal(t, len(records), 2)
+
+			record := records[1]
+			assert.Equal(t, record.ControlField("001"), book.ID.String())
+			assert.Equal(t, len(record.ControlField("008")), 40)
+
+			got := ToBook(record)
+			assert.Equal(t, got.Title, book.Title)
+			assert.Equal(t, got.Author, book.Author)
+			assert.Equal(t, got.Year, book.Year)
+			assert.Equal(t, got.Pages, book.Pages)
+			assert.Equal(t, got.ISBN13, book.ISBN13)
+			assert.Equal(t, got.Edition, book.Edition)
+			assert.Equal(t, strings.Join(got.Genres, "|"), strings.Join(book.Genres, "|"))
+		})
+	}
+}
+
+func TestWriteEmptyXML(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NilError(t, NewXMLWriter(&buf).Close())
+
+	records, err := ReadAll(&buf)
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), 0)
+}
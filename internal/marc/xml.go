@@ -0,0 +1,153 @@
+package marc
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Namespace is the XML namespace of MARCXML documents.
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// ReadXML reads every record in a MARCXML document. The records can either be wrapped
+// in a collection element or be the document's root element.
+func ReadXML(r io.Reader) ([]*Record, error) {
+	dec := xml.NewDecoder(r)
+	records := []*Record{}
+
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRecord, err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		var x xmlRecord
+		err = dec.DecodeElement(&x, &start)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w: %s", len(records)+1, ErrInvalidRecord, err)
+		}
+
+		record := &Record{Leader: x.Leader}
+		for _, cf := range x.ControlFields {
+			record.Fields = append(record.Fields, &Field{Tag: cf.Tag, Value: cf.Value})
+		}
+		for _, df := range x.DataFields {
+			field := &Field{Tag: df.Tag, Ind1: indicator(df.Ind1), Ind2: indicator(df.Ind2)}
+			for _, sf := range df.Subfields {
+				if sf.Code == "" {
+					continue
+				}
+				field.Subfields = append(field.Subfields, &Subfield{Code: sf.Code[0], Value: sf.Value})
+			}
+			record.Fields = append(record.Fields, field)
+		}
+		records = append(records, record)
+	}
+}
+
+// XMLWriter writes records as a MARCXML collection. The collection is opened by the
+// first call to Write(), and Close() must be called to end it.
+type XMLWriter struct {
+	w      io.Writer
+	enc    *xml.Encoder
+	opened bool
+}
+
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	return &XMLWriter{w: w, enc: xml.NewEncoder(w)}
+}
+
+func (w *XMLWriter) open() error {
+	if w.opened {
+		return nil
+	}
+	w.opened = true
+	_, err := fmt.Fprintf(w.w, "%s<collection xmlns=%q>\n", xml.Header, Namespace)
+	return err
+}
+
+func (w *XMLWriter) Write(record *Record) error {
+	err := w.open()
+	if err != nil {
+		return err
+	}
+
+	err = w.enc.Encode(toXML(record))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w.w, "\n")
+	return err
+}
+
+// Close ends the collection. It doesn't close the underlying writer.
+func (w *XMLWriter) Close() error {
+	err := w.open()
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w.w, "</collection>\n")
+	return err
+}
+
+// MarshalXML writes a record as a MARCXML record element declaring its namespace, so
+// that it can be embedded in other XML documents, such as SRU responses.
+func (r *Record) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return enc.EncodeElement(toXML(r), xml.StartElement{Name: xml.Name{Space: Namespace, Local: "record"}})
+}
+
+func toXML(record *Record) xmlRecord {
+	x := xmlRecord{Leader: record.Leader}
+	for _, field := range record.Fields {
+		if IsControlTag(field.Tag) {
+			x.ControlFields = append(x.ControlFields, xmlControlField{Tag: field.Tag, Value: field.Value})
+			continue
+		}
+		df := xmlDataField{Tag: field.Tag, Ind1: string(field.Ind1), Ind2: string(field.Ind2)}
+		for _, subfield := range field.Subfields {
+			df.Subfields = append(df.Subfields, xmlSubfield{Code: string(subfield.Code), Value: subfield.Value})
+		}
+		x.DataFields = append(x.DataFields, df)
+	}
+	return x
+}
+
+func indicator(s string) byte {
+	if s == "" {
+		return ' '
+	}
+	return s[0]
+}
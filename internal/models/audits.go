@@ -0,0 +1,476 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/validator"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	ErrAuditClosed = errors.New("audit is closed")
+)
+
+// Define constants for the status of an audit. Barcodes can only be scanned while an
+// audit is open, and missing copies can only be marked as lost once it is closed.
+const (
+	AuditStatusOpen   = "open"
+	AuditStatusClosed = "closed"
+)
+
+var AuditStatuses = []string{AuditStatusOpen, AuditStatusClosed}
+
+// Audit is a stocktake session, in which staff scan the barcode of every copy on the
+// shelves of a branch, or of the shelves from ShelfFrom to ShelfTo. Either end of the
+// range can be empty. ShelfTo includes every shelf mark it is a prefix of, so that
+// "823.9" covers "823.912 TOL".
+type Audit struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	BranchID  uuid.UUID  `json:"branch_id"`
+	ShelfFrom string     `json:"shelf_from,omitempty"`
+	ShelfTo   string     `json:"shelf_to,omitempty"`
+	OpenedBy  *uuid.UUID `json:"opened_by,omitempty"`
+	Status    string     `json:"status"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+	// Scanned is the number of distinct barcodes scanned so far.
+	Scanned int   `json:"scanned"`
+	Version int32 `json:"version"`
+}
+
+// AuditItem is a copy in an audit report. Barcodes which don't belong to any copy
+// only have the barcode and the reason set.
+type AuditItem struct {
+	Barcode         string     `json:"barcode"`
+	CopyID          *uuid.UUID `json:"copy_id,omitempty"`
+	BookID          *uuid.UUID `json:"book_id,omitempty"`
+	Title           string     `json:"title,omitempty"`
+	ShelfMark       string     `json:"shelf_mark,omitempty"`
+	Status          string     `json:"status,omitempty"`
+	CurrentBranchID *uuid.UUID `json:"current_branch_id,omitempty"`
+	// Reason explains why a scanned copy wasn't expected on the audited shelves.
+	Reason string `json:"reason,omitempty"`
+}
+
+// AuditReport compares what was scanned during an audit with what the catalog says
+// should be on the shelves. Missing copies are available copies in the audited range
+// which weren't scanned; once the audit is closed, they are the copies which were
+// missing when it was closed, with their status as it is now. Unexpected items were
+// scanned but belong elsewhere, aren't supposed to be in circulation, or aren't copies
+// at all. Copies recorded as on loan which were scanned are listed separately, as
+// their loans probably weren't returned properly.
+type AuditReport struct {
+	Scanned       int          `json:"scanned"`
+	Missing       []*AuditItem `json:"missing"`
+	Unexpected    []*AuditItem `json:"unexpected"`
+	OnLoanPresent []*AuditItem `json:"on_loan_present"`
+}
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// auditScope is the condition which a copy in book_copies must meet to be in the
+// audited range of the audit in audits.
+const auditScope = `(book_copies.current_branch_id = audits.branch_id
+AND (audits.shelf_from = '' OR book_copies.shelf_mark >= audits.shelf_from)
+AND (audits.shelf_to = '' OR left(book_copies.shelf_mark, length(audits.shelf_to)) <= audits.shelf_to))`
+
+// auditMissing is the condition which a copy in book_copies must meet to be missing
+// from the audit in audits.
+const auditMissing = auditScope + `
+AND book_copies.status = 'available'
+AND NOT EXISTS (SELECT 1 FROM audit_scans WHERE audit_scans.audit_id = audits.id AND audit_scans.copy_id = book_copies.id)`
+
+// auditReported is the condition which a copy in book_copies must meet to be listed as
+// missing in the report of the audit in audits: while the audit is open the copies
+// which are missing now, and once it is closed those which were missing at the time.
+const auditReported = `CASE WHEN audits.status = 'open' THEN (` + auditMissing + `)
+ELSE EXISTS (SELECT 1 FROM audit_missing WHERE audit_missing.audit_id = audits.id AND audit_missing.copy_id = book_copies.id) END`
+
+func (m AuditModel) Insert(audit *Audit) error {
+	query := `
+INSERT INTO audits (branch_id, shelf_from, shelf_to, opened_by)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at, status, version`
+	args := []any{audit.BranchID, audit.ShelfFrom, audit.ShelfTo, audit.OpenedBy}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&audit.ID, &audit.CreatedAt, &audit.Status, &audit.Version)
+}
+
+func (m AuditModel) Get(id uuid.UUID) (*Audit, error) {
+	query := `
+SELECT id, created_at, branch_id, shelf_from, shelf_to, opened_by, status, closed_at,
+(SELECT count(*) FROM audit_scans WHERE audit_scans.audit_id = audits.id), version
+FROM audits
+WHERE id = $1`
+
+	var audit Audit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&audit.ID,
+		&audit.CreatedAt,
+		&audit.BranchID,
+		&audit.ShelfFrom,
+		&audit.ShelfTo,
+		&audit.OpenedBy,
+		&audit.Status,
+		&audit.ClosedAt,
+		&audit.Scanned,
+		&audit.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &audit, nil
+}
+
+// GetAll returns a page of audits, optionally only those of a branch and only those
+// with a given status.
+func (m AuditModel) GetAll(branchID uuid.UUID, status string, filters data.Filters) ([]*Audit, data.Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), id, created_at, branch_id, shelf_from, shelf_to, opened_by, status, closed_at,
+(SELECT count(*) FROM audit_scans WHERE audit_scans.audit_id = audits.id), version
+FROM audits
+WHERE ($1::uuid IS NULL OR branch_id = $1)
+AND (status = $2 OR $2 = '')
+ORDER BY %s %s, id ASC
+LIMIT $3 OFFSET $4`, filters.SortColumn(), filters.SortDirection())
+
+	var branch *uuid.UUID
+	if branchID != uuid.Nil {
+		branch = &branchID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, branch, status, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	audits := []*Audit{}
+	for rows.Next() {
+		var audit Audit
+		err := rows.Scan(
+			&totalRecords,
+			&audit.ID,
+			&audit.CreatedAt,
+			&audit.BranchID,
+			&audit.ShelfFrom,
+			&audit.ShelfTo,
+			&audit.OpenedBy,
+			&audit.Status,
+			&audit.ClosedAt,
+			&audit.Scanned,
+			&audit.Version,
+		)
+		if err != nil {
+			return nil, data.Metadata{}, err
+		}
+		audits = append(audits, &audit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	metadata := data.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return audits, metadata, nil
+}
+
+// AddScans records a batch of scanned barcodes, matching each to the copy it belongs
+// to. Barcodes which were already scanned during the audit are ignored, so that a
+// batch can safely be sent again. It returns the number of barcodes which were new,
+// or ErrAuditClosed if the audit has been closed.
+func (m AuditModel) AddScans(audit *Audit, barcodes []string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Lock the audit, so that it can't be closed halfway through the batch.
+	var status string
+	err = tx.QueryRowContext(ctx, `SELECT status FROM audits WHERE id = $1 FOR UPDATE`, audit.ID).Scan(&status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	if status != AuditStatusOpen {
+		return 0, ErrAuditClosed
+	}
+
+	query := `
+INSERT INTO audit_scans (audit_id, barcode, copy_id)
+SELECT $1, scanned.barcode, book_copies.id
+FROM (SELECT DISTINCT unnest($2::text[]) AS barcode) AS scanned
+LEFT JOIN book_copies ON book_copies.barcode = scanned.barcode
+ON CONFLICT (audit_id, barcode) DO NOTHING`
+	result, err := tx.ExecContext(ctx, query, audit.ID, pq.Array(barcodes))
+	if err != nil {
+		return 0, err
+	}
+	added, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	audit.Scanned += int(added)
+	return int(added), nil
+}
+
+// Close ends the scanning of an audit, and records which copies are missing from it.
+// Copies which are returned or checked in after that don't change the outcome.
+func (m AuditModel) Close(audit *Audit) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE audits
+SET status = 'closed', closed_at = NOW(), version = version + 1
+WHERE id = $1 AND version = $2 AND status = 'open'
+RETURNING status, closed_at, version`
+
+	err = tx.QueryRowContext(ctx, query, audit.ID, audit.Version).Scan(&audit.Status, &audit.ClosedAt, &audit.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+INSERT INTO audit_missing (audit_id, copy_id)
+SELECT audits.id, book_copies.id
+FROM book_copies
+INNER JOIN audits ON audits.id = $1
+WHERE ` + auditMissing
+	_, err = tx.ExecContext(ctx, query, audit.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Report compares the scans of an audit with the copies in its range. While the audit
+// is open the report reflects the copies as they are now, so a copy which is returned
+// or checked out moves between the lists accordingly. Once it is closed, the missing
+// copies are those recorded by Close().
+func (m AuditModel) Report(audit *Audit) (*AuditReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	report := &AuditReport{Missing: []*AuditItem{}, Unexpected: []*AuditItem{}, OnLoanPresent: []*AuditItem{}}
+
+	query := `
+SELECT book_copies.barcode, book_copies.id, book_copies.book_id, books.title, book_copies.shelf_mark, book_copies.status, book_copies.current_branch_id
+FROM book_copies
+INNER JOIN books ON books.id = book_copies.book_id
+INNER JOIN audits ON audits.id = $1
+WHERE ` + auditReported + `
+ORDER BY book_copies.shelf_mark ASC, book_copies.barcode ASC`
+	rows, err := m.DB.QueryContext(ctx, query, audit.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item AuditItem
+		err := rows.Scan(&item.Barcode, &item.CopyID, &item.BookID, &item.Title, &item.ShelfMark, &item.Status, &item.CurrentBranchID)
+		if err != nil {
+			return nil, err
+		}
+		report.Missing = append(report.Missing, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The scans are joined to the copy each barcode belonged to when it was scanned, so
+	// that a copy which has been relabelled since is still found.
+	query = `
+SELECT audit_scans.barcode, book_copies.id, book_copies.book_id, COALESCE(books.title, ''), COALESCE(book_copies.shelf_mark, ''),
+COALESCE(book_copies.status, ''), book_copies.current_branch_id, COALESCE(` + auditScope + `, false)
+FROM audit_scans
+INNER JOIN audits ON audits.id = audit_scans.audit_id
+LEFT JOIN book_copies ON book_copies.id = audit_scans.copy_id
+LEFT JOIN books ON books.id = book_copies.book_id
+WHERE audit_scans.audit_id = $1
+ORDER BY audit_scans.scanned_at ASC, audit_scans.barcode ASC`
+	rows, err = m.DB.QueryContext(ctx, query, audit.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item AuditItem
+		var inScope bool
+		err := rows.Scan(&item.Barcode, &item.CopyID, &item.BookID, &item.Title, &item.ShelfMark, &item.Status, &item.CurrentBranchID, &inScope)
+		if err != nil {
+			return nil, err
+		}
+		report.add(audit, &item, inScope)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// add files a scanned item under the list of the report it belongs in, if any. inScope
+// reports whether the item's copy is shelved in the audited range.
+func (report *AuditReport) add(audit *Audit, item *AuditItem, inScope bool) {
+	report.Scanned++
+
+	switch {
+	case item.CopyID == nil:
+		item.Reason = "no copy has this barcode"
+	case item.Status == CopyStatusOnLoan:
+		report.OnLoanPresent = append(report.OnLoanPresent, item)
+		return
+	case item.CurrentBranchID != nil && *item.CurrentBranchID != audit.BranchID:
+		item.Reason = "copy is at another branch"
+	case !inScope:
+		item.Reason = "copy is shelved outside the audited range"
+	case item.Status == CopyStatusLost || item.Status == CopyStatusWithdrawn || item.Status == CopyStatusInTransit:
+		item.Reason = fmt.Sprintf("copy is %s", item.Status)
+	default:
+		return
+	}
+	report.Unexpected = append(report.Unexpected, item)
+}
+
+// MarkMissingLost marks the copies which were missing when an audit was closed as lost,
+// either all of them or only those in copyIDs. Copies which have turned up or changed
+// status since are left alone, as are copies which weren't missing, so nothing is
+// marked for an audit which is still open. It returns the IDs of the copies marked as
+// lost.
+func (m AuditModel) MarkMissingLost(audit *Audit, copyIDs []uuid.UUID) ([]uuid.UUID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+SELECT book_copies.id, book_copies.status
+FROM audit_missing
+INNER JOIN book_copies ON book_copies.id = audit_missing.copy_id
+WHERE audit_missing.audit_id = $1
+FOR UPDATE OF book_copies`
+	rows, err := tx.QueryContext(ctx, query, audit.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	missing := []*AuditItem{}
+	for rows.Next() {
+		var item AuditItem
+		err := rows.Scan(&item.CopyID, &item.Status)
+		if err != nil {
+			return nil, err
+		}
+		missing = append(missing, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	lost := stillMissing(missing, copyIDs)
+	if len(lost) == 0 {
+		return lost, nil
+	}
+
+	ids := make([]string, len(lost))
+	for i, id := range lost {
+		ids[i] = id.String()
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE book_copies SET status = 'lost', version = version + 1 WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return lost, nil
+}
+
+// stillMissing returns the IDs of the missing copies which are still recorded as
+// available, limited to those in copyIDs unless it is empty.
+func stillMissing(missing []*AuditItem, copyIDs []uuid.UUID) []uuid.UUID {
+	wanted := map[uuid.UUID]bool{}
+	for _, id := range copyIDs {
+		wanted[id] = true
+	}
+
+	ids := []uuid.UUID{}
+	for _, item := range missing {
+		if item.CopyID == nil || item.Status != CopyStatusAvailable {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[*item.CopyID] {
+			continue
+		}
+		ids = append(ids, *item.CopyID)
+	}
+	return ids
+}
+
+func ValidateAudit(v *validator.Validator, audit *Audit) {
+	v.Check(audit.BranchID != uuid.Nil, "branch_id", "must be provided")
+	v.Check(len(audit.ShelfFrom) <= 100, "shelf_from", "must not be more than 100 bytes long")
+	v.Check(len(audit.ShelfTo) <= 100, "shelf_to", "must not be more than 100 bytes long")
+	if audit.ShelfFrom != "" && audit.ShelfTo != "" {
+		v.Check(audit.ShelfFrom <= audit.ShelfTo, "shelf_to", "must not come before shelf_from")
+	}
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Danik14/library/internal/assert"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestValidateAudit(t *testing.T) {
+	branchID := uuid.NewV4()
+
+	tests := []struct {
+		name      string
+		audit     *Audit
+		wantField string
+	}{
+		{name: "Whole branch", audit: &Audit{BranchID: branchID}},
+		{name: "Range", audit: &Audit{BranchID: branchID, ShelfFrom: "823.1", ShelfTo: "823.9"}},
+		{name: "Single shelf", audit: &Audit{BranchID: branchID, ShelfFrom: "823.9", ShelfTo: "823.9"}},
+		{name: "Open start", audit: &Audit{BranchID: branchID, ShelfTo: "823.9"}},
+		{name: "Open end", audit: &Audit{BranchID: branchID, ShelfFrom: "823.9"}},
+		{name: "No branch", audit: &Audit{ShelfFrom: "823.1"}, wantField: "branch_id"},
+		{name: "Reversed range", audit: &Audit{BranchID: branchID, ShelfFrom: "823.9", ShelfTo: "823.1"}, wantField: "shelf_to"},
+		{name: "Long start", audit: &Audit{BranchID: branchID, ShelfFrom: strings.Repeat("8", 101)}, wantField: "shelf_from"},
+		{name: "Long end", audit: &Audit{BranchID: branchID, ShelfTo: strings.Repeat("8", 101)}, wantField: "shelf_to"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateAudit(v, tt.audit)
+
+			assert.Equal(t, v.Valid(), tt.wantField == "")
+			if tt.wantField != "" {
+				_, ok := v.Errors[tt.wantField]
+				assert.Equal(t, ok, true)
+			}
+		})
+	}
+}
+
+func TestAuditReportAdd(t *testing.T) {
+	audit := &Audit{BranchID: uuid.NewV4()}
+	elsewhere := uuid.NewV4()
+	copyID := uuid.NewV4()
+
+	tests := []struct {
+		name       string
+		item       *AuditItem
+		inScope    bool
+		wantOnLoan bool
+		wantReason string
+	}{
+		{
+			name:    "Expected copy",
+			item:    &AuditItem{CopyID: &copyID, Status: CopyStatusAvailable, CurrentBranchID: &audit.BranchID},
+			inScope: true,
+		},
+		{
+			name:       "Unknown barcode",
+			item:       &AuditItem{Barcode: "X1"},
+			wantReason: "no copy has this barcode",
+		},
+		{
+			name:       "On loan",
+			item:       &AuditItem{CopyID: &copyID, Status: CopyStatusOnLoan, CurrentBranchID: &audit.BranchID},
+			inScope:    true,
+			wantOnLoan: true,
+		},
+		{
+			name:       "Other branch",
+			item:       &AuditItem{CopyID: &copyID, Status: CopyStatusAvailable, CurrentBranchID: &elsewhere},
+			wantReason: "copy is at another branch",
+		},
+		{
+			name:       "Outside the range",
+			item:       &AuditItem{CopyID: &copyID, Status: CopyStatusAvailable, CurrentBranchID: &audit.BranchID},
+			inScope:    false,
+			wantReason: "copy is shelved outside the audited range",
+		},
+		{
+			name:       "Lost",
+			item:       &AuditItem{CopyID: &copyID, Status: CopyStatusLost, CurrentBranchID: &audit.BranchID},
+			inScope:    true,
+			wantReason: "copy is lost",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &AuditReport{}
+			report.add(audit, tt.item, tt.inScope)
+
+			assert.Equal(t, report.Scanned, 1)
+			assert.Equal(t, len(report.OnLoanPresent) == 1, tt.wantOnLoan)
+			assert.Equal(t, len(report.Unexpected) == 1, tt.wantReason != "")
+			assert.Equal(t, tt.item.Reason, tt.wantReason)
+		})
+	}
+}
+
+// TestStillMissing follows an audit from closing it to marking its missing copies as
+// lost. The copies missing when the audit was closed are a and b; b has turned up and
+// been checked out since, and c, which was on loan during the audit, has been returned.
+func TestStillMissing(t *testing.T) {
+	a, b, c := uuid.NewV4(), uuid.NewV4(), uuid.NewV4()
+	missing := []*AuditItem{
+		{CopyID: &a, Status: CopyStatusAvailable},
+		{CopyID: &b, Status: CopyStatusOnLoan},
+	}
+
+	tests := []struct {
+		name    string
+		copyIDs []uuid.UUID
+		want    []uuid.UUID
+	}{
+		{name: "All", copyIDs: nil, want: []uuid.UUID{a}},
+		{name: "Chosen", copyIDs: []uuid.UUID{a}, want: []uuid.UUID{a}},
+		{name: "Turned up", copyIDs: []uuid.UUID{b}, want: []uuid.UUID{}},
+		{name: "Not missing", copyIDs: []uuid.UUID{c}, want: []uuid.UUID{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stillMissing(missing, tt.copyIDs)
+			assert.Equal(t, len(got), len(tt.want))
+			for i := range tt.want {
+				if i < len(got) {
+					assert.Equal(t, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/validator"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	ErrAuthorHasBooks = errors.New("author has books")
+)
+
+// Define constants for the ways in which a person can be credited on a book.
+const (
+	AuthorRoleAuthor      = "author"
+	AuthorRoleEditor      = "editor"
+	AuthorRoleTranslator  = "translator"
+	AuthorRoleIllustrator = "illustrator"
+)
+
+var AuthorRoles = []string{AuthorRoleAuthor, AuthorRoleEditor, AuthorRoleTranslator, AuthorRoleIllustrator}
+
+type Author struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"-"`
+	Name           string    `json:"name"`
+	AlternateNames []string  `json:"alternate_names,omitempty"`
+	Bio            string    `json:"bio,omitempty"`
+	Version        int32     `json:"version"`
+}
+
+// BookAuthor credits an author on a book in a particular role. A book lists its
+// authors in the order given by their position.
+type BookAuthor struct {
+	AuthorID uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Role     string    `json:"role"`
+}
+
+// AuthorStatement joins the names of the people credited with the author role, for
+// use as the display value of Book.Author. Names are separated by semicolons, since
+// names in "Last, First" form contain commas.
+func AuthorStatement(credits []*BookAuthor) string {
+	var names []string
+	for _, credit := range credits {
+		if credit.Role == AuthorRoleAuthor {
+			names = append(names, credit.Name)
+		}
+	}
+	return strings.Join(names, "; ")
+}
+
+type AuthorModel struct {
+	DB *sql.DB
+}
+
+func (m AuthorModel) Insert(author *Author) error {
+	query := `
+INSERT INTO authors (name, alternate_names, bio)
+VALUES ($1, $2, $3)
+RETURNING id, created_at, version`
+	args := []any{author.Name, pq.Array(author.AlternateNames), author.Bio}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&author.ID, &author.CreatedAt, &author.Version)
+}
+
+func (m AuthorModel) Get(id uuid.UUID) (*Author, error) {
+	query := `
+SELECT id, created_at, name, alternate_names, bio, version
+FROM authors
+WHERE id = $1`
+	var author Author
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&author.ID,
+		&author.CreatedAt,
+		&author.Name,
+		pq.Array(&author.AlternateNames),
+		&author.Bio,
+		&author.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &author, nil
+}
+
+// GetAll returns a page of authors, optionally filtered by a full-text search on their
+// name or any of their alternate names.
+func (m AuthorModel) GetAll(name string, filters data.Filters) ([]*Author, data.Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), id, created_at, name, alternate_names, bio, version
+FROM authors
+WHERE (to_tsvector('simple', name || ' ' || array_to_string(alternate_names, ' ')) @@ plainto_tsquery('simple', $1) OR $1 = '')
+ORDER BY %s %s, id ASC
+LIMIT $2 OFFSET $3`, filters.SortColumn(), filters.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	authors := []*Author{}
+	for rows.Next() {
+		var author Author
+		err := rows.Scan(
+			&totalRecords,
+			&author.ID,
+			&author.CreatedAt,
+			&author.Name,
+			pq.Array(&author.AlternateNames),
+			&author.Bio,
+			&author.Version,
+		)
+		if err != nil {
+			return nil, data.Metadata{}, err
+		}
+		authors = append(authors, &author)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	metadata := data.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return authors, metadata, nil
+}
+
+func (m AuthorModel) Update(author *Author) error {
+	query := `
+UPDATE authors
+SET name = $1, alternate_names = $2, bio = $3, version = version + 1
+WHERE id = $4 AND version = $5
+RETURNING version`
+	args := []any{author.Name, pq.Array(author.AlternateNames), author.Bio, author.ID, author.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&author.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes an author. Authors who are still credited on a book can't be deleted,
+// and ErrAuthorHasBooks is returned instead.
+func (m AuthorModel) Delete(id uuid.UUID) error {
+	query := `
+DELETE FROM authors WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: update or delete on table "authors" violates foreign key constraint "book_authors_author_id_fkey" on table "book_authors"`:
+			return ErrAuthorHasBooks
+		default:
+			return err
+		}
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllForBook returns the authors credited on a book, in order.
+func (m AuthorModel) GetAllForBook(bookID uuid.UUID) ([]*BookAuthor, error) {
+	query := `
+SELECT authors.id, authors.name, book_authors.role
+FROM book_authors
+INNER JOIN authors ON authors.id = book_authors.author_id
+WHERE book_authors.book_id = $1
+ORDER BY book_authors.position ASC, authors.name ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*BookAuthor{}
+	for rows.Next() {
+		var credit BookAuthor
+		err := rows.Scan(&credit.AuthorID, &credit.Name, &credit.Role)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, &credit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
+
+// setBookAuthors replaces the authors credited on a book with the given list, as part
+// of the transaction which inserts or updates the book. The order of the list is kept.
+func setBookAuthors(ctx context.Context, tx *sql.Tx, bookID uuid.UUID, credits []*BookAuthor) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM book_authors WHERE book_id = $1`, bookID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+INSERT INTO book_authors (book_id, author_id, role, position)
+VALUES ($1, $2, $3, $4)`
+	for i, credit := range credits {
+		_, err = tx.ExecContext(ctx, query, bookID, credit.AuthorID, credit.Role, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authorSeparatorRX splits an author statement into names in the same way as migration
+// 000017: on semicolons and ampersands, but not on commas or "and", which also appear
+// within names such as "Tolkien, J. R. R.".
+var authorSeparatorRX = regexp.MustCompile(`\s*[;&]\s*`)
+
+// splitAuthorStatement returns the distinct names in an author statement, in order.
+func splitAuthorStatement(statement string) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, name := range authorSeparatorRX.Split(statement, -1) {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// creditsFromStatement returns author credits for the names in an author statement,
+// as part of the transaction which inserts a book. Each name is credited to the oldest
+// author with that name, and an author is created for names which aren't known yet.
+func creditsFromStatement(ctx context.Context, tx *sql.Tx, statement string) ([]*BookAuthor, error) {
+	credits := []*BookAuthor{}
+	for _, name := range splitAuthorStatement(statement) {
+		credit := &BookAuthor{Name: name, Role: AuthorRoleAuthor}
+
+		err := tx.QueryRowContext(ctx, `SELECT id FROM authors WHERE name = $1 ORDER BY created_at, id LIMIT 1`, name).Scan(&credit.AuthorID)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = tx.QueryRowContext(ctx, `INSERT INTO authors (name) VALUES ($1) RETURNING id`, name).Scan(&credit.AuthorID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, credit)
+	}
+	return credits, nil
+}
+
+func ValidateAuthor(v *validator.Validator, author *Author) {
+	v.Check(author.Name != "", "name", "must be provided")
+	v.Check(len(author.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	v.Check(len(author.AlternateNames) <= 20, "alternate_names", "must not contain more than 20 names")
+	v.Check(validator.Unique(author.AlternateNames), "alternate_names", "must not contain duplicate values")
+	for _, name := range author.AlternateNames {
+		v.Check(name != "", "alternate_names", "must not contain empty names")
+		v.Check(len(name) <= 500, "alternate_names", "must not contain names more than 500 bytes long")
+	}
+
+	v.Check(len(author.Bio) <= 10000, "bio", "must not be more than 10000 bytes long")
+}
+
+// ValidateBookAuthors checks a list of author credits for a book. Each author may
+// appear more than once, but only in different roles.
+func ValidateBookAuthors(v *validator.Validator, credits []*BookAuthor) {
+	v.Check(len(credits) <= 50, "authors", "must not contain more than 50 entries")
+
+	seen := make(map[string]bool)
+	for _, credit := range credits {
+		v.Check(credit.AuthorID != uuid.Nil, "authors", "must all have an id")
+		v.Check(validator.PermittedValue(credit.Role, AuthorRoles...), "authors", "role must be one of author, editor, translator or illustrator")
+
+		key := credit.AuthorID.String() + credit.Role
+		v.Check(!seen[key], "authors", "must not credit the same author twice in the same role")
+		seen[key] = true
+	}
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Danik14/library/internal/assert"
+	"github.com/Danik14/library/internal/data"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestSplitAuthorStatement(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement string
+		want      []string
+	}{
+		{name: "Single author", statement: "Frank Herbert", want: []string{"Frank Herbert"}},
+		{name: "Inverted name", statement: "Tolkien, J. R. R.", want: []string{"Tolkien, J. R. R."}},
+		{name: "Semicolons", statement: "Pratchett, Terry; Gaiman, Neil", want: []string{"Pratchett, Terry", "Gaiman, Neil"}},
+		{name: "Ampersand", statement: "Terry Pratchett & Neil Gaiman", want: []string{"Terry Pratchett", "Neil Gaiman"}},
+		{name: "And is kept", statement: "Procter and Gamble", want: []string{"Procter and Gamble"}},
+		{name: "Duplicates and empty names", statement: " A ;; B & A ", want: []string{"A", "B"}},
+		{name: "Empty", statement: "", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, strings.Join(splitAuthorStatement(tt.statement), "|"), strings.Join(tt.want, "|"))
+		})
+	}
+}
+
+func TestBookInsertCreditsAuthors(t *testing.T) {
+	db := newTestDB(t)
+	books := BookModel{DB: db}
+	authors := AuthorModel{DB: db}
+
+	existing := &Author{Name: "Test Author " + uuid.NewV4().String()}
+	assert.NilError(t, authors.Insert(existing))
+	cleanup(t, db, `DELETE FROM authors WHERE id = $1`, existing.ID)
+
+	// The new author is created by the insert, and removed once the book has gone.
+	newName := "Test Author " + uuid.NewV4().String()
+	cleanup(t, db, `DELETE FROM authors WHERE name = $1`, newName)
+
+	book := &Book{Title: "Test book", Author: existing.Name + "; " + newName, Year: 2026, Pages: 100, Genres: []string{"fiction"}, ISBN13: newTestISBN13()}
+	assert.NilError(t, books.Insert(book))
+	cleanup(t, db, `
+WITH deleted AS (DELETE FROM books WHERE id = $1 RETURNING work_id)
+DELETE FROM works WHERE id IN (SELECT work_id FROM deleted)`, book.ID)
+
+	assert.Equal(t, len(book.Authors), 2)
+	assert.Equal(t, book.Authors[0].AuthorID, existing.ID)
+	assert.Equal(t, book.Authors[1].Name, newName)
+
+	for _, credit := range book.Authors {
+		credited, _, err := books.GetAllForAuthor(credit.AuthorID, data.Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}})
+		assert.NilError(t, err)
+		assert.Equal(t, len(credited), 1)
+		assert.Equal(t, credited[0].ID, book.ID)
+	}
+}
@@ -5,52 +5,168 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/Danik14/library/internal/cql"
 	"github.com/Danik14/library/internal/data"
 	"github.com/Danik14/library/internal/validator"
 	"github.com/lib/pq"
 	uuid "github.com/satori/go.uuid"
 )
 
+var (
+	ErrDuplicateISBN = errors.New("duplicate isbn")
+)
+
+// BookFormats lists the physical or digital formats an edition can be published in.
+// The empty string means the format hasn't been recorded.
+var BookFormats = []string{"", "hardcover", "paperback", "ebook", "audiobook", "other"}
+
 type Book struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
 	Title     string    `json:"title"`
 	Author    string    `json:"author"`
 	Year      int32     `json:"year,omitempty"`
 	Pages     Pages     `json:"pages,omitempty"`
 	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ISBN10    string    `json:"isbn10,omitempty"`
+	ISBN13    string    `json:"isbn13,omitempty"`
+	// WorkID groups the different editions of the same work. The remaining fields
+	// describe this particular edition.
+	WorkID      uuid.UUID  `json:"work_id"`
+	PublisherID *uuid.UUID `json:"publisher_id,omitempty"`
+	Publisher   string     `json:"publisher,omitempty"`
+	Edition     string     `json:"edition,omitempty"`
+	PublishedOn *CivilTime `json:"published_on,omitempty"`
+	Format      string     `json:"format,omitempty"`
+	Version     int32      `json:"version"`
+	// AvailableCopies is the number of physical copies that are currently on the
+	// shelf. It is calculated on read and never written back to the books table.
+	AvailableCopies int `json:"available_copies"`
+	// Availability breaks the copies of the book down by the branch they are at.
+	Availability []*BranchAvailability `json:"availability,omitempty"`
+	// HoldPosition is the requesting patron's place in the hold queue for this book,
+	// or 0 if they aren't waiting for it.
+	HoldPosition int `json:"hold_position,omitempty"`
+	// AverageRating and RatingsCount summarise the patron reviews of this book. The
+	// average is 0 if the book hasn't been rated yet.
+	AverageRating float64 `json:"average_rating"`
+	RatingsCount  int     `json:"ratings_count"`
+	// Authors lists the people credited on the book. Author holds the display form
+	// of their names. Update() replaces the credits with it unless it is nil. A book
+	// inserted without credits is credited with the authors named in Author.
+	Authors []*BookAuthor `json:"authors,omitempty"`
+	// Editions lists the other editions of the same work.
+	Editions []*Edition `json:"editions,omitempty"`
 }
 
 type BookModel struct {
 	DB *sql.DB
 }
 
-func (b BookModel) Insert(book *Book) error {
-	// return &User{CreatedAt: time.Now(), FirstName: firstName, LastName: lastName, Email: email, HashedPassword: password, DOB: dob, Version: version}, nil
-	// Define the SQL query for inserting a new record in the books table and returning
-	// the system-generated data.
-	query := `INSERT INTO books (title, author, year, pages, genres) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, version;`
-	// Create an args slice containing the values for the placeholder parameters from
-	// the book struct. Declaring this slice immediately next to our SQL query helps to
-	// make it nice and clear *what values are being used where* in the query.
+// Define the SQL query for inserting a new record in the books table and returning the
+// system-generated data. If the book isn't being added as an edition of an existing
+// work, a new work is created for it in the same statement.
+const insertBookQuery = `
+WITH new_work AS (
+	INSERT INTO works (title) SELECT $1 WHERE $8::uuid IS NULL RETURNING id
+)
+INSERT INTO books (title, author, year, pages, genres, isbn10, isbn13, work_id, publisher_id, edition, published_on, format)
+VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), COALESCE($8, (SELECT id FROM new_work)), $9, $10, $11, $12)
+RETURNING id, created_at, work_id, version;`
+
+// insertBookArgs returns the values for the placeholder parameters of insertBookQuery.
+func insertBookArgs(book *Book) []any {
+	var workID *uuid.UUID
+	if book.WorkID != uuid.Nil {
+		workID = &book.WorkID
+	}
+	return []any{book.Title, book.Author, book.Year, book.Pages, pq.Array(book.Genres), book.ISBN10, book.ISBN13,
+		workID, book.PublisherID, book.Edition, book.PublishedOn, book.Format}
+}
 
-	args := []any{book.Title, book.Author, book.Year, book.Pages, pq.Array(book.Genres)}
+// insertBook adds a book and its author credits as part of a transaction. A book
+// without credits is credited with the authors named in Author, which are created if
+// they aren't in the catalog yet, so that every book can be found from its authors.
+func insertBook(ctx context.Context, tx *sql.Tx, book *Book) error {
+	err := tx.QueryRowContext(ctx, insertBookQuery, insertBookArgs(book)...).Scan(&book.ID, &book.CreatedAt, &book.WorkID, &book.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "books_isbn13_idx"`:
+			return ErrDuplicateISBN
+		default:
+			return err
+		}
+	}
+
+	if len(book.Authors) == 0 {
+		book.Authors, err = creditsFromStatement(ctx, tx, book.Author)
+		if err != nil {
+			return err
+		}
+	}
+	return setBookAuthors(ctx, tx, book.ID, book.Authors)
+}
 
+func (b BookModel) Insert(book *Book) error {
 	// Create a context with a 3-second timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Use QueryRowContext() and pass the context as the first argument.
-	return b.DB.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version)
+	// The book and its authors are written in one transaction, so that a book is never
+	// left without the authors it was added with.
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertBook(ctx, tx, book)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertAll adds several books in a single transaction, so that either all of them are
+// added or none are. ErrDuplicateISBN is returned if any of them has the ISBN of a book
+// which is already in the catalog, or of another book in the batch.
+func (b BookModel) InsertAll(books []*Book) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, book := range books {
+		err := insertBook(ctx, tx, book)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (b BookModel) Get(id uuid.UUID) (*Book, error) {
 	// Define the SQL query for retrieving the book data.
 	query := `
-SELECT id, created_at, title, year, author, pages, genres, version FROM books
+SELECT id, created_at, updated_at, title, year, author, pages, genres, COALESCE(isbn10, ''), COALESCE(isbn13, ''),
+work_id, publisher_id, COALESCE((SELECT name FROM publishers WHERE publishers.id = books.publisher_id), ''), edition, published_on, format, version,
+(SELECT count(*) FROM book_copies WHERE book_copies.book_id = books.id AND book_copies.status = 'available'),
+average_rating, ratings_count
+FROM books
+LEFT JOIN LATERAL (
+	SELECT COALESCE(round(avg(rating), 2), 0)::float8 AS average_rating, count(*) AS ratings_count
+	FROM reviews WHERE reviews.book_id = books.id
+) AS ratings ON true
 WHERE id = $1`
 	// Declare a Book struct to hold the data returned by the query.
 	var book Book
@@ -74,7 +190,10 @@ WHERE id = $1`
 	// Book struct. Importantly, notice that we need to convert the scan target for the
 	// genres column using the pq.Array() adapter function again.
 	err := b.DB.QueryRowContext(ctx, query, id).Scan(&book.ID,
-		&book.CreatedAt, &book.Title, &book.Year, &book.Author, &book.Pages, pq.Array(&book.Genres), &book.Version,
+		&book.CreatedAt, &book.UpdatedAt, &book.Title, &book.Year, &book.Author, &book.Pages, pq.Array(&book.Genres),
+		&book.ISBN10, &book.ISBN13,
+		&book.WorkID, &book.PublisherID, &book.Publisher, &book.Edition, &book.PublishedOn, &book.Format,
+		&book.Version, &book.AvailableCopies, &book.AverageRating, &book.RatingsCount,
 	)
 	// Handle any errors. If there was no matching book found, Scan() will return
 	// a sql.ErrNoRows error. We check for this and return our custom ErrRecordNotFound
@@ -91,23 +210,82 @@ WHERE id = $1`
 	return &book, nil
 }
 
+// GetByISBN looks up a book by either form of its ISBN, which may include hyphens.
+// Invalid ISBNs never match a book, so ErrRecordNotFound is returned for them.
+func (b BookModel) GetByISBN(isbn string) (*Book, error) {
+	isbn = NormalizeISBN(isbn)
+	switch {
+	case ValidISBN10(isbn):
+		isbn = ISBN10To13(isbn)
+	case !ValidISBN13(isbn):
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+SELECT id FROM books WHERE isbn13 = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id uuid.UUID
+	err := b.DB.QueryRowContext(ctx, query, isbn).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return b.Get(id)
+}
+
+// bookFilters is the condition shared by GetAll() and Each(). It takes the title,
+// author, genres and branch to filter by as $1 to $4, and ignores those left empty.
+const bookFilters = `(to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+AND (to_tsvector('simple', author) @@ plainto_tsquery('simple', $2) OR $2 = '' OR EXISTS (
+	SELECT 1 FROM book_authors INNER JOIN authors ON authors.id = book_authors.author_id
+	WHERE book_authors.book_id = books.id
+	AND to_tsvector('simple', authors.name || ' ' || array_to_string(authors.alternate_names, ' ')) @@ plainto_tsquery('simple', $2)
+))
+AND NOT EXISTS (
+	SELECT 1 FROM unnest($3::text[]) AS wanted
+	WHERE NOT books.genres && genre_with_descendants(wanted)
+)
+AND ($4::uuid IS NULL OR EXISTS (
+	SELECT 1 FROM book_copies WHERE book_copies.book_id = books.id AND book_copies.current_branch_id = $4
+))`
+
 // Create a new GetAll() method which returns a slice of books. Although we're not
 // using them right now, we've set this up to accept the various filter parameters as
 // arguments.
-func (m BookModel) GetAll(title string, author string, genres []string, filters data.Filters) ([]*Book, data.Metadata, error) {
+// If a branch is given, only books with copies at that branch are returned, and
+// the available copies are counted at that branch alone.
+func (m BookModel) GetAll(title string, author string, genres []string, branchID uuid.UUID, filters data.Filters) ([]*Book, data.Metadata, error) {
 	// Construct the SQL query to retrieve all book records.
 	query := fmt.Sprintf(`
-SELECT count(*) OVER(), id, created_at, title, author, year, pages, genres, version FROM books
-WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-AND (to_tsvector('simple', author) @@ plainto_tsquery('simple', $2) OR $2 = '')
-AND (genres @> $3 OR $3 = '{}')
+SELECT count(*) OVER(), id, created_at, title, author, year, pages, genres, COALESCE(isbn10, ''), COALESCE(isbn13, ''),
+work_id, publisher_id, COALESCE((SELECT name FROM publishers WHERE publishers.id = books.publisher_id), ''), edition, published_on, format, version,
+(SELECT count(*) FROM book_copies WHERE book_copies.book_id = books.id AND book_copies.status = 'available'
+	AND ($4::uuid IS NULL OR book_copies.current_branch_id = $4)),
+average_rating, ratings_count
+FROM books
+LEFT JOIN LATERAL (
+	SELECT COALESCE(round(avg(rating), 2), 0)::float8 AS average_rating, count(*) AS ratings_count
+	FROM reviews WHERE reviews.book_id = books.id
+) AS ratings ON true
+WHERE %s
 ORDER BY %s %s, id ASC
-LIMIT $4 OFFSET $5`, filters.SortColumn(), filters.SortDirection())
+LIMIT $5 OFFSET $6`, bookFilters, filters.SortColumn(), filters.SortDirection())
 	// Create a context with a 3-second timeout.
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, author, pq.Array(genres), filters.Limit(), filters.Offset()}
+	var branch *uuid.UUID
+	if branchID != uuid.Nil {
+		branch = &branchID
+	}
+	args := []any{title, author, pq.Array(genres), branch, filters.Limit(), filters.Offset()}
 
 	// Pass the title and genres as the placeholder parameter values.
 	rows, err := m.DB.QueryContext(ctx, query, args...)
@@ -137,7 +315,18 @@ LIMIT $4 OFFSET $5`, filters.SortColumn(), filters.SortDirection())
 			&book.Year,
 			&book.Pages,
 			pq.Array(&book.Genres),
+			&book.ISBN10,
+			&book.ISBN13,
+			&book.WorkID,
+			&book.PublisherID,
+			&book.Publisher,
+			&book.Edition,
+			&book.PublishedOn,
+			&book.Format,
 			&book.Version,
+			&book.AvailableCopies,
+			&book.AverageRating,
+			&book.RatingsCount,
 		)
 		if err != nil {
 			return nil, data.Metadata{}, err
@@ -159,70 +348,507 @@ LIMIT $4 OFFSET $5`, filters.SortColumn(), filters.SortDirection())
 	return books, metadata, nil
 }
 
+// Each calls fn for every book which matches the same filters as GetAll(), in the
+// order given by the filters. Books are read one row at a time rather than a page at a
+// time, so that the whole catalog can be exported without holding it in memory. The
+// available copies aren't counted. Iteration stops at the first error returned by fn.
+func (m BookModel) Each(title string, author string, genres []string, branchID uuid.UUID, filters data.Filters, fn func(*Book) error) error {
+	query := fmt.Sprintf(`
+SELECT id, created_at, title, author, year, pages, genres, COALESCE(isbn10, ''), COALESCE(isbn13, ''),
+work_id, publisher_id, COALESCE((SELECT name FROM publishers WHERE publishers.id = books.publisher_id), ''), edition, published_on, format, version,
+average_rating, ratings_count
+FROM books
+LEFT JOIN LATERAL (
+	SELECT COALESCE(round(avg(rating), 2), 0)::float8 AS average_rating, count(*) AS ratings_count
+	FROM reviews WHERE reviews.book_id = books.id
+) AS ratings ON true
+WHERE %s
+ORDER BY %s %s, id ASC`, bookFilters, filters.SortColumn(), filters.SortDirection())
+
+	// Exports run for as long as it takes the client to receive them, so they get
+	// much longer than the usual 3 seconds.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	var branch *uuid.UUID
+	if branchID != uuid.Nil {
+		branch = &branchID
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, title, author, pq.Array(genres), branch)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var book Book
+		err := rows.Scan(
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Year,
+			&book.Pages,
+			pq.Array(&book.Genres),
+			&book.ISBN10,
+			&book.ISBN13,
+			&book.WorkID,
+			&book.PublisherID,
+			&book.Publisher,
+			&book.Edition,
+			&book.PublishedOn,
+			&book.Format,
+			&book.Version,
+			&book.AverageRating,
+			&book.RatingsCount,
+		)
+		if err != nil {
+			return err
+		}
+		err = fn(&book)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetAllForAuthor returns a page of the books on which an author is credited, in any
+// role.
+func (m BookModel) GetAllForAuthor(authorID uuid.UUID, filters data.Filters) ([]*Book, data.Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), id, created_at, title, author, year, pages, genres, COALESCE(isbn10, ''), COALESCE(isbn13, ''),
+work_id, publisher_id, COALESCE((SELECT name FROM publishers WHERE publishers.id = books.publisher_id), ''), edition, published_on, format, version,
+(SELECT count(*) FROM book_copies WHERE book_copies.book_id = books.id AND book_copies.status = 'available'),
+average_rating, ratings_count
+FROM books
+LEFT JOIN LATERAL (
+	SELECT COALESCE(round(avg(rating), 2), 0)::float8 AS average_rating, count(*) AS ratings_count
+	FROM reviews WHERE reviews.book_id = books.id
+) AS ratings ON true
+WHERE EXISTS (SELECT 1 FROM book_authors WHERE book_authors.book_id = books.id AND book_authors.author_id = $1)
+ORDER BY %s %s, id ASC
+LIMIT $2 OFFSET $3`, filters.SortColumn(), filters.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, authorID, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	books := []*Book{}
+	for rows.Next() {
+		var book Book
+		err := rows.Scan(
+			&totalRecords,
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Year,
+			&book.Pages,
+			pq.Array(&book.Genres),
+			&book.ISBN10,
+			&book.ISBN13,
+			&book.WorkID,
+			&book.PublisherID,
+			&book.Publisher,
+			&book.Edition,
+			&book.PublishedOn,
+			&book.Format,
+			&book.Version,
+			&book.AvailableCopies,
+			&book.AverageRating,
+			&book.RatingsCount,
+		)
+		if err != nil {
+			return nil, data.Metadata{}, err
+		}
+		books = append(books, &book)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	metadata := data.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return books, metadata, nil
+}
+
+// Harvest returns up to limit books in the order they were last updated, for OAI-PMH
+// harvesting. Only books updated between from and until are returned, either of which
+// can be zero, and with a genre only the books in it or its sub-genres. Books up to
+// and including the one given by afterUpdate and afterID are skipped, so that each
+// batch carries on where the last one ended even if books are added meanwhile.
+func (m BookModel) Harvest(from, until time.Time, genre string, afterUpdate time.Time, afterID uuid.UUID, limit int) ([]*Book, error) {
+	query := `
+SELECT id, created_at, updated_at, title, author, year, pages, genres, COALESCE(isbn10, ''), COALESCE(isbn13, ''),
+work_id, publisher_id, COALESCE((SELECT name FROM publishers WHERE publishers.id = books.publisher_id), ''), edition, published_on, format, version
+FROM books
+WHERE ($1::timestamptz IS NULL OR updated_at >= $1)
+AND ($2::timestamptz IS NULL OR updated_at <= $2)
+AND ($3 = '' OR books.genres && genre_with_descendants($3))
+AND ($4::timestamptz IS NULL OR (updated_at, id) > ($4, $5))
+ORDER BY updated_at ASC, id ASC
+LIMIT $6`
+
+	optional := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+	args := []any{optional(from), optional(until), genre, optional(afterUpdate), afterID, limit}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []*Book{}
+	for rows.Next() {
+		var book Book
+		err := rows.Scan(
+			&book.ID,
+			&book.CreatedAt,
+			&book.UpdatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Year,
+			&book.Pages,
+			pq.Array(&book.Genres),
+			&book.ISBN10,
+			&book.ISBN13,
+			&book.WorkID,
+			&book.PublisherID,
+			&book.Publisher,
+			&book.Edition,
+			&book.PublishedOn,
+			&book.Format,
+			&book.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, &book)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// EarliestUpdate returns the time the least recently updated book was last updated,
+// which harvesters are told is the earliest datestamp in the catalog. The zero time is
+// returned if the catalog is empty.
+func (m BookModel) EarliestUpdate() (time.Time, error) {
+	query := `
+SELECT min(updated_at) FROM books`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var earliest sql.NullTime
+	err := m.DB.QueryRowContext(ctx, query).Scan(&earliest)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return earliest.Time, nil
+}
+
+// Search returns a page of the books matching a CQL query, sorted by title, along with
+// the number of books which match in all. The query is translated into SQL by
+// bookCQLCondition(), so errors wrap one of the cql package's errors if it uses an
+// index or relation which isn't supported. The books are counted separately, so that
+// the total is known even if the page is empty.
+func (m BookModel) Search(query cql.Node, limit, offset int) ([]*Book, int, error) {
+	// The query is translated twice, as the placeholders of the page query follow
+	// its limit and offset, while those of the count query start at $1.
+	countCondition, countArgs, err := cql.Translate(query, 0, bookCQLCondition)
+	if err != nil {
+		return nil, 0, err
+	}
+	condition, args, err := cql.Translate(query, 2, bookCQLCondition)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	total := 0
+	err = m.DB.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT count(*) FROM books WHERE %s`, countCondition), countArgs...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	books := []*Book{}
+	if limit == 0 || offset >= total {
+		return books, total, nil
+	}
+
+	stmt := fmt.Sprintf(`
+SELECT id, created_at, updated_at, title, author, year, pages, genres, COALESCE(isbn10, ''), COALESCE(isbn13, ''),
+work_id, publisher_id, COALESCE((SELECT name FROM publishers WHERE publishers.id = books.publisher_id), ''), edition, published_on, format, version
+FROM books
+WHERE %s
+ORDER BY title ASC, id ASC
+LIMIT $1 OFFSET $2`, condition)
+
+	rows, err := m.DB.QueryContext(ctx, stmt, append([]any{limit, offset}, args...)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var book Book
+		err := rows.Scan(
+			&book.ID,
+			&book.CreatedAt,
+			&book.UpdatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Year,
+			&book.Pages,
+			pq.Array(&book.Genres),
+			&book.ISBN10,
+			&book.ISBN13,
+			&book.WorkID,
+			&book.PublisherID,
+			&book.Publisher,
+			&book.Edition,
+			&book.PublishedOn,
+			&book.Format,
+			&book.Version,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		books = append(books, &book)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return books, total, nil
+}
+
+// cqlIndexes maps the CQL index names we accept, with or without the prefix of the Dublin
+// Core or Bath context sets, to the field they search.
+var cqlIndexes = map[string]string{
+	cql.ServerChoice: "any",
+	"cql.anywhere":   "any",
+	"title":          "title",
+	"dc.title":       "title",
+	"bath.title":     "title",
+	"author":         "author",
+	"creator":        "author",
+	"dc.creator":     "author",
+	"bath.author":    "author",
+	"bath.name":      "author",
+	"subject":        "subject",
+	"dc.subject":     "subject",
+	"bath.subject":   "subject",
+	"isbn":           "isbn",
+	"bath.isbn":      "isbn",
+}
+
+// bookCQLCondition translates a CQL search clause into a condition on the books table.
+// Titles and authors are searched through the same full-text indexes as GetAll(): "="
+// and "all" match books with every word of the term, "any" those with any of them, and
+// "adj", "==" and "exact" the words as a phrase. Subjects match the genre or any of its
+// sub-genres, and ISBNs can be given in either form. "<>" negates any of them.
+func bookCQLCondition(clause *cql.Clause, arg func(any) string) (string, error) {
+	if clause.Masked {
+		return "", cql.ErrMasking
+	}
+	field, ok := cqlIndexes[clause.Index]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", cql.ErrUnsupportedIndex, clause.Index)
+	}
+
+	negate := clause.Relation == "<>"
+	relation := clause.Relation
+	if negate {
+		relation = "="
+	}
+
+	var condition string
+	switch field {
+	case "title", "author", "any":
+		var tsquery string
+		switch relation {
+		case "=", "all":
+			tsquery = fmt.Sprintf("plainto_tsquery('simple', %s)", arg(clause.Term))
+		case "adj", "==", "exact":
+			tsquery = fmt.Sprintf("phraseto_tsquery('simple', %s)", arg(clause.Term))
+		case "any":
+			words := strings.Fields(clause.Term)
+			if len(words) == 0 {
+				words = []string{""}
+			}
+			queries := make([]string, len(words))
+			for i, word := range words {
+				queries[i] = fmt.Sprintf("plainto_tsquery('simple', %s)", arg(word))
+			}
+			tsquery = "(" + strings.Join(queries, " || ") + ")"
+		default:
+			return "", fmt.Errorf("%w: %s", cql.ErrUnsupportedRelation, clause.Relation)
+		}
+
+		title := fmt.Sprintf("to_tsvector('simple', title) @@ %s", tsquery)
+		author := fmt.Sprintf(`(to_tsvector('simple', author) @@ %s OR EXISTS (
+	SELECT 1 FROM book_authors INNER JOIN authors ON authors.id = book_authors.author_id
+	WHERE book_authors.book_id = books.id
+	AND to_tsvector('simple', authors.name || ' ' || array_to_string(authors.alternate_names, ' ')) @@ %s
+))`, tsquery, tsquery)
+		switch field {
+		case "title":
+			condition = title
+		case "author":
+			condition = author
+		default:
+			condition = "(" + title + " OR " + author + ")"
+		}
+	case "subject":
+		switch relation {
+		case "=", "==", "exact", "adj", "all":
+		default:
+			return "", fmt.Errorf("%w: %s", cql.ErrUnsupportedRelation, clause.Relation)
+		}
+		condition = fmt.Sprintf("books.genres && genre_with_descendants(%s)", arg(NormalizeGenre(clause.Term)))
+	case "isbn":
+		switch relation {
+		case "=", "==", "exact":
+		default:
+			return "", fmt.Errorf("%w: %s", cql.ErrUnsupportedRelation, clause.Relation)
+		}
+		isbn := NormalizeISBN(clause.Term)
+		if ValidISBN10(isbn) {
+			isbn = ISBN10To13(isbn)
+		}
+		condition = fmt.Sprintf("COALESCE(isbn13 = %s, false)", arg(isbn))
+	}
+
+	if negate {
+		return "NOT " + condition, nil
+	}
+	return condition, nil
+}
+
 func (b BookModel) Update(book *Book) error {
 	// Declare the SQL query for updating the record and returning the new version
-	// number.
+	// number, along with the work the book belonged to before.
 	query := `
+WITH previous AS (
+	SELECT work_id FROM books WHERE id = $13
+)
 UPDATE books
-SET title = $1, author = $2, year = $3, pages = $4, genres = $5, version = version + 1
-WHERE id = $6 AND version = $7
-RETURNING version`
+SET title = $1, author = $2, year = $3, pages = $4, genres = $5, isbn10 = NULLIF($6, ''), isbn13 = NULLIF($7, ''),
+work_id = $8, publisher_id = $9, edition = $10, published_on = $11, format = $12, updated_at = NOW(), version = version + 1
+WHERE id = $13 AND version = $14
+RETURNING updated_at, version, (SELECT work_id FROM previous)`
 	// Create an args slice containing the values for the placeholder parameters.
 	args := []any{book.Title, book.Author,
-		book.Year, book.Pages, pq.Array(book.Genres), book.ID, book.Version,
+		book.Year, book.Pages, pq.Array(book.Genres), book.ISBN10, book.ISBN13,
+		book.WorkID, book.PublisherID, book.Edition, book.PublishedOn, book.Format, book.ID, book.Version,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// Execute the SQL query. If no matching row could be found, we know the book
 	// version has changed (or the record has been deleted) and we return our custom
 	// ErrEditConflict error.
-	err := b.DB.QueryRowContext(ctx, query, args...).Scan(&book.Version)
+	var previousWorkID uuid.UUID
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&book.UpdatedAt, &book.Version, &previousWorkID)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "books_isbn13_idx"`:
+			return ErrDuplicateISBN
 		default:
 			return err
 		}
 	}
 
-	return nil
+	// Moving the last edition of a work to another work leaves nothing behind.
+	if previousWorkID != book.WorkID {
+		err = deleteWorkIfEmpty(ctx, tx, previousWorkID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if book.Authors != nil {
+		err = setBookAuthors(ctx, tx, book.ID, book.Authors)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (b BookModel) Delete(id uuid.UUID) error {
-	// Return an ErrRecordNotFound error if the book ID is less than 1.
-	// Construct the SQL query to delete the record.
+	// Construct the SQL query to delete the record, returning the work it was an
+	// edition of.
 	query := `
-DELETE FROM books WHERE id = $1`
-	// Execute the SQL query using the Exec() method, passing in the id variable as
-	// the value for the placeholder parameter. The Exec() method returns a sql.Result
-	// object.
+DELETE FROM books WHERE id = $1
+RETURNING work_id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := b.DB.ExecContext(ctx, query, id)
+	tx, err := b.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	// Call the RowsAffected() method on the sql.Result object to get the number of rows
-	// affected by the query.
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-	// If no rows were affected, we know that the books table didn't contain a record
+	defer tx.Rollback()
+
+	// If no row was deleted, we know that the books table didn't contain a record
 	// with the provided ID at the moment we tried to delete it. In that case we
 	// return an ErrRecordNotFound error.
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	var workID uuid.UUID
+	err = tx.QueryRowContext(ctx, query, id).Scan(&workID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
 	}
-	return nil
+
+	// Deleting the last edition of a work deletes the work as well.
+	err = deleteWorkIfEmpty(ctx, tx, workID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func ValidateBook(v *validator.Validator, book *Book) {
+// ValidateBook checks a book before it is saved. If a genre taxonomy is given, the
+// book's genres must all be known genres (or synonyms of them), and are replaced with
+// the genres' canonical names.
+func ValidateBook(v *validator.Validator, book *Book, taxonomy GenreTaxonomy) {
 	// Use the Check() method to execute our validation checks. This will add the
 	// provided key and error message to the errors map if the check does not evaluate
 	// to true. For example, in the first line here we "check that the title is not
@@ -236,6 +862,51 @@ func ValidateBook(v *validator.Validator, book *Book) {
 
 	v.Check(book.Year > 0, "year", "must be more than 0")
 	v.Check(book.Pages > 0, "pages", "must be more than 0")
+
+	v.Check(len(book.Genres) >= 1, "genres", "must contain at least 1 genre")
+	v.Check(len(book.Genres) <= 5, "genres", "must not contain more than 5 genres")
+	if taxonomy != nil {
+		for i, genre := range book.Genres {
+			canonical, ok := taxonomy.Canonical(genre)
+			if !ok {
+				v.AddError("genres", fmt.Sprintf("%q is not a known genre", genre))
+				continue
+			}
+			book.Genres[i] = canonical
+		}
+	}
+	v.Check(validator.Unique(book.Genres), "genres", "must not contain duplicate values")
+
+	validateISBN(v, book)
+
+	v.Check(len(book.Edition) <= 200, "edition", "must not be more than 200 bytes long")
+	v.Check(validator.PermittedValue(book.Format, BookFormats...), "format", "must be one of hardcover, paperback, ebook, audiobook or other")
+}
+
+// validateISBN checks the check digits of the book's ISBNs and stores them in their
+// normalized form. When only one form is given the other is filled in from it, and
+// when both are given they must identify the same book.
+func validateISBN(v *validator.Validator, book *Book) {
+	book.ISBN10 = NormalizeISBN(book.ISBN10)
+	book.ISBN13 = NormalizeISBN(book.ISBN13)
+
+	if book.ISBN10 != "" && !ValidISBN10(book.ISBN10) {
+		v.AddError("isbn10", "must be a valid ISBN-10")
+		return
+	}
+	if book.ISBN13 != "" && !ValidISBN13(book.ISBN13) {
+		v.AddError("isbn13", "must be a valid ISBN-13")
+		return
+	}
+
+	switch {
+	case book.ISBN10 != "" && book.ISBN13 == "":
+		book.ISBN13 = ISBN10To13(book.ISBN10)
+	case book.ISBN13 != "" && book.ISBN10 == "":
+		book.ISBN10, _ = ISBN13To10(book.ISBN13)
+	case book.ISBN10 != "" && book.ISBN13 != "":
+		v.Check(ISBN10To13(book.ISBN10) == book.ISBN13, "isbn13", "must be the same book as isbn10")
+	}
 }
 
 type MockBookModel struct{}
@@ -244,6 +915,10 @@ func (b MockBookModel) Insert(book *Book) error {
 	return nil
 }
 
+func (b MockBookModel) InsertAll(books []*Book) error {
+	return nil
+}
+
 func (b MockBookModel) Get(id uuid.UUID) (*Book, error) {
 	switch id {
 	case uuid.UUID{}:
@@ -259,6 +934,10 @@ func (b MockBookModel) Get(id uuid.UUID) (*Book, error) {
 		return nil, ErrRecordNotFound
 	}
 }
+func (b MockBookModel) GetByISBN(isbn string) (*Book, error) {
+	return nil, ErrRecordNotFound
+}
+
 func (b MockBookModel) Update(book *Book) error {
 	return nil
 }
@@ -272,6 +951,26 @@ func (b MockBookModel) Delete(id uuid.UUID) error {
 	}
 }
 
-func (b MockBookModel) GetAll(title string, author string, genres []string, filters data.Filters) ([]*Book, data.Metadata, error) {
+func (b MockBookModel) GetAll(title string, author string, genres []string, branchID uuid.UUID, filters data.Filters) ([]*Book, data.Metadata, error) {
+	return nil, data.Metadata{}, nil
+}
+
+func (b MockBookModel) Each(title string, author string, genres []string, branchID uuid.UUID, filters data.Filters, fn func(*Book) error) error {
+	return nil
+}
+
+func (b MockBookModel) GetAllForAuthor(authorID uuid.UUID, filters data.Filters) ([]*Book, data.Metadata, error) {
 	return nil, data.Metadata{}, nil
 }
+
+func (b MockBookModel) Harvest(from, until time.Time, genre string, afterUpdate time.Time, afterID uuid.UUID, limit int) ([]*Book, error) {
+	return nil, nil
+}
+
+func (b MockBookModel) EarliestUpdate() (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (b MockBookModel) Search(query cql.Node, limit, offset int) ([]*Book, int, error) {
+	return nil, 0, nil
+}
@@ -0,0 +1,294 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	ErrDuplicateBranch    = errors.New("duplicate branch")
+	ErrBranchHasCopies    = errors.New("branch has copies")
+	ErrBranchHasTransfers = errors.New("branch has transfers")
+	ErrBranchHasOrders    = errors.New("branch has purchase orders")
+)
+
+var (
+	Weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+	// Opening and closing times are given on the 24-hour clock, e.g. "09:30".
+	ClockTimeRX = regexp.MustCompile("^([01][0-9]|2[0-3]):[0-5][0-9]$")
+)
+
+// OpeningPeriod is a span of time during which a branch is open on a given day, in the
+// branch's own timezone.
+type OpeningPeriod struct {
+	Opens  string `json:"opens"`
+	Closes string `json:"closes"`
+}
+
+// OpeningHours maps the lowercase weekday names to the periods the branch is open on
+// that day. A branch can open more than once a day, e.g. when it closes for lunch, and
+// is closed on days which are missing from the map.
+type OpeningHours map[string][]OpeningPeriod
+
+// Value implements the driver.Valuer interface, so that opening hours are stored in a
+// jsonb column.
+func (h OpeningHours) Value() (driver.Value, error) {
+	if h == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(h)
+}
+
+// Scan implements the sql.Scanner interface for reading opening hours back from a
+// jsonb column.
+func (h *OpeningHours) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into OpeningHours", src)
+	}
+	return json.Unmarshal(b, h)
+}
+
+type Branch struct {
+	ID           uuid.UUID    `json:"id"`
+	CreatedAt    time.Time    `json:"-"`
+	Name         string       `json:"name"`
+	Address      string       `json:"address,omitempty"`
+	OpeningHours OpeningHours `json:"opening_hours"`
+	Timezone     string       `json:"timezone"`
+	Version      int32        `json:"version"`
+}
+
+// BranchAvailability counts the copies of a book which are currently located at a
+// branch, and how many of them are on the shelf.
+type BranchAvailability struct {
+	BranchID  uuid.UUID `json:"branch_id"`
+	Name      string    `json:"name"`
+	Available int       `json:"available"`
+	Total     int       `json:"total"`
+}
+
+type BranchModel struct {
+	DB *sql.DB
+}
+
+func (m BranchModel) Insert(branch *Branch) error {
+	query := `
+INSERT INTO branches (name, address, opening_hours, timezone)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at, version`
+	args := []any{branch.Name, branch.Address, branch.OpeningHours, branch.Timezone}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&branch.ID, &branch.CreatedAt, &branch.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "branches_name_key"`:
+			return ErrDuplicateBranch
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m BranchModel) Get(id uuid.UUID) (*Branch, error) {
+	query := `
+SELECT id, created_at, name, address, opening_hours, timezone, version
+FROM branches
+WHERE id = $1`
+	var branch Branch
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&branch.ID,
+		&branch.CreatedAt,
+		&branch.Name,
+		&branch.Address,
+		&branch.OpeningHours,
+		&branch.Timezone,
+		&branch.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &branch, nil
+}
+
+// GetAll returns every branch, ordered by name. Libraries only have a handful of
+// branches, so the list isn't paginated.
+func (m BranchModel) GetAll() ([]*Branch, error) {
+	query := `
+SELECT id, created_at, name, address, opening_hours, timezone, version
+FROM branches
+ORDER BY name ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	branches := []*Branch{}
+	for rows.Next() {
+		var branch Branch
+		err := rows.Scan(
+			&branch.ID,
+			&branch.CreatedAt,
+			&branch.Name,
+			&branch.Address,
+			&branch.OpeningHours,
+			&branch.Timezone,
+			&branch.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		branches = append(branches, &branch)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return branches, nil
+}
+
+func (m BranchModel) Update(branch *Branch) error {
+	query := `
+UPDATE branches
+SET name = $1, address = $2, opening_hours = $3, timezone = $4, version = version + 1
+WHERE id = $5 AND version = $6
+RETURNING version`
+	args := []any{branch.Name, branch.Address, branch.OpeningHours, branch.Timezone, branch.ID, branch.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&branch.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "branches_name_key"`:
+			return ErrDuplicateBranch
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a branch. Branches which are the home or current location of any
+// copy can't be deleted, and ErrBranchHasCopies is returned instead. Likewise,
+// ErrBranchHasTransfers is returned for branches which copies have been sent from or
+// to, and ErrBranchHasOrders for branches which books have been ordered for.
+func (m BranchModel) Delete(id uuid.UUID) error {
+	query := `
+DELETE FROM branches WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: update or delete on table "branches" violates foreign key constraint "book_copies_home_branch_id_fkey" on table "book_copies"`,
+			err.Error() == `pq: update or delete on table "branches" violates foreign key constraint "book_copies_current_branch_id_fkey" on table "book_copies"`:
+			return ErrBranchHasCopies
+		case err.Error() == `pq: update or delete on table "branches" violates foreign key constraint "transfers_from_branch_id_fkey" on table "transfers"`,
+			err.Error() == `pq: update or delete on table "branches" violates foreign key constraint "transfers_to_branch_id_fkey" on table "transfers"`:
+			return ErrBranchHasTransfers
+		case err.Error() == `pq: update or delete on table "branches" violates foreign key constraint "purchase_orders_branch_id_fkey" on table "purchase_orders"`:
+			return ErrBranchHasOrders
+		default:
+			return err
+		}
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// AvailabilityForBook breaks the copies of a book down by the branch they are
+// currently at. Branches without any copies of the book are left out.
+func (m BranchModel) AvailabilityForBook(bookID uuid.UUID) ([]*BranchAvailability, error) {
+	query := `
+SELECT branches.id, branches.name,
+count(*) FILTER (WHERE book_copies.status = 'available'), count(*)
+FROM book_copies
+INNER JOIN branches ON branches.id = book_copies.current_branch_id
+WHERE book_copies.book_id = $1
+GROUP BY branches.id, branches.name
+ORDER BY branches.name ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	availability := []*BranchAvailability{}
+	for rows.Next() {
+		var a BranchAvailability
+		err := rows.Scan(&a.BranchID, &a.Name, &a.Available, &a.Total)
+		if err != nil {
+			return nil, err
+		}
+		availability = append(availability, &a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return availability, nil
+}
+
+func ValidateBranch(v *validator.Validator, branch *Branch) {
+	v.Check(branch.Name != "", "name", "must be provided")
+	v.Check(len(branch.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(branch.Address) <= 1000, "address", "must not be more than 1000 bytes long")
+
+	v.Check(branch.Timezone != "", "timezone", "must be provided")
+	if _, err := time.LoadLocation(branch.Timezone); err != nil {
+		v.AddError("timezone", "must be a valid IANA timezone name")
+	}
+
+	for day, periods := range branch.OpeningHours {
+		v.Check(validator.PermittedValue(day, Weekdays...), "opening_hours", fmt.Sprintf("%q is not a day of the week", day))
+		for _, period := range periods {
+			if !validator.Matches(period.Opens, ClockTimeRX) || !validator.Matches(period.Closes, ClockTimeRX) {
+				v.AddError("opening_hours", "times must be given as HH:MM")
+				continue
+			}
+			// The times are zero-padded, so they can be compared as strings.
+			v.Check(period.Opens < period.Closes, "opening_hours", fmt.Sprintf("opening time must be before closing time on %s", day))
+		}
+	}
+}
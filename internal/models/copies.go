@@ -0,0 +1,269 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	ErrDuplicateBarcode         = errors.New("duplicate barcode")
+	ErrDuplicateAccessionNumber = errors.New("duplicate accession number")
+)
+
+// Define constants for the circulation status of a physical copy.
+const (
+	CopyStatusAvailable = "available"
+	CopyStatusOnLoan    = "on_loan"
+	CopyStatusOnHold    = "on_hold"
+	CopyStatusInTransit = "in_transit"
+	CopyStatusLost      = "lost"
+	CopyStatusWithdrawn = "withdrawn"
+)
+
+var (
+	CopyStatuses   = []string{CopyStatusAvailable, CopyStatusOnLoan, CopyStatusOnHold, CopyStatusInTransit, CopyStatusLost, CopyStatusWithdrawn}
+	CopyConditions = []string{"new", "good", "fair", "poor", "damaged"}
+	// Copies only move in and out of these statuses through the loans, holds and
+	// transfers workflows, never by editing the copy directly.
+	CopyCirculationStatuses = []string{CopyStatusOnLoan, CopyStatusOnHold, CopyStatusInTransit}
+	// Item types are short lowercase identifiers such as "book", "dvd" or
+	// "reference", used to look up the circulation rules for a copy.
+	ItemTypeRX = regexp.MustCompile("^[a-z][a-z0-9_-]*$")
+)
+
+// DefaultItemType is the item type given to copies when none is specified.
+const DefaultItemType = "book"
+
+// BookCopy is a single physical item on the shelf. Every copy belongs to exactly one
+// bibliographic record in the books table.
+type BookCopy struct {
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"-"`
+	BookID          uuid.UUID `json:"book_id"`
+	Barcode         string    `json:"barcode"`
+	AccessionNumber string    `json:"accession_number"`
+	ItemType        string    `json:"item_type"`
+	// ShelfMark is the call number on the spine label, which orders the copies on the
+	// shelves of their branch.
+	ShelfMark string `json:"shelf_mark"`
+	// HomeBranchID is the branch that owns the copy, and CurrentBranchID is the branch
+	// where it is located right now.
+	HomeBranchID    uuid.UUID `json:"home_branch_id"`
+	CurrentBranchID uuid.UUID `json:"current_branch_id"`
+	Condition       string    `json:"condition"`
+	Status          string    `json:"status"`
+	Version         int32     `json:"version"`
+}
+
+type BookCopyModel struct {
+	DB *sql.DB
+}
+
+const insertCopyQuery = `
+INSERT INTO book_copies (book_id, barcode, accession_number, item_type, shelf_mark, home_branch_id, current_branch_id, condition, status)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, created_at, version`
+
+// insertCopyArgs returns the values for the placeholder parameters of insertCopyQuery.
+func insertCopyArgs(bookCopy *BookCopy) []any {
+	return []any{bookCopy.BookID, bookCopy.Barcode, bookCopy.AccessionNumber, bookCopy.ItemType, bookCopy.ShelfMark,
+		bookCopy.HomeBranchID, bookCopy.CurrentBranchID, bookCopy.Condition, bookCopy.Status}
+}
+
+func (m BookCopyModel) Insert(bookCopy *BookCopy) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, insertCopyQuery, insertCopyArgs(bookCopy)...).Scan(&bookCopy.ID, &bookCopy.CreatedAt, &bookCopy.Version)
+	if err != nil {
+		return copyConstraintError(err)
+	}
+	return nil
+}
+
+func (m BookCopyModel) Get(id uuid.UUID) (*BookCopy, error) {
+	query := `
+SELECT id, created_at, book_id, barcode, accession_number, item_type, shelf_mark, home_branch_id, current_branch_id, condition, status, version
+FROM book_copies
+WHERE id = $1`
+	var bookCopy BookCopy
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&bookCopy.ID,
+		&bookCopy.CreatedAt,
+		&bookCopy.BookID,
+		&bookCopy.Barcode,
+		&bookCopy.AccessionNumber,
+		&bookCopy.ItemType,
+		&bookCopy.ShelfMark,
+		&bookCopy.HomeBranchID,
+		&bookCopy.CurrentBranchID,
+		&bookCopy.Condition,
+		&bookCopy.Status,
+		&bookCopy.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &bookCopy, nil
+}
+
+// GetByBarcode looks up a copy by the barcode on its label, as read by a scanner.
+func (m BookCopyModel) GetByBarcode(barcode string) (*BookCopy, error) {
+	query := `
+SELECT id FROM book_copies WHERE barcode = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id uuid.UUID
+	err := m.DB.QueryRowContext(ctx, query, barcode).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return m.Get(id)
+}
+
+// GetAllForBook returns every copy of a specific book, ordered by accession number.
+func (m BookCopyModel) GetAllForBook(bookID uuid.UUID) ([]*BookCopy, error) {
+	query := `
+SELECT id, created_at, book_id, barcode, accession_number, item_type, shelf_mark, home_branch_id, current_branch_id, condition, status, version
+FROM book_copies
+WHERE book_id = $1
+ORDER BY accession_number ASC, id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	copies := []*BookCopy{}
+	for rows.Next() {
+		var bookCopy BookCopy
+		err := rows.Scan(
+			&bookCopy.ID,
+			&bookCopy.CreatedAt,
+			&bookCopy.BookID,
+			&bookCopy.Barcode,
+			&bookCopy.AccessionNumber,
+			&bookCopy.ItemType,
+			&bookCopy.ShelfMark,
+			&bookCopy.HomeBranchID,
+			&bookCopy.CurrentBranchID,
+			&bookCopy.Condition,
+			&bookCopy.Status,
+			&bookCopy.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, &bookCopy)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+func (m BookCopyModel) Update(bookCopy *BookCopy) error {
+	query := `
+UPDATE book_copies
+SET barcode = $1, accession_number = $2, item_type = $3, shelf_mark = $4, home_branch_id = $5, current_branch_id = $6, condition = $7,
+status = $8, version = version + 1
+WHERE id = $9 AND version = $10
+RETURNING version`
+	args := []any{bookCopy.Barcode, bookCopy.AccessionNumber, bookCopy.ItemType, bookCopy.ShelfMark, bookCopy.HomeBranchID, bookCopy.CurrentBranchID,
+		bookCopy.Condition, bookCopy.Status, bookCopy.ID, bookCopy.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&bookCopy.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return copyConstraintError(err)
+		}
+	}
+	return nil
+}
+
+func (m BookCopyModel) Delete(id uuid.UUID) error {
+	query := `
+DELETE FROM book_copies WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// copyConstraintError translates unique constraint violations on the book_copies
+// table into our custom errors, so that handlers can report them as validation
+// failures.
+func copyConstraintError(err error) error {
+	switch {
+	case err.Error() == `pq: duplicate key value violates unique constraint "book_copies_barcode_key"`:
+		return ErrDuplicateBarcode
+	case err.Error() == `pq: duplicate key value violates unique constraint "book_copies_accession_number_key"`:
+		return ErrDuplicateAccessionNumber
+	default:
+		return err
+	}
+}
+
+func ValidateBookCopy(v *validator.Validator, bookCopy *BookCopy) {
+	v.Check(bookCopy.Barcode != "", "barcode", "must be provided")
+	v.Check(len(bookCopy.Barcode) <= 100, "barcode", "must not be more than 100 bytes long")
+
+	v.Check(bookCopy.AccessionNumber != "", "accession_number", "must be provided")
+	v.Check(len(bookCopy.AccessionNumber) <= 100, "accession_number", "must not be more than 100 bytes long")
+
+	v.Check(bookCopy.ItemType != "", "item_type", "must be provided")
+	v.Check(len(bookCopy.ItemType) <= 50, "item_type", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(bookCopy.ItemType, ItemTypeRX), "item_type", "must be a lowercase identifier")
+
+	v.Check(len(bookCopy.ShelfMark) <= 100, "shelf_mark", "must not be more than 100 bytes long")
+
+	v.Check(bookCopy.HomeBranchID != uuid.Nil, "home_branch_id", "must be provided")
+	v.Check(bookCopy.CurrentBranchID != uuid.Nil, "current_branch_id", "must be provided")
+
+	v.Check(validator.PermittedValue(bookCopy.Condition, CopyConditions...), "condition", "invalid condition value")
+	v.Check(validator.PermittedValue(bookCopy.Status, CopyStatuses...), "status", "invalid status value")
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/Danik14/library/internal/validator"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	ErrDuplicateResourceURL = errors.New("duplicate resource url")
+)
+
+// DigitalMediaTypes lists the media types of the digital resources we can offer, which
+// are the formats e-reader apps know how to open.
+var DigitalMediaTypes = []string{
+	"application/epub+zip",
+	"application/pdf",
+	"application/x-mobipocket-ebook",
+	"application/audiobook+zip",
+	"audio/mpeg",
+	"text/html",
+}
+
+// DigitalResource is a file or web page through which a book can be read or listened
+// to without a physical copy, such as an EPUB download.
+type DigitalResource struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	BookID    uuid.UUID `json:"book_id"`
+	URL       string    `json:"url"`
+	MediaType string    `json:"media_type"`
+	SizeBytes int64     `json:"size_bytes,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+type DigitalResourceModel struct {
+	DB *sql.DB
+}
+
+func (m DigitalResourceModel) Insert(resource *DigitalResource) error {
+	query := `
+INSERT INTO digital_resources (book_id, url, media_type, size_bytes)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at, version`
+	args := []any{resource.BookID, resource.URL, resource.MediaType, resource.SizeBytes}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&resource.ID, &resource.CreatedAt, &resource.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "digital_resources_book_id_url_key"`:
+			return ErrDuplicateResourceURL
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m DigitalResourceModel) Get(id uuid.UUID) (*DigitalResource, error) {
+	query := `
+SELECT id, created_at, book_id, url, media_type, size_bytes, version
+FROM digital_resources
+WHERE id = $1`
+	var resource DigitalResource
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&resource.ID,
+		&resource.CreatedAt,
+		&resource.BookID,
+		&resource.URL,
+		&resource.MediaType,
+		&resource.SizeBytes,
+		&resource.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &resource, nil
+}
+
+// GetAllForBooks returns the digital resources of several books at once, keyed by
+// book ID, so that a page of books can be listed with one query. Books without
+// digital resources are left out of the map.
+func (m DigitalResourceModel) GetAllForBooks(bookIDs []uuid.UUID) (map[uuid.UUID][]*DigitalResource, error) {
+	query := `
+SELECT id, created_at, book_id, url, media_type, size_bytes, version
+FROM digital_resources
+WHERE book_id = ANY($1::uuid[])
+ORDER BY created_at ASC, id ASC`
+
+	ids := make([]string, len(bookIDs))
+	for i, id := range bookIDs {
+		ids[i] = id.String()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resources := map[uuid.UUID][]*DigitalResource{}
+	for rows.Next() {
+		var resource DigitalResource
+		err := rows.Scan(
+			&resource.ID,
+			&resource.CreatedAt,
+			&resource.BookID,
+			&resource.URL,
+			&resource.MediaType,
+			&resource.SizeBytes,
+			&resource.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		resources[resource.BookID] = append(resources[resource.BookID], &resource)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+func (m DigitalResourceModel) Delete(id uuid.UUID) error {
+	query := `
+DELETE FROM digital_resources WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func ValidateDigitalResource(v *validator.Validator, resource *DigitalResource) {
+	v.Check(resource.URL != "", "url", "must be provided")
+	v.Check(len(resource.URL) <= 2000, "url", "must not be more than 2000 bytes long")
+	u, err := url.Parse(resource.URL)
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+
+	v.Check(validator.PermittedValue(resource.MediaType, DigitalMediaTypes...), "media_type", "invalid media type value")
+	v.Check(resource.SizeBytes >= 0, "size_bytes", "must not be negative")
+}
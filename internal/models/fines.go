@@ -0,0 +1,479 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Define constants for the kinds of entry in the fines ledger. Charges increase what
+// a patron owes, payments and waivers reduce it.
+const (
+	FineKindCharge  = "charge"
+	FineKindPayment = "payment"
+	FineKindWaiver  = "waiver"
+)
+
+// Define constants for the status of a charge. A charge is outstanding until all of
+// it has been waived.
+const (
+	FineStatusOutstanding = "outstanding"
+	FineStatusWaived      = "waived"
+)
+
+// DefaultFineRule is the item type of the rule which applies to every item type that
+// doesn't have a rule of its own.
+const DefaultFineRule = "default"
+
+// FineRule holds the overdue fine settings for one item type. All amounts are in minor
+// currency units.
+type FineRule struct {
+	ItemType  string `json:"item_type"`
+	DailyRate int64  `json:"daily_rate"`
+	GraceDays int    `json:"grace_days"`
+	MaxAmount int64  `json:"max_amount"`
+	Version   int32  `json:"version"`
+}
+
+// Calculate returns the total fine for an item which was due at dueAt and was (or
+// still isn't) returned at returnedAt. Every started day counts as a full day late,
+// the first GraceDays days are free, and the total is capped at MaxAmount.
+func (r FineRule) Calculate(dueAt, returnedAt time.Time) int64 {
+	if !returnedAt.After(dueAt) {
+		return 0
+	}
+	daysLate := int64(math.Ceil(returnedAt.Sub(dueAt).Hours() / 24))
+	chargeable := daysLate - int64(r.GraceDays)
+	if chargeable <= 0 {
+		return 0
+	}
+	amount := chargeable * r.DailyRate
+	if amount > r.MaxAmount {
+		return r.MaxAmount
+	}
+	return amount
+}
+
+// Owed returns how much is still to be charged for a loan which is due at dueAt, as of
+// asOf, given the charges made for the loan so far. The days a loan was late before it
+// was renewed were charged against the old due date and stay charged, so only the days
+// late since dueAt which haven't been charged yet are owed. The grace period is given
+// once per loan: it doesn't start again after a renewal once anything has been charged.
+// MaxAmount caps the total of all the charges on the loan, however often it's renewed.
+func (r FineRule) Owed(dueAt, asOf time.Time, charges []*Fine) int64 {
+	var charged, chargedBefore int64
+	for _, charge := range charges {
+		if charge.Kind != FineKindCharge {
+			continue
+		}
+		charged += charge.Amount
+		if charge.DueAt == nil || !charge.DueAt.Equal(dueAt) {
+			chargedBefore += charge.Amount
+		}
+	}
+
+	rule := r
+	if chargedBefore > 0 {
+		rule.GraceDays = 0
+	}
+	owed := rule.Calculate(dueAt, asOf) - (charged - chargedBefore)
+	if remaining := r.MaxAmount - charged; owed > remaining {
+		owed = remaining
+	}
+	if owed < 0 {
+		return 0
+	}
+	return owed
+}
+
+// Fine is a single entry in the fines ledger. Entries are never deleted and their
+// amounts never change; corrections are made by adding waivers. Only a charge's status
+// and the amount waived from it are updated, as waivers are made against it.
+type Fine struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uuid.UUID  `json:"user_id"`
+	LoanID    *uuid.UUID `json:"loan_id,omitempty"`
+	Kind      string     `json:"kind"`
+	Amount    int64      `json:"amount"`
+	DueAt     *time.Time `json:"due_at,omitempty"`
+	Status    string     `json:"status,omitempty"`
+	Waived    int64      `json:"waived,omitempty"`
+	Note      string     `json:"note,omitempty"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+	Version   int32      `json:"version"`
+}
+
+// Waivable returns how much of a charge can still be waived.
+func (f *Fine) Waivable() int64 {
+	if f.Kind != FineKindCharge || f.Status != FineStatusOutstanding {
+		return 0
+	}
+	return f.Amount - f.Waived
+}
+
+type FineModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a payment or waiver to the ledger. Charges are only ever created by the
+// AccrueForLoan() method.
+func (m FineModel) Insert(fine *Fine) error {
+	query := `
+INSERT INTO fines (user_id, loan_id, kind, amount, note, created_by)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_at, version`
+	args := []any{fine.UserID, fine.LoanID, fine.Kind, fine.Amount, fine.Note, fine.CreatedBy}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&fine.ID, &fine.CreatedAt, &fine.Version)
+}
+
+// Waive records a waiver of part or all of an outstanding charge, adding the waiver to
+// the ledger and the amount to what has been waived from the charge. The charge is
+// marked waived once nothing is left of it. If the charge has changed since it was
+// read, or is no longer outstanding, ErrEditConflict is returned.
+func (m FineModel) Waive(charge *Fine, waiver *Fine) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE fines
+SET waived = waived + $1,
+status = CASE WHEN waived + $1 >= amount THEN 'waived' ELSE 'outstanding' END,
+version = version + 1
+WHERE id = $2 AND version = $3 AND status = 'outstanding' AND waived + $1 <= amount
+RETURNING waived, status, version`
+
+	err = tx.QueryRowContext(ctx, query, waiver.Amount, charge.ID, charge.Version).Scan(&charge.Waived, &charge.Status, &charge.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+INSERT INTO fines (user_id, loan_id, kind, amount, note, created_by)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_at, version`
+	args := []any{waiver.UserID, waiver.LoanID, waiver.Kind, waiver.Amount, waiver.Note, waiver.CreatedBy}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&waiver.ID, &waiver.CreatedAt, &waiver.Version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m FineModel) Get(id uuid.UUID) (*Fine, error) {
+	query := `
+SELECT id, created_at, user_id, loan_id, kind, amount, due_at, COALESCE(status, ''), waived, note, created_by, version
+FROM fines
+WHERE id = $1`
+	var fine Fine
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&fine.ID,
+		&fine.CreatedAt,
+		&fine.UserID,
+		&fine.LoanID,
+		&fine.Kind,
+		&fine.Amount,
+		&fine.DueAt,
+		&fine.Status,
+		&fine.Waived,
+		&fine.Note,
+		&fine.CreatedBy,
+		&fine.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &fine, nil
+}
+
+// GetAllForUser returns every ledger entry for a user, most recent first.
+func (m FineModel) GetAllForUser(userID uuid.UUID) ([]*Fine, error) {
+	query := `
+SELECT id, created_at, user_id, loan_id, kind, amount, due_at, COALESCE(status, ''), waived, note, created_by, version
+FROM fines
+WHERE user_id = $1
+ORDER BY created_at DESC, id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fines := []*Fine{}
+	for rows.Next() {
+		var fine Fine
+		err := rows.Scan(
+			&fine.ID,
+			&fine.CreatedAt,
+			&fine.UserID,
+			&fine.LoanID,
+			&fine.Kind,
+			&fine.Amount,
+			&fine.DueAt,
+			&fine.Status,
+			&fine.Waived,
+			&fine.Note,
+			&fine.CreatedBy,
+			&fine.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		fines = append(fines, &fine)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return fines, nil
+}
+
+// Balance returns how much a user currently owes: the sum of their charges less the
+// sum of their payments and waivers.
+func (m FineModel) Balance(userID uuid.UUID) (int64, error) {
+	query := `
+SELECT COALESCE(sum(CASE WHEN kind = 'charge' THEN amount ELSE -amount END), 0)
+FROM fines
+WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var balance int64
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&balance)
+	return balance, err
+}
+
+// AccrueForLoan brings the charges for a loan up to date. The fine for the loan's
+// current due date is worked out from the rule for the copy's item type, as of the
+// return date or asOf for loans which are still out, and whatever FineRule.Owed() says
+// hasn't been charged yet is added to the ledger. Because only the difference is
+// charged, it is safe to call this any number of times. It returns the new charge, or
+// nil if nothing was owed.
+func (m FineModel) AccrueForLoan(loanID uuid.UUID, asOf time.Time) (*Fine, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the loan row so that a return and the nightly run can't both charge the
+	// same days. The rule for the copy's own item type is preferred over the default.
+	query := `
+SELECT loans.user_id, loans.due_at, loans.returned_at,
+fine_rules.item_type, fine_rules.daily_rate, fine_rules.grace_days, fine_rules.max_amount
+FROM loans
+INNER JOIN book_copies ON book_copies.id = loans.copy_id
+INNER JOIN fine_rules ON fine_rules.item_type IN (book_copies.item_type, 'default')
+WHERE loans.id = $1
+ORDER BY fine_rules.item_type = 'default' ASC
+LIMIT 1
+FOR UPDATE OF loans`
+
+	var (
+		fine       = Fine{LoanID: &loanID, Kind: FineKindCharge, Status: FineStatusOutstanding, Note: "overdue fine"}
+		rule       FineRule
+		dueAt      time.Time
+		returnedAt *time.Time
+	)
+	err = tx.QueryRowContext(ctx, query, loanID).Scan(
+		&fine.UserID,
+		&dueAt,
+		&returnedAt,
+		&rule.ItemType,
+		&rule.DailyRate,
+		&rule.GraceDays,
+		&rule.MaxAmount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+SELECT amount, due_at
+FROM fines
+WHERE loan_id = $1 AND kind = 'charge'`
+
+	rows, err := tx.QueryContext(ctx, query, loanID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	charges := []*Fine{}
+	for rows.Next() {
+		charge := Fine{Kind: FineKindCharge}
+		err := rows.Scan(&charge.Amount, &charge.DueAt)
+		if err != nil {
+			return nil, err
+		}
+		charges = append(charges, &charge)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if returnedAt != nil {
+		asOf = *returnedAt
+	}
+	fine.DueAt = &dueAt
+	fine.Amount = rule.Owed(dueAt, asOf, charges)
+	if fine.Amount <= 0 {
+		return nil, nil
+	}
+
+	query = `
+INSERT INTO fines (user_id, loan_id, kind, amount, due_at, status, note)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at, version`
+	args := []any{fine.UserID, fine.LoanID, fine.Kind, fine.Amount, fine.DueAt, fine.Status, fine.Note}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&fine.ID, &fine.CreatedAt, &fine.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &fine, nil
+}
+
+// AccrueOverdue brings the charges up to date for every loan which is still out past
+// its due date, and returns how many new charges were made.
+func (m FineModel) AccrueOverdue(asOf time.Time) (int, error) {
+	query := `
+SELECT id FROM loans
+WHERE returned_at IS NULL AND due_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, asOf)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var loanIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		err := rows.Scan(&id)
+		if err != nil {
+			return 0, err
+		}
+		loanIDs = append(loanIDs, id)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	charged := 0
+	for _, id := range loanIDs {
+		fine, err := m.AccrueForLoan(id, asOf)
+		if err != nil {
+			return charged, err
+		}
+		if fine != nil {
+			charged++
+		}
+	}
+	return charged, nil
+}
+
+// GetAllRules returns every fine rule, ordered by item type.
+func (m FineModel) GetAllRules() ([]*FineRule, error) {
+	query := `
+SELECT item_type, daily_rate, grace_days, max_amount, version
+FROM fine_rules
+ORDER BY item_type ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*FineRule{}
+	for rows.Next() {
+		var rule FineRule
+		err := rows.Scan(&rule.ItemType, &rule.DailyRate, &rule.GraceDays, &rule.MaxAmount, &rule.Version)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// SaveRule creates the rule for an item type, or replaces it if one already exists.
+func (m FineModel) SaveRule(rule *FineRule) error {
+	query := `
+INSERT INTO fine_rules (item_type, daily_rate, grace_days, max_amount)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (item_type) DO UPDATE
+SET daily_rate = EXCLUDED.daily_rate, grace_days = EXCLUDED.grace_days, max_amount = EXCLUDED.max_amount,
+version = fine_rules.version + 1
+RETURNING version`
+	args := []any{rule.ItemType, rule.DailyRate, rule.GraceDays, rule.MaxAmount}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&rule.Version)
+}
+
+func ValidateFineRule(v *validator.Validator, rule *FineRule) {
+	v.Check(rule.ItemType == DefaultFineRule || validator.Matches(rule.ItemType, ItemTypeRX), "item_type", "must be a lowercase identifier")
+	v.Check(rule.DailyRate >= 0, "daily_rate", "must not be negative")
+	v.Check(rule.GraceDays >= 0, "grace_days", "must not be negative")
+	v.Check(rule.MaxAmount >= 0, "max_amount", "must not be negative")
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Danik14/library/internal/assert"
+)
+
+func TestFineRuleCalculate(t *testing.T) {
+	rule := FineRule{DailyRate: 10, GraceDays: 2, MaxAmount: 100}
+	dueAt := time.Date(2023, time.March, 1, 23, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		returnedAt time.Time
+		want       int64
+	}{
+		{
+			name:       "Returned early",
+			returnedAt: dueAt.Add(-48 * time.Hour),
+			want:       0,
+		},
+		{
+			name:       "Returned on time",
+			returnedAt: dueAt,
+			want:       0,
+		},
+		{
+			name:       "Within grace period",
+			returnedAt: dueAt.Add(36 * time.Hour),
+			want:       0,
+		},
+		{
+			name:       "Started day counts in full",
+			returnedAt: dueAt.Add(48*time.Hour + time.Minute),
+			want:       10,
+		},
+		{
+			name:       "Several days late",
+			returnedAt: dueAt.Add(7 * 24 * time.Hour),
+			want:       50,
+		},
+		{
+			name:       "Capped at maximum",
+			returnedAt: dueAt.Add(60 * 24 * time.Hour),
+			want:       100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, rule.Calculate(dueAt, tt.returnedAt), tt.want)
+		})
+	}
+}
+
+func TestDueDate(t *testing.T) {
+	from := time.Date(2023, time.March, 1, 9, 30, 0, 0, time.UTC)
+
+	due := DueDate(from, 14*24*time.Hour)
+
+	assert.Equal(t, due, time.Date(2023, time.March, 15, 23, 59, 59, 0, time.UTC))
+}
+
+func TestFineWaivable(t *testing.T) {
+	tests := []struct {
+		name string
+		fine Fine
+		want int64
+	}{
+		{
+			name: "Outstanding charge",
+			fine: Fine{Kind: FineKindCharge, Status: FineStatusOutstanding, Amount: 50},
+			want: 50,
+		},
+		{
+			name: "Partly waived charge",
+			fine: Fine{Kind: FineKindCharge, Status: FineStatusOutstanding, Amount: 50, Waived: 20},
+			want: 30,
+		},
+		{
+			name: "Waived charge",
+			fine: Fine{Kind: FineKindCharge, Status: FineStatusWaived, Amount: 50, Waived: 50},
+			want: 0,
+		},
+		{
+			name: "Payment",
+			fine: Fine{Kind: FineKindPayment, Amount: 50},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.fine.Waivable(), tt.want)
+		})
+	}
+}
+
+func TestFineRuleOwed(t *testing.T) {
+	rule := FineRule{DailyRate: 10, GraceDays: 0, MaxAmount: 1000}
+	dueAt := time.Date(2023, time.March, 1, 23, 59, 59, 0, time.UTC)
+
+	// Accrue five days late, then renew for two weeks from then and accrue again
+	// three days after the new due date.
+	first := dueAt.Add(5 * 24 * time.Hour)
+	charges := []*Fine{}
+	owed := rule.Owed(dueAt, first, charges)
+	assert.Equal(t, owed, int64(50))
+	charges = append(charges, &Fine{Kind: FineKindCharge, Amount: owed, DueAt: &dueAt})
+
+	assert.Equal(t, rule.Owed(dueAt, first, charges), int64(0))
+
+	renewedDueAt := first.Add(14 * 24 * time.Hour)
+	assert.Equal(t, rule.Owed(renewedDueAt, first, charges), int64(0))
+
+	second := renewedDueAt.Add(3 * 24 * time.Hour)
+	owed = rule.Owed(renewedDueAt, second, charges)
+	assert.Equal(t, owed, int64(30))
+	charges = append(charges, &Fine{Kind: FineKindCharge, Amount: owed, DueAt: &renewedDueAt})
+
+	assert.Equal(t, rule.Owed(renewedDueAt, second.Add(24*time.Hour), charges), int64(10))
+
+	var total int64
+	for _, charge := range charges {
+		total += charge.Amount
+	}
+	assert.Equal(t, total, int64(80))
+
+	// A loan renewed while overdue isn't given the grace period again, and all of its
+	// charges together are capped at the maximum.
+	rule = FineRule{DailyRate: 10, GraceDays: 2, MaxAmount: 100}
+	charges = []*Fine{}
+	first = dueAt.Add(7 * 24 * time.Hour)
+	owed = rule.Owed(dueAt, first, charges)
+	assert.Equal(t, owed, int64(50))
+	charges = append(charges, &Fine{Kind: FineKindCharge, Amount: owed, DueAt: &dueAt})
+
+	renewedDueAt = first.Add(14 * 24 * time.Hour)
+	second = renewedDueAt.Add(3 * 24 * time.Hour)
+	owed = rule.Owed(renewedDueAt, second, charges)
+	assert.Equal(t, owed, int64(30))
+	charges = append(charges, &Fine{Kind: FineKindCharge, Amount: owed, DueAt: &renewedDueAt})
+
+	// Renewed again, the loan can only be charged what is left under the cap.
+	third := second.Add(14 * 24 * time.Hour)
+	assert.Equal(t, rule.Owed(third, third.Add(10*24*time.Hour), charges), int64(20))
+	charges = append(charges, &Fine{Kind: FineKindCharge, Amount: 20, DueAt: &third})
+	assert.Equal(t, rule.Owed(third, third.Add(60*24*time.Hour), charges), int64(0))
+}
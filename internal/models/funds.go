@@ -0,0 +1,547 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	ErrDuplicateFundCode  = errors.New("duplicate fund code")
+	ErrFundCurrencyLocked = errors.New("fund currency locked")
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+)
+
+// Define constants for the kinds of entry in the fund ledger. Placing an order
+// encumbers its total, and the encumbrance is released when the order is cancelled or
+// invoiced; invoicing records what was actually spent as an expenditure.
+const (
+	FundTransactionEncumbrance = "encumbrance"
+	FundTransactionRelease     = "release"
+	FundTransactionExpenditure = "expenditure"
+)
+
+// MaxAmount is the largest amount of money, in minor units, that a price, allocation or
+// invoice can be. It keeps order totals and fund balances far from overflowing.
+const MaxAmount = 1_000_000_000_000
+
+// CurrencyRX matches ISO 4217 currency codes, such as "USD" or "KZT".
+var CurrencyRX = regexp.MustCompile("^[A-Z]{3}$")
+
+// FiscalYear returns the fiscal year which t falls in, for fiscal years starting on
+// the first of startMonth. Fiscal years are named after the calendar year they end in,
+// so with a July start, August 2026 is in fiscal year 2027.
+func FiscalYear(t time.Time, startMonth time.Month) int {
+	if startMonth > time.January && t.Month() >= startMonth {
+		return t.Year() + 1
+	}
+	return t.Year()
+}
+
+// Fund is a budget that purchase orders are paid from. All its amounts are in minor
+// units of its currency.
+type Fund struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name,omitempty"`
+	Currency  string    `json:"currency"`
+	Version   int32     `json:"version"`
+}
+
+// FundAllocation is money given to a fund for a fiscal year. Negative allocations take
+// money back.
+type FundAllocation struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FundID     uuid.UUID  `json:"fund_id"`
+	FiscalYear int        `json:"fiscal_year"`
+	Amount     int64      `json:"amount"`
+	Note       string     `json:"note,omitempty"`
+	CreatedBy  *uuid.UUID `json:"created_by,omitempty"`
+}
+
+// FundTransaction is a single entry in the fund ledger. Entries are only created by
+// the purchase order workflow, and are never updated or deleted.
+type FundTransaction struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FundID     uuid.UUID  `json:"fund_id"`
+	FiscalYear int        `json:"fiscal_year"`
+	OrderID    *uuid.UUID `json:"order_id,omitempty"`
+	Kind       string     `json:"kind"`
+	Amount     int64      `json:"amount"`
+}
+
+// FundBalance sums up a fund for a fiscal year. Encumbered is the total of the orders
+// which haven't been invoiced or cancelled yet, and Available is what is left to spend
+// once they are paid for.
+type FundBalance struct {
+	FundID     uuid.UUID `json:"fund_id"`
+	Code       string    `json:"code"`
+	Name       string    `json:"name,omitempty"`
+	Currency   string    `json:"currency"`
+	FiscalYear int       `json:"fiscal_year"`
+	Allocated  int64     `json:"allocated"`
+	Encumbered int64     `json:"encumbered"`
+	Expended   int64     `json:"expended"`
+	Available  int64     `json:"available"`
+}
+
+type FundModel struct {
+	DB *sql.DB
+}
+
+func (m FundModel) Insert(fund *Fund) error {
+	query := `
+INSERT INTO funds (code, name, currency)
+VALUES ($1, $2, $3)
+RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, fund.Code, fund.Name, fund.Currency).Scan(&fund.ID, &fund.CreatedAt, &fund.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "funds_code_key"`:
+			return ErrDuplicateFundCode
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m FundModel) Get(id uuid.UUID) (*Fund, error) {
+	query := `
+SELECT id, created_at, code, name, currency, version
+FROM funds
+WHERE id = $1`
+
+	var fund Fund
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&fund.ID,
+		&fund.CreatedAt,
+		&fund.Code,
+		&fund.Name,
+		&fund.Currency,
+		&fund.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &fund, nil
+}
+
+// GetAll returns every fund, ordered by code.
+func (m FundModel) GetAll() ([]*Fund, error) {
+	query := `
+SELECT id, created_at, code, name, currency, version
+FROM funds
+ORDER BY code ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	funds := []*Fund{}
+	for rows.Next() {
+		var fund Fund
+		err := rows.Scan(
+			&fund.ID,
+			&fund.CreatedAt,
+			&fund.Code,
+			&fund.Name,
+			&fund.Currency,
+			&fund.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		funds = append(funds, &fund)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return funds, nil
+}
+
+// Update saves the changes to a fund. Its amounts are in minor units of its currency,
+// so the currency can't be changed once money has been allocated to the fund, and
+// ErrFundCurrencyLocked is returned instead.
+func (m FundModel) Update(fund *Fund) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+SELECT currency, EXISTS (SELECT 1 FROM fund_allocations WHERE fund_id = funds.id)
+FROM funds
+WHERE id = $1
+FOR UPDATE`
+	var currency string
+	var allocated bool
+	err = tx.QueryRowContext(ctx, query, fund.ID).Scan(&currency, &allocated)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	if allocated && currency != fund.Currency {
+		return ErrFundCurrencyLocked
+	}
+
+	query = `
+UPDATE funds
+SET code = $1, name = $2, currency = $3, version = version + 1
+WHERE id = $4 AND version = $5
+RETURNING version`
+	args := []any{fund.Code, fund.Name, fund.Currency, fund.ID, fund.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&fund.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "funds_code_key"`:
+			return ErrDuplicateFundCode
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m FundModel) InsertAllocation(allocation *FundAllocation) error {
+	query := `
+INSERT INTO fund_allocations (fund_id, fiscal_year, amount, note, created_by)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, created_at`
+	args := []any{allocation.FundID, allocation.FiscalYear, allocation.Amount, allocation.Note, allocation.CreatedBy}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&allocation.ID, &allocation.CreatedAt)
+}
+
+// GetAllocations returns the allocations to a fund, optionally only those for one
+// fiscal year, in the order they were made.
+func (m FundModel) GetAllocations(fundID uuid.UUID, fiscalYear int) ([]*FundAllocation, error) {
+	query := `
+SELECT id, created_at, fund_id, fiscal_year, amount, note, created_by
+FROM fund_allocations
+WHERE fund_id = $1 AND (fiscal_year = $2 OR $2 = 0)
+ORDER BY created_at ASC, id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, fundID, fiscalYear)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	allocations := []*FundAllocation{}
+	for rows.Next() {
+		var allocation FundAllocation
+		err := rows.Scan(
+			&allocation.ID,
+			&allocation.CreatedAt,
+			&allocation.FundID,
+			&allocation.FiscalYear,
+			&allocation.Amount,
+			&allocation.Note,
+			&allocation.CreatedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, &allocation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return allocations, nil
+}
+
+// GetTransactions returns the ledger entries of a fund, optionally only those for one
+// fiscal year, most recent first.
+func (m FundModel) GetTransactions(fundID uuid.UUID, fiscalYear int) ([]*FundTransaction, error) {
+	query := `
+SELECT id, created_at, fund_id, fiscal_year, order_id, kind, amount
+FROM fund_transactions
+WHERE fund_id = $1 AND (fiscal_year = $2 OR $2 = 0)
+ORDER BY created_at DESC, id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, fundID, fiscalYear)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []*FundTransaction{}
+	for rows.Next() {
+		var transaction FundTransaction
+		err := rows.Scan(
+			&transaction.ID,
+			&transaction.CreatedAt,
+			&transaction.FundID,
+			&transaction.FiscalYear,
+			&transaction.OrderID,
+			&transaction.Kind,
+			&transaction.Amount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, &transaction)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// fundBalancesQuery sums up the allocations and ledger entries of every fund, or of
+// the fund $2 if it isn't NULL, for the fiscal year $1.
+const fundBalancesQuery = `
+SELECT id, code, name, currency,
+COALESCE((SELECT sum(amount) FROM fund_allocations WHERE fund_id = funds.id AND fiscal_year = $1), 0),
+COALESCE((SELECT sum(CASE WHEN kind = 'encumbrance' THEN amount ELSE -amount END) FROM fund_transactions
+	WHERE fund_id = funds.id AND fiscal_year = $1 AND kind IN ('encumbrance', 'release')), 0),
+COALESCE((SELECT sum(amount) FROM fund_transactions WHERE fund_id = funds.id AND fiscal_year = $1 AND kind = 'expenditure'), 0)
+FROM funds
+WHERE ($2::uuid IS NULL OR id = $2)
+ORDER BY code ASC`
+
+// Balances returns the balance of every fund for a fiscal year, or only of the fund
+// fundID if it isn't uuid.Nil.
+func (m FundModel) Balances(fiscalYear int, fundID uuid.UUID) ([]*FundBalance, error) {
+	var fund *uuid.UUID
+	if fundID != uuid.Nil {
+		fund = &fundID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, fundBalancesQuery, fiscalYear, fund)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFundBalances(rows, fiscalYear)
+}
+
+// calculate works out what is available from the other amounts of the balance.
+func (b *FundBalance) calculate() {
+	b.Available = b.Allocated - b.Encumbered - b.Expended
+}
+
+// canEncumber reports whether the fund has amount available to spend.
+func (b *FundBalance) canEncumber(amount int64) bool {
+	return amount <= b.Available
+}
+
+func scanFundBalances(rows *sql.Rows, fiscalYear int) ([]*FundBalance, error) {
+	balances := []*FundBalance{}
+	for rows.Next() {
+		balance := FundBalance{FiscalYear: fiscalYear}
+		err := rows.Scan(
+			&balance.FundID,
+			&balance.Code,
+			&balance.Name,
+			&balance.Currency,
+			&balance.Allocated,
+			&balance.Encumbered,
+			&balance.Expended,
+		)
+		if err != nil {
+			return nil, err
+		}
+		balance.calculate()
+		balances = append(balances, &balance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return balances, nil
+}
+
+// encumber charges the total of an order against its fund as part of a transaction,
+// after locking the fund so that concurrent orders can't overspend it.
+// ErrInsufficientFunds is returned if the fund doesn't have that much available in the
+// order's fiscal year.
+func encumber(ctx context.Context, tx *sql.Tx, order *PurchaseOrder) error {
+	entry := encumbrance(order)
+	if entry == nil {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `SELECT 1 FROM funds WHERE id = $1 FOR UPDATE`, entry.FundID)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx, fundBalancesQuery, entry.FiscalYear, entry.FundID)
+	if err != nil {
+		return err
+	}
+	balances, err := scanFundBalances(rows, entry.FiscalYear)
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	if len(balances) == 0 || !balances[0].canEncumber(entry.Amount) {
+		return ErrInsufficientFunds
+	}
+
+	return insertFundTransaction(ctx, tx, entry)
+}
+
+// encumbrance returns the ledger entry which encumbers the total of an order, or nil
+// if it has no fund or costs nothing.
+func encumbrance(order *PurchaseOrder) *FundTransaction {
+	if order.FundID == nil || order.Total() == 0 {
+		return nil
+	}
+	return &FundTransaction{FundID: *order.FundID, FiscalYear: order.FiscalYear, OrderID: &order.ID, Kind: FundTransactionEncumbrance, Amount: order.Total()}
+}
+
+// expenditure returns the ledger entry which charges the invoiced amount of an order,
+// or nil if it has no fund or nothing was invoiced.
+func expenditure(order *PurchaseOrder) *FundTransaction {
+	if order.FundID == nil || order.InvoicedAmount == nil || *order.InvoicedAmount == 0 {
+		return nil
+	}
+	return &FundTransaction{FundID: *order.FundID, FiscalYear: order.FiscalYear, OrderID: &order.ID, Kind: FundTransactionExpenditure, Amount: *order.InvoicedAmount}
+}
+
+// release releases whatever is still encumbered for an order, as part of a
+// transaction.
+func release(ctx context.Context, tx *sql.Tx, orderID uuid.UUID) error {
+	query := `
+SELECT fund_id, fiscal_year, order_id, kind, amount
+FROM fund_transactions
+WHERE order_id = $1 AND kind IN ('encumbrance', 'release')
+ORDER BY created_at ASC, id ASC`
+	rows, err := tx.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ledger := []*FundTransaction{}
+	for rows.Next() {
+		var transaction FundTransaction
+		err := rows.Scan(&transaction.FundID, &transaction.FiscalYear, &transaction.OrderID, &transaction.Kind, &transaction.Amount)
+		if err != nil {
+			return err
+		}
+		ledger = append(ledger, &transaction)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, transaction := range releases(ledger) {
+		err = insertFundTransaction(ctx, tx, transaction)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releases returns the entries which release what an order's ledger entries still
+// encumber, one for each fund and fiscal year with an encumbrance left.
+func releases(ledger []*FundTransaction) []*FundTransaction {
+	type key struct {
+		fundID     uuid.UUID
+		fiscalYear int
+	}
+	outstanding := map[key]*FundTransaction{}
+	entries := []*FundTransaction{}
+	for _, transaction := range ledger {
+		k := key{transaction.FundID, transaction.FiscalYear}
+		entry, ok := outstanding[k]
+		if !ok {
+			entry = &FundTransaction{FundID: transaction.FundID, FiscalYear: transaction.FiscalYear, OrderID: transaction.OrderID, Kind: FundTransactionRelease}
+			outstanding[k] = entry
+			entries = append(entries, entry)
+		}
+		switch transaction.Kind {
+		case FundTransactionEncumbrance:
+			entry.Amount += transaction.Amount
+		case FundTransactionRelease:
+			entry.Amount -= transaction.Amount
+		}
+	}
+
+	released := []*FundTransaction{}
+	for _, entry := range entries {
+		if entry.Amount > 0 {
+			released = append(released, entry)
+		}
+	}
+	return released
+}
+
+// insertFundTransaction adds an entry to the fund ledger, as part of a transaction.
+func insertFundTransaction(ctx context.Context, tx *sql.Tx, transaction *FundTransaction) error {
+	query := `
+INSERT INTO fund_transactions (fund_id, fiscal_year, order_id, kind, amount)
+VALUES ($1, $2, $3, $4, $5)`
+	_, err := tx.ExecContext(ctx, query, transaction.FundID, transaction.FiscalYear, transaction.OrderID, transaction.Kind, transaction.Amount)
+	return err
+}
+
+func ValidateFund(v *validator.Validator, fund *Fund) {
+	v.Check(fund.Code != "", "code", "must be provided")
+	v.Check(len(fund.Code) <= 100, "code", "must not be more than 100 bytes long")
+	v.Check(len(fund.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(validator.Matches(fund.Currency, CurrencyRX), "currency", "must be a three-letter ISO 4217 currency code")
+}
+
+func ValidateFundAllocation(v *validator.Validator, allocation *FundAllocation) {
+	v.Check(allocation.FiscalYear >= 1900 && allocation.FiscalYear <= 9999, "fiscal_year", "must be a valid year")
+	v.Check(allocation.Amount != 0, "amount", "must not be zero")
+	v.Check(allocation.Amount >= -MaxAmount && allocation.Amount <= MaxAmount, "amount", fmt.Sprintf("must not be more than %d either way", int64(MaxAmount)))
+	v.Check(len(allocation.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+}
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Danik14/library/internal/assert"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestFiscalYear(t *testing.T) {
+	tests := []struct {
+		name       string
+		t          time.Time
+		startMonth time.Month
+		want       int
+	}{
+		{
+			name:       "Calendar year",
+			t:          time.Date(2026, time.December, 31, 23, 0, 0, 0, time.UTC),
+			startMonth: time.January,
+			want:       2026,
+		},
+		{
+			name:       "Before start month",
+			t:          time.Date(2026, time.June, 30, 0, 0, 0, 0, time.UTC),
+			startMonth: time.July,
+			want:       2026,
+		},
+		{
+			name:       "On start month",
+			t:          time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC),
+			startMonth: time.July,
+			want:       2027,
+		},
+		{
+			name:       "After start month",
+			t:          time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC),
+			startMonth: time.April,
+			want:       2027,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, FiscalYear(tt.t, tt.startMonth), tt.want)
+		})
+	}
+}
+
+func newTestFund(t *testing.T, db *sql.DB, allocations map[int]int64) *Fund {
+	t.Helper()
+
+	m := FundModel{DB: db}
+	fund := &Fund{Code: "TEST-" + uuid.NewV4().String(), Currency: "KZT"}
+	if err := m.Insert(fund); err != nil {
+		t.Fatal(err)
+	}
+	cleanup(t, db, `DELETE FROM funds WHERE id = $1`, fund.ID)
+
+	for fiscalYear, amount := range allocations {
+		allocation := &FundAllocation{FundID: fund.ID, FiscalYear: fiscalYear, Amount: amount}
+		if err := m.InsertAllocation(allocation); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fund
+}
+
+func TestFundLedger(t *testing.T) {
+	db := newTestDB(t)
+	funds := FundModel{DB: db}
+	orders := PurchaseOrderModel{DB: db}
+
+	branch := newTestBranch(t, db)
+	fund := newTestFund(t, db, map[int]int64{2026: 10_000, 2027: 5000})
+
+	newOrder := func(quantity int32, unitPrice int64) *PurchaseOrder {
+		return &PurchaseOrder{Title: "Test order", Vendor: "Test vendor", Quantity: quantity, UnitPrice: unitPrice,
+			FundID: &fund.ID, FiscalYear: 2026, BranchID: branch.ID}
+	}
+	insert := func(order *PurchaseOrder) error {
+		err := orders.Insert(order)
+		if err == nil {
+			cleanup(t, db, `DELETE FROM purchase_orders WHERE id = $1`, order.ID)
+		}
+		return err
+	}
+	assertBalance := func(t *testing.T, fiscalYear int, encumbered, expended, available int64) {
+		t.Helper()
+		balances, err := funds.Balances(fiscalYear, fund.ID)
+		assert.NilError(t, err)
+		assert.Equal(t, len(balances), 1)
+		assert.Equal(t, balances[0].Encumbered, encumbered)
+		assert.Equal(t, balances[0].Expended, expended)
+		assert.Equal(t, balances[0].Available, available)
+	}
+
+	order := newOrder(2, 1500)
+
+	t.Run("Create", func(t *testing.T) {
+		assert.NilError(t, insert(order))
+		assertBalance(t, 2026, 3000, 0, 7000)
+	})
+
+	t.Run("Insufficient funds", func(t *testing.T) {
+		err := insert(newOrder(1, 7001))
+		assert.Equal(t, errors.Is(err, ErrInsufficientFunds), true)
+		assertBalance(t, 2026, 3000, 0, 7000)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		// The old total is released before the new one is encumbered, so the order can
+		// use the money it had already set aside.
+		order.Quantity, order.UnitPrice = 4, 2500
+		assert.NilError(t, orders.Update(order))
+		assertBalance(t, 2026, 10_000, 0, 0)
+
+		stored, err := orders.Get(order.ID)
+		assert.NilError(t, err)
+		stored.UnitPrice = 2501
+		err = orders.Update(stored)
+		assert.Equal(t, errors.Is(err, ErrInsufficientFunds), true)
+		assertBalance(t, 2026, 10_000, 0, 0)
+	})
+
+	t.Run("Move to another fiscal year", func(t *testing.T) {
+		order.Quantity, order.UnitPrice, order.FiscalYear = 2, 1500, 2027
+		assert.NilError(t, orders.Update(order))
+		assertBalance(t, 2026, 0, 0, 10_000)
+		assertBalance(t, 2027, 3000, 0, 2000)
+	})
+
+	t.Run("Invoice", func(t *testing.T) {
+		// What was invoiced is what was spent, even if it is more than was ordered.
+		amount := int64(3200)
+		order.InvoiceNumber, order.InvoicedAmount = "INV-1", &amount
+		assert.NilError(t, orders.Invoice(order))
+		assertBalance(t, 2027, 0, 3200, 1800)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		cancelled := newOrder(2, 1500)
+		assert.NilError(t, insert(cancelled))
+		assertBalance(t, 2026, 3000, 0, 7000)
+
+		assert.NilError(t, orders.Cancel(cancelled))
+		assertBalance(t, 2026, 0, 0, 10_000)
+	})
+}
+
+func TestReleases(t *testing.T) {
+	fundID, otherFundID := uuid.NewV4(), uuid.NewV4()
+	entry := func(fundID uuid.UUID, fiscalYear int, kind string, amount int64) *FundTransaction {
+		return &FundTransaction{FundID: fundID, FiscalYear: fiscalYear, Kind: kind, Amount: amount}
+	}
+
+	tests := []struct {
+		name   string
+		ledger []*FundTransaction
+		want   []*FundTransaction
+	}{
+		{
+			name:   "Nothing encumbered",
+			ledger: []*FundTransaction{},
+			want:   []*FundTransaction{},
+		},
+		{
+			name:   "Encumbered",
+			ledger: []*FundTransaction{entry(fundID, 2026, FundTransactionEncumbrance, 3000)},
+			want:   []*FundTransaction{entry(fundID, 2026, FundTransactionRelease, 3000)},
+		},
+		{
+			name: "Already released",
+			ledger: []*FundTransaction{
+				entry(fundID, 2026, FundTransactionEncumbrance, 3000),
+				entry(fundID, 2026, FundTransactionRelease, 3000),
+			},
+			want: []*FundTransaction{},
+		},
+		{
+			name: "Encumbered again",
+			ledger: []*FundTransaction{
+				entry(fundID, 2026, FundTransactionEncumbrance, 3000),
+				entry(fundID, 2026, FundTransactionRelease, 3000),
+				entry(fundID, 2026, FundTransactionEncumbrance, 8000),
+			},
+			want: []*FundTransaction{entry(fundID, 2026, FundTransactionRelease, 8000)},
+		},
+		{
+			name: "Moved to another fund and fiscal year",
+			ledger: []*FundTransaction{
+				entry(fundID, 2026, FundTransactionEncumbrance, 3000),
+				entry(fundID, 2026, FundTransactionRelease, 3000),
+				entry(otherFundID, 2026, FundTransactionEncumbrance, 2000),
+				entry(otherFundID, 2027, FundTransactionEncumbrance, 1000),
+			},
+			want: []*FundTransaction{
+				entry(otherFundID, 2026, FundTransactionRelease, 2000),
+				entry(otherFundID, 2027, FundTransactionRelease, 1000),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := releases(tt.ledger)
+			assert.Equal(t, len(got), len(tt.want))
+			for i := range got {
+				assert.Equal(t, *got[i], *tt.want[i])
+			}
+		})
+	}
+}
+
+func TestFundBalanceCalculate(t *testing.T) {
+	tests := []struct {
+		name          string
+		balance       FundBalance
+		wantAvailable int64
+	}{
+		{name: "Unused", balance: FundBalance{Allocated: 10_000}, wantAvailable: 10_000},
+		{name: "Encumbered and spent", balance: FundBalance{Allocated: 10_000, Encumbered: 2500, Expended: 4000}, wantAvailable: 3500},
+		{name: "Overspent", balance: FundBalance{Allocated: 1000, Expended: 1200}, wantAvailable: -200},
+		{name: "Nothing allocated", balance: FundBalance{Encumbered: 100}, wantAvailable: -100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.balance.calculate()
+			assert.Equal(t, tt.balance.Available, tt.wantAvailable)
+		})
+	}
+}
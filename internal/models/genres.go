@@ -0,0 +1,480 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Danik14/library/internal/validator"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	ErrDuplicateGenre = errors.New("duplicate genre")
+	ErrGenreInUse     = errors.New("genre in use")
+	ErrGenreCycle     = errors.New("genre cycle")
+)
+
+// Genre is a node in the genre hierarchy. Books store the names of their genres, and
+// any of a genre's synonyms are accepted in its place.
+type Genre struct {
+	ID       uuid.UUID  `json:"id"`
+	Name     string     `json:"name"`
+	ParentID *uuid.UUID `json:"parent_id,omitempty"`
+	Synonyms []string   `json:"synonyms"`
+	Version  int32      `json:"version"`
+}
+
+// NormalizeGenre lower-cases a genre name and collapses runs of spaces, hyphens and
+// underscores into a single space, so that "Sci-Fi" and "sci  fi" are the same.
+func NormalizeGenre(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r == '-' || r == '_' || unicode.IsSpace(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// GenreTaxonomy maps the name and every synonym of each genre, in normalized form, to
+// the genre's name.
+type GenreTaxonomy map[string]string
+
+// Canonical returns the name of the genre that the given name or synonym refers to.
+func (t GenreTaxonomy) Canonical(name string) (string, bool) {
+	canonical, ok := t[NormalizeGenre(name)]
+	return canonical, ok
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a genre along with its synonyms. ErrDuplicateGenre is returned if the
+// name or any synonym is already used by another genre.
+func (m GenreModel) Insert(genre *Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+INSERT INTO genres (name, parent_id)
+VALUES ($1, $2)
+RETURNING id, version`
+	err = tx.QueryRowContext(ctx, query, genre.Name, genre.ParentID).Scan(&genre.ID, &genre.Version)
+	if err != nil {
+		return genreConstraintError(err)
+	}
+
+	err = m.saveSynonyms(ctx, tx, genre)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m GenreModel) Get(id uuid.UUID) (*Genre, error) {
+	query := `
+SELECT id, name, parent_id,
+ARRAY(SELECT synonym FROM genre_synonyms WHERE genre_id = genres.id ORDER BY synonym),
+version
+FROM genres
+WHERE id = $1`
+	var genre Genre
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&genre.ID,
+		&genre.Name,
+		&genre.ParentID,
+		pq.Array(&genre.Synonyms),
+		&genre.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &genre, nil
+}
+
+// GetAll returns every genre, ordered by name. Clients can build the hierarchy from
+// the parent IDs.
+func (m GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+SELECT id, name, parent_id,
+ARRAY(SELECT synonym FROM genre_synonyms WHERE genre_id = genres.id ORDER BY synonym),
+version
+FROM genres
+ORDER BY name ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(
+			&genre.ID,
+			&genre.Name,
+			&genre.ParentID,
+			pq.Array(&genre.Synonyms),
+			&genre.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return genres, nil
+}
+
+// Taxonomy loads the lookup table used by ValidateBook() to check and normalize the
+// genres of a book.
+func (m GenreModel) Taxonomy() (GenreTaxonomy, error) {
+	query := `
+SELECT name, name FROM genres
+UNION ALL
+SELECT genre_synonyms.synonym, genres.name
+FROM genre_synonyms INNER JOIN genres ON genres.id = genre_synonyms.genre_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taxonomy := GenreTaxonomy{}
+	for rows.Next() {
+		var key, name string
+		err := rows.Scan(&key, &name)
+		if err != nil {
+			return nil, err
+		}
+		taxonomy[key] = name
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return taxonomy, nil
+}
+
+// Update saves changes to a genre. Renaming a genre also renames it on every book, and
+// moving it to another parent counts as an update of the books in it and its
+// sub-genres, whose place in the hierarchy changes. ErrGenreCycle is returned if the
+// new parent is the genre itself or one of its sub-genres.
+func (m GenreModel) Update(genre *Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	var oldParentID *uuid.UUID
+	err = tx.QueryRowContext(ctx, `SELECT name, parent_id FROM genres WHERE id = $1 FOR UPDATE`, genre.ID).Scan(&oldName, &oldParentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if genre.ParentID != nil {
+		var cycle bool
+		query := `
+SELECT name = ANY(genre_with_descendants($1)) FROM genres WHERE id = $2`
+		err = tx.QueryRowContext(ctx, query, oldName, *genre.ParentID).Scan(&cycle)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if cycle {
+			return ErrGenreCycle
+		}
+	}
+
+	// This is done before the genre is saved, while its sub-genres are still found
+	// under its old name.
+	if !uuid.Equal(parentOrNil(genre.ParentID), parentOrNil(oldParentID)) {
+		err = touchGenreBooks(ctx, tx, oldName)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+UPDATE genres
+SET name = $1, parent_id = $2, version = version + 1
+WHERE id = $3 AND version = $4
+RETURNING version`
+	err = tx.QueryRowContext(ctx, query, genre.Name, genre.ParentID, genre.ID, genre.Version).Scan(&genre.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return genreConstraintError(err)
+		}
+	}
+
+	if genre.Name != oldName {
+		err = replaceBookGenre(ctx, tx, oldName, genre.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM genre_synonyms WHERE genre_id = $1`, genre.ID)
+	if err != nil {
+		return err
+	}
+	err = m.saveSynonyms(ctx, tx, genre)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a genre. Genres which are still used by a book or have sub-genres
+// can't be deleted, and ErrGenreInUse is returned instead.
+func (m GenreModel) Delete(id uuid.UUID) error {
+	query := `
+DELETE FROM genres
+WHERE id = $1
+AND NOT EXISTS (SELECT 1 FROM books WHERE genres.name = ANY(books.genres))
+AND NOT EXISTS (SELECT 1 FROM genres AS children WHERE children.parent_id = genres.id)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		_, err := m.Get(id)
+		if err != nil {
+			return err
+		}
+		return ErrGenreInUse
+	}
+	return nil
+}
+
+// Merge folds the source genre into the target genre. Books, sub-genres and synonyms
+// of the source move over to the target, the source's name becomes a synonym of the
+// target, and the source is deleted. ErrGenreCycle is returned if the target is a
+// sub-genre of the source.
+func (m GenreModel) Merge(source, target *Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var cycle bool
+	err = tx.QueryRowContext(ctx, `SELECT $2 = ANY(genre_with_descendants($1))`, source.Name, target.Name).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrGenreCycle
+	}
+
+	// The sub-genres of the source move below the target, so their books count as
+	// updated. This is done before the source's books are moved over to the target.
+	err = touchGenreBooks(ctx, tx, source.Name)
+	if err != nil {
+		return err
+	}
+
+	err = replaceBookGenre(ctx, tx, source.Name, target.Name)
+	if err != nil {
+		return err
+	}
+
+	queries := []string{
+		`UPDATE genres SET parent_id = $2, version = version + 1 WHERE parent_id = $1`,
+		`UPDATE genre_synonyms SET genre_id = $2 WHERE genre_id = $1`,
+	}
+	for _, query := range queries {
+		_, err = tx.ExecContext(ctx, query, source.ID, target.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM genres WHERE id = $1 AND version = $2`, source.ID, source.Version)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO genre_synonyms (synonym, genre_id) VALUES ($1, $2)`, source.Name, target.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveSynonyms inserts the synonyms of a genre. Names and synonyms share a single
+// namespace, otherwise lookups would be ambiguous, so ErrDuplicateGenre is returned if
+// a synonym is the name of a genre or the genre's name is a synonym of another.
+func (m GenreModel) saveSynonyms(ctx context.Context, tx *sql.Tx, genre *Genre) error {
+	query := `
+SELECT EXISTS (SELECT 1 FROM genres WHERE name = ANY($1))
+OR EXISTS (SELECT 1 FROM genre_synonyms WHERE synonym = $2)`
+	var clash bool
+	err := tx.QueryRowContext(ctx, query, pq.Array(genre.Synonyms), genre.Name).Scan(&clash)
+	if err != nil {
+		return err
+	}
+	if clash {
+		return ErrDuplicateGenre
+	}
+
+	for _, synonym := range genre.Synonyms {
+		_, err = tx.ExecContext(ctx, `INSERT INTO genre_synonyms (synonym, genre_id) VALUES ($1, $2)`, synonym, genre.ID)
+		if err != nil {
+			return genreConstraintError(err)
+		}
+	}
+	return nil
+}
+
+// replaceBookGenre replaces one genre with another in the genres of every book,
+// without leaving duplicates behind.
+func replaceBookGenre(ctx context.Context, tx *sql.Tx, from, to string) error {
+	query := `
+UPDATE books SET genres = ARRAY(
+	SELECT genre FROM unnest(array_replace(books.genres, $1, $2)) WITH ORDINALITY AS t(genre, position)
+	GROUP BY genre
+	ORDER BY min(position)
+), updated_at = NOW(), version = version + 1
+WHERE $1 = ANY(books.genres)`
+	_, err := tx.ExecContext(ctx, query, from, to)
+	return err
+}
+
+// touchGenreBooks marks the books in a genre or any of its sub-genres as updated,
+// without changing them.
+func touchGenreBooks(ctx context.Context, tx *sql.Tx, name string) error {
+	query := `
+UPDATE books SET updated_at = NOW()
+WHERE books.genres && genre_with_descendants($1)`
+	_, err := tx.ExecContext(ctx, query, name)
+	return err
+}
+
+// parentOrNil returns the parent ID, or uuid.Nil for a top-level genre.
+func parentOrNil(parentID *uuid.UUID) uuid.UUID {
+	if parentID == nil {
+		return uuid.Nil
+	}
+	return *parentID
+}
+
+func genreConstraintError(err error) error {
+	switch {
+	case err.Error() == `pq: duplicate key value violates unique constraint "genres_name_key"`:
+		return ErrDuplicateGenre
+	case err.Error() == `pq: duplicate key value violates unique constraint "genre_synonyms_pkey"`:
+		return ErrDuplicateGenre
+	default:
+		return err
+	}
+}
+
+// ValidateGenre checks a genre and stores its name and synonyms in normalized form.
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	genre.Name = NormalizeGenre(genre.Name)
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(genre.ParentID == nil || *genre.ParentID != genre.ID, "parent_id", "must not be the genre itself")
+
+	for i, synonym := range genre.Synonyms {
+		genre.Synonyms[i] = NormalizeGenre(synonym)
+		v.Check(genre.Synonyms[i] != "", "synonyms", "must not contain empty values")
+		v.Check(genre.Synonyms[i] != genre.Name, "synonyms", "must not contain the genre's own name")
+		v.Check(len(genre.Synonyms[i]) <= 100, "synonyms", "must not contain values more than 100 bytes long")
+	}
+	v.Check(len(genre.Synonyms) <= 50, "synonyms", "must not contain more than 50 values")
+	v.Check(validator.Unique(genre.Synonyms), "synonyms", "must not contain duplicate values")
+}
+
+// MockGenreModel has no taxonomy, so the genres of books are not checked in tests.
+type MockGenreModel struct{}
+
+func (m MockGenreModel) Insert(genre *Genre) error {
+	return nil
+}
+
+func (m MockGenreModel) Get(id uuid.UUID) (*Genre, error) {
+	return nil, ErrRecordNotFound
+}
+
+func (m MockGenreModel) GetAll() ([]*Genre, error) {
+	return []*Genre{}, nil
+}
+
+func (m MockGenreModel) Taxonomy() (GenreTaxonomy, error) {
+	return nil, nil
+}
+
+func (m MockGenreModel) Update(genre *Genre) error {
+	return nil
+}
+
+func (m MockGenreModel) Delete(id uuid.UUID) error {
+	return ErrRecordNotFound
+}
+
+func (m MockGenreModel) Merge(source, target *Genre) error {
+	return nil
+}
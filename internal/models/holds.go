@@ -0,0 +1,457 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	ErrDuplicateHold = errors.New("duplicate hold")
+)
+
+// Define constants for the lifecycle of a hold. A hold waits in the queue until a copy
+// is set aside for it, at which point it is ready for pickup until it either gets
+// checked out (fulfilled), cancelled by the patron or expires. If the copy first has to
+// be sent to the patron's pickup branch, the hold is in transit until it arrives.
+const (
+	HoldStatusWaiting   = "waiting"
+	HoldStatusInTransit = "in_transit"
+	HoldStatusReady     = "ready"
+	HoldStatusFulfilled = "fulfilled"
+	HoldStatusCancelled = "cancelled"
+	HoldStatusExpired   = "expired"
+)
+
+type Hold struct {
+	ID       uuid.UUID  `json:"id"`
+	PlacedAt time.Time  `json:"placed_at"`
+	BookID   uuid.UUID  `json:"book_id"`
+	UserID   uuid.UUID  `json:"user_id"`
+	CopyID   *uuid.UUID `json:"copy_id,omitempty"`
+	// AnyEdition holds can be filled by a copy of any edition of the book's work.
+	AnyEdition bool `json:"any_edition"`
+	// PickupBranchID is the branch where the patron wants to collect the book. If it
+	// is nil, the book can be collected wherever the copy is.
+	PickupBranchID *uuid.UUID `json:"pickup_branch_id,omitempty"`
+	Status         string     `json:"status"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	Version        int32      `json:"version"`
+}
+
+// IsActive reports whether the hold is still waiting in the queue, in transit or ready
+// for pickup.
+func (h *Hold) IsActive() bool {
+	return h.Status == HoldStatusWaiting || h.Status == HoldStatusInTransit || h.Status == HoldStatusReady
+}
+
+type HoldModel struct {
+	DB *sql.DB
+}
+
+func (m HoldModel) Insert(hold *Hold) error {
+	query := `
+INSERT INTO holds (book_id, user_id, any_edition, pickup_branch_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at, status, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hold.BookID, hold.UserID, hold.AnyEdition, hold.PickupBranchID).Scan(&hold.ID, &hold.PlacedAt, &hold.Status, &hold.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "holds_active_user_book_idx"`:
+			return ErrDuplicateHold
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m HoldModel) Get(id uuid.UUID) (*Hold, error) {
+	query := `
+SELECT id, created_at, book_id, user_id, copy_id, any_edition, pickup_branch_id, status, expires_at, version
+FROM holds
+WHERE id = $1`
+	var hold Hold
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&hold.ID,
+		&hold.PlacedAt,
+		&hold.BookID,
+		&hold.UserID,
+		&hold.CopyID,
+		&hold.AnyEdition,
+		&hold.PickupBranchID,
+		&hold.Status,
+		&hold.ExpiresAt,
+		&hold.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &hold, nil
+}
+
+// GetAllForUser returns the holds placed by a user, most recent first. If activeOnly
+// is true, holds which have been fulfilled, cancelled or have expired are left out.
+func (m HoldModel) GetAllForUser(userID uuid.UUID, activeOnly bool) ([]*Hold, error) {
+	query := `
+SELECT id, created_at, book_id, user_id, copy_id, any_edition, pickup_branch_id, status, expires_at, version
+FROM holds
+WHERE user_id = $1
+AND (status IN ('waiting', 'in_transit', 'ready') OR NOT $2)
+ORDER BY created_at DESC, id ASC`
+
+	return m.query(query, userID, activeOnly)
+}
+
+// GetQueueForBook returns the active holds which a copy of a book could be used for, in
+// the order in which they will be served. As well as the holds on the book itself,
+// this includes "any edition" holds placed on other editions of the same work.
+func (m HoldModel) GetQueueForBook(bookID uuid.UUID) ([]*Hold, error) {
+	query := `
+SELECT id, created_at, book_id, user_id, copy_id, any_edition, pickup_branch_id, status, expires_at, version
+FROM holds
+WHERE status IN ('waiting', 'in_transit', 'ready')
+AND (book_id = $1 OR (any_edition AND book_id IN (
+	SELECT id FROM books WHERE work_id = (SELECT work_id FROM books WHERE id = $1)
+)))
+ORDER BY created_at ASC, id ASC`
+
+	return m.query(query, bookID)
+}
+
+func (m HoldModel) query(query string, args ...any) ([]*Hold, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := []*Hold{}
+	for rows.Next() {
+		var hold Hold
+		err := rows.Scan(
+			&hold.ID,
+			&hold.PlacedAt,
+			&hold.BookID,
+			&hold.UserID,
+			&hold.CopyID,
+			&hold.AnyEdition,
+			&hold.PickupBranchID,
+			&hold.Status,
+			&hold.ExpiresAt,
+			&hold.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, &hold)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// QueuePosition returns the 1-based position of the user's waiting hold in the queue
+// for a book, or 0 if the user isn't waiting for it. As in GetQueueForBook(), "any
+// edition" holds placed on other editions of the same work count towards the queue.
+func (m HoldModel) QueuePosition(bookID, userID uuid.UUID) (int, error) {
+	query := `
+SELECT count(*)
+FROM holds AS mine
+INNER JOIN holds AS queue ON queue.status = 'waiting'
+AND (queue.created_at, queue.id) <= (mine.created_at, mine.id)
+AND (queue.book_id = mine.book_id OR (queue.any_edition AND queue.book_id IN (
+	SELECT id FROM books WHERE work_id = (SELECT work_id FROM books WHERE id = mine.book_id)
+)))
+WHERE mine.book_id = $1 AND mine.user_id = $2 AND mine.status = 'waiting'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var position int
+	err := m.DB.QueryRowContext(ctx, query, bookID, userID).Scan(&position)
+	return position, err
+}
+
+// CountActiveForUser returns how many holds a user has which are still waiting, on
+// their way to the pickup branch or ready to collect.
+func (m HoldModel) CountActiveForUser(userID uuid.UUID) (int, error) {
+	query := `
+SELECT count(*)
+FROM holds
+WHERE user_id = $1 AND status IN ('waiting', 'in_transit', 'ready')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// Cancel cancels an active hold. If a copy had already been set aside for the hold it
+// is released back to the shelf, and the caller should call Allocate() to pass it on
+// to the next patron in the queue. The same goes for a copy which was about to be sent
+// to the hold's pickup branch; copies which are already on their way finish the trip.
+func (m HoldModel) Cancel(hold *Hold) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE holds
+SET status = 'cancelled', version = version + 1
+WHERE id = $1 AND version = $2 AND status IN ('waiting', 'in_transit', 'ready')
+RETURNING status, version`
+	err = tx.QueryRowContext(ctx, query, hold.ID, hold.Version).Scan(&hold.Status, &hold.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if hold.CopyID != nil {
+		query = `
+UPDATE book_copies
+SET status = 'available', version = version + 1
+WHERE id = $1 AND status = 'on_hold'`
+		_, err = tx.ExecContext(ctx, query, *hold.CopyID)
+		if err != nil {
+			return err
+		}
+
+		query = `
+WITH cancelled AS (
+	UPDATE transfers
+	SET status = 'cancelled', version = version + 1
+	WHERE hold_id = $1 AND status = 'requested'
+	RETURNING copy_id
+)
+UPDATE book_copies
+SET status = 'available', version = version + 1
+WHERE id IN (SELECT copy_id FROM cancelled) AND status = 'in_transit'`
+		_, err = tx.ExecContext(ctx, query, hold.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Allocate sets an available copy aside for the first waiting patron it can serve,
+// marking their hold as ready for pickup until expiresAt. Every edition of the given
+// book's work is considered: holds on a specific edition are served by copies of that
+// edition, and "any edition" holds by a copy of any of them, preferring the edition
+// the hold was placed on. Copies which are already at the hold's pickup branch are
+// preferred over all others; if there are none, a copy from another branch is chosen
+// and a transfer to the pickup branch is requested for it, leaving the hold in transit
+// until the copy arrives. Only copies which are loanable to the patron who placed the
+// hold are set aside for it, and a copy is never chosen again for a hold whose
+// transfer of it was cancelled. It returns the hold that was allocated, or nil if
+// there was nobody waiting who could be served by a copy on the shelf.
+func (m HoldModel) Allocate(bookID uuid.UUID, expiresAt time.Time) (*Hold, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the hold and the copy together. SKIP LOCKED means that two concurrent
+	// allocations for the same work will never pick the same rows.
+	query := `
+SELECT holds.id, holds.pickup_branch_id, book_copies.id, book_copies.current_branch_id
+FROM holds
+INNER JOIN users ON users.id = holds.user_id
+INNER JOIN books ON books.id = holds.book_id
+INNER JOIN book_copies ON book_copies.status = 'available'
+AND ` + loanableSQL("users.patron_type", "book_copies.item_type") + `
+AND (book_copies.book_id = holds.book_id OR (holds.any_edition AND book_copies.book_id IN (
+	SELECT id FROM books AS editions WHERE editions.work_id = books.work_id
+)))
+AND NOT EXISTS (
+	SELECT 1 FROM transfers
+	WHERE transfers.hold_id = holds.id AND transfers.copy_id = book_copies.id AND transfers.status = 'cancelled'
+)
+WHERE holds.status = 'waiting'
+AND books.work_id = (SELECT work_id FROM books WHERE id = $1)
+ORDER BY holds.created_at ASC, holds.id ASC,
+COALESCE(book_copies.current_branch_id = holds.pickup_branch_id, true) DESC,
+book_copies.book_id = holds.book_id DESC, book_copies.created_at ASC, book_copies.id ASC
+LIMIT 1
+FOR UPDATE OF holds, book_copies SKIP LOCKED`
+	var holdID, copyID, currentBranchID uuid.UUID
+	var pickupBranchID *uuid.UUID
+	err = tx.QueryRowContext(ctx, query, bookID).Scan(&holdID, &pickupBranchID, &copyID, &currentBranchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	if pickupBranchID != nil && *pickupBranchID != currentBranchID {
+		return m.allocateInTransit(ctx, tx, holdID, copyID, currentBranchID, *pickupBranchID)
+	}
+
+	query = `
+UPDATE book_copies
+SET status = 'on_hold', version = version + 1
+WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, copyID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+UPDATE holds
+SET status = 'ready', copy_id = $2, expires_at = $3, version = version + 1
+WHERE id = $1
+RETURNING id, created_at, book_id, user_id, copy_id, any_edition, pickup_branch_id, status, expires_at, version`
+	var hold Hold
+	err = tx.QueryRowContext(ctx, query, holdID, copyID, expiresAt).Scan(
+		&hold.ID,
+		&hold.PlacedAt,
+		&hold.BookID,
+		&hold.UserID,
+		&hold.CopyID,
+		&hold.AnyEdition,
+		&hold.PickupBranchID,
+		&hold.Status,
+		&hold.ExpiresAt,
+		&hold.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// allocateInTransit finishes an allocation for which the copy has to be sent to the
+// hold's pickup branch first. The hold only becomes ready for pickup once the transfer
+// is received.
+func (m HoldModel) allocateInTransit(ctx context.Context, tx *sql.Tx, holdID, copyID, fromBranchID, toBranchID uuid.UUID) (*Hold, error) {
+	query := `
+UPDATE book_copies
+SET status = 'in_transit', version = version + 1
+WHERE id = $1`
+	_, err := tx.ExecContext(ctx, query, copyID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+INSERT INTO transfers (copy_id, from_branch_id, to_branch_id, hold_id)
+VALUES ($1, $2, $3, $4)`
+	_, err = tx.ExecContext(ctx, query, copyID, fromBranchID, toBranchID, holdID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+UPDATE holds
+SET status = 'in_transit', copy_id = $2, version = version + 1
+WHERE id = $1
+RETURNING id, created_at, book_id, user_id, copy_id, any_edition, pickup_branch_id, status, expires_at, version`
+	var hold Hold
+	err = tx.QueryRowContext(ctx, query, holdID, copyID).Scan(
+		&hold.ID,
+		&hold.PlacedAt,
+		&hold.BookID,
+		&hold.UserID,
+		&hold.CopyID,
+		&hold.AnyEdition,
+		&hold.PickupBranchID,
+		&hold.Status,
+		&hold.ExpiresAt,
+		&hold.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// ExpireReady expires every hold which was not picked up in time and puts the copies
+// that were set aside for them back on the shelf. It returns the IDs of the affected
+// books so that the copies can be allocated to the next patrons in the queue.
+func (m HoldModel) ExpireReady(now time.Time) ([]uuid.UUID, error) {
+	query := `
+WITH expired AS (
+	UPDATE holds
+	SET status = 'expired', version = version + 1
+	WHERE status = 'ready' AND expires_at < $1
+	RETURNING book_id, copy_id
+), released AS (
+	UPDATE book_copies
+	SET status = 'available', version = version + 1
+	WHERE id IN (SELECT copy_id FROM expired) AND status = 'on_hold'
+)
+SELECT DISTINCT book_id FROM expired`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookIDs []uuid.UUID
+	for rows.Next() {
+		var bookID uuid.UUID
+		err := rows.Scan(&bookID)
+		if err != nil {
+			return nil, err
+		}
+		bookIDs = append(bookIDs, bookID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return bookIDs, nil
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"strings"
+)
+
+// NormalizeISBN strips the hyphens and spaces that ISBNs are usually printed with, and
+// upper-cases a trailing "x" check digit, so that "0-306-40615-x" becomes "030640615X".
+func NormalizeISBN(isbn string) string {
+	var b strings.Builder
+	for _, r := range isbn {
+		switch {
+		case r == '-' || r == ' ':
+			continue
+		case r == 'x':
+			b.WriteRune('X')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ValidISBN10 reports whether a normalized ISBN-10 has the right length and check
+// digit. The check digit may be "X", standing for 10.
+func ValidISBN10(isbn string) bool {
+	if len(isbn) != 10 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var digit int
+		switch c := isbn[i]; {
+		case c >= '0' && c <= '9':
+			digit = int(c - '0')
+		case c == 'X' && i == 9:
+			digit = 10
+		default:
+			return false
+		}
+		sum += digit * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+// ValidISBN13 reports whether a normalized ISBN-13 has the right length, starts with
+// one of the Bookland prefixes (978 or 979) and has the right check digit.
+func ValidISBN13(isbn string) bool {
+	if len(isbn) != 13 || !(strings.HasPrefix(isbn, "978") || strings.HasPrefix(isbn, "979")) {
+		return false
+	}
+	for i := 0; i < 13; i++ {
+		if isbn[i] < '0' || isbn[i] > '9' {
+			return false
+		}
+	}
+	return isbn13CheckDigit(isbn[:12]) == isbn[12]
+}
+
+// ISBN10To13 converts a valid ISBN-10 to its ISBN-13 form.
+func ISBN10To13(isbn string) string {
+	prefix := "978" + isbn[:9]
+	return prefix + string(isbn13CheckDigit(prefix))
+}
+
+// ToISBN13 normalizes an ISBN given in either form and converts a valid ISBN-10 to its
+// ISBN-13 form. Anything else is only normalized, for the caller to validate.
+func ToISBN13(isbn string) string {
+	isbn = NormalizeISBN(isbn)
+	if ValidISBN10(isbn) {
+		return ISBN10To13(isbn)
+	}
+	return isbn
+}
+
+// ISBN13To10 converts a valid ISBN-13 to its ISBN-10 form. Only ISBN-13s with the 978
+// prefix have an ISBN-10 equivalent, so ok is false for the 979 range.
+func ISBN13To10(isbn string) (string, bool) {
+	if !strings.HasPrefix(isbn, "978") {
+		return "", false
+	}
+	body := isbn[3:12]
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return body + "X", true
+	}
+	return body + string(rune('0'+check)), true
+}
+
+func isbn13CheckDigit(first12 string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		digit := int(first12[i] - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/Danik14/library/internal/assert"
+	"github.com/Danik14/library/internal/validator"
+)
+
+func TestISBN(t *testing.T) {
+	tests := []struct {
+		name       string
+		isbn       string
+		wantValid  bool
+		wantISBN10 string
+		wantISBN13 string
+	}{
+		{
+			name:       "ISBN-10 with hyphens",
+			isbn:       "0-306-40615-2",
+			wantValid:  true,
+			wantISBN10: "0306406152",
+			wantISBN13: "9780306406157",
+		},
+		{
+			name:       "ISBN-10 with X check digit",
+			isbn:       "0-8044-2957-x",
+			wantValid:  true,
+			wantISBN10: "080442957X",
+			wantISBN13: "9780804429573",
+		},
+		{
+			name:       "ISBN-13",
+			isbn:       "978-0-306-40615-7",
+			wantValid:  true,
+			wantISBN10: "0306406152",
+			wantISBN13: "9780306406157",
+		},
+		{
+			name:       "ISBN-13 in 979 range",
+			isbn:       "979-10-90636-07-1",
+			wantValid:  true,
+			wantISBN13: "9791090636071",
+		},
+		{
+			name:      "Bad ISBN-10 check digit",
+			isbn:      "0306406153",
+			wantValid: false,
+		},
+		{
+			name:      "Bad ISBN-13 check digit",
+			isbn:      "9780306406158",
+			wantValid: false,
+		},
+		{
+			name:      "Wrong length",
+			isbn:      "12345",
+			wantValid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := &Book{ISBN13: tt.isbn}
+			if len(NormalizeISBN(tt.isbn)) == 10 {
+				book = &Book{ISBN10: tt.isbn}
+			}
+
+			v := validator.New()
+			validateISBN(v, book)
+
+			assert.Equal(t, v.Valid(), tt.wantValid)
+			if tt.wantValid {
+				assert.Equal(t, book.ISBN10, tt.wantISBN10)
+				assert.Equal(t, book.ISBN13, tt.wantISBN13)
+			}
+		})
+	}
+}
+
+func TestToISBN13(t *testing.T) {
+	tests := []struct {
+		name string
+		isbn string
+		want string
+	}{
+		{name: "ISBN-10", isbn: "0-306-40615-2", want: "9780306406157"},
+		{name: "ISBN-13", isbn: "978-0-306-40615-7", want: "9780306406157"},
+		{name: "Invalid", isbn: "0-306-40615-3", want: "0306406153"},
+		{name: "Empty", isbn: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, ToISBN13(tt.isbn), tt.want)
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Danik14/library/internal/data"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	ErrCopyUnavailable = errors.New("copy unavailable")
+)
+
+// Loan records a single physical copy being lent to a user. A loan is active until
+// ReturnedAt is set.
+type Loan struct {
+	ID           uuid.UUID  `json:"id"`
+	CopyID       uuid.UUID  `json:"copy_id"`
+	BookID       uuid.UUID  `json:"book_id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	CheckedOutAt time.Time  `json:"checked_out_at"`
+	DueAt        time.Time  `json:"due_at"`
+	ReturnedAt   *time.Time `json:"returned_at,omitempty"`
+	Renewals     int        `json:"renewals"`
+	Version      int32      `json:"version"`
+}
+
+// IsActive reports whether the loaned copy is still with the borrower.
+func (l *Loan) IsActive() bool {
+	return l.ReturnedAt == nil
+}
+
+// DueDate calculates the due date for a loan starting at the given time. Loans are
+// always due at the very end of the day, so that a borrower who checks a book out in
+// the evening doesn't lose part of the last day of their loan period.
+func DueDate(from time.Time, period time.Duration) time.Time {
+	due := from.Add(period)
+	return time.Date(due.Year(), due.Month(), due.Day(), 23, 59, 59, 0, due.Location())
+}
+
+type LoanModel struct {
+	DB *sql.DB
+}
+
+// Checkout marks the copy as on loan and inserts the loan record in a single
+// transaction. If the copy isn't available for loan then ErrCopyUnavailable is
+// returned and nothing is changed. Callers should run HoldModel.Allocate() afterwards,
+// as checking out may release a copy that had been set aside for the borrower.
+func (m LoanModel) Checkout(loan *Loan) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Only flip the status if the copy is currently available, or if it has been set
+	// aside for this borrower's hold. If another request got there first, no row is
+	// returned.
+	query := `
+UPDATE book_copies
+SET status = 'on_loan', version = version + 1
+WHERE id = $1
+AND (status = 'available' OR (status = 'on_hold' AND EXISTS (
+	SELECT 1 FROM holds WHERE holds.copy_id = $1 AND holds.user_id = $2 AND holds.status = 'ready'
+)))
+RETURNING book_id`
+	err = tx.QueryRowContext(ctx, query, loan.CopyID, loan.UserID).Scan(&loan.BookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrCopyUnavailable
+		default:
+			return err
+		}
+	}
+
+	// Borrowing a title fulfils any hold the borrower had on it, including "any
+	// edition" holds on other editions of the same work and the hold this copy was
+	// set aside for. If a different copy had been set aside for them, that copy goes
+	// back on the shelf so that it can be allocated to the next patron in the queue.
+	query = `
+WITH fulfilled AS (
+	UPDATE holds
+	SET status = 'fulfilled', version = version + 1
+	WHERE user_id = $1 AND status IN ('waiting', 'in_transit', 'ready')
+	AND (book_id = $2 OR copy_id = $3 OR (any_edition AND book_id IN (
+		SELECT id FROM books WHERE work_id = (SELECT work_id FROM books WHERE id = $2)
+	)))
+	RETURNING copy_id
+)
+UPDATE book_copies
+SET status = 'available', version = version + 1
+WHERE id IN (SELECT copy_id FROM fulfilled) AND id <> $3 AND status = 'on_hold'`
+	_, err = tx.ExecContext(ctx, query, loan.UserID, loan.BookID, loan.CopyID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+INSERT INTO loans (copy_id, user_id, due_at)
+VALUES ($1, $2, $3)
+RETURNING id, created_at, renewals, version`
+	err = tx.QueryRowContext(ctx, query, loan.CopyID, loan.UserID, loan.DueAt).Scan(&loan.ID, &loan.CheckedOutAt, &loan.Renewals, &loan.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "loans_active_copy_idx"`:
+			return ErrCopyUnavailable
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m LoanModel) Get(id uuid.UUID) (*Loan, error) {
+	query := `
+SELECT loans.id, loans.copy_id, book_copies.book_id, loans.user_id, loans.created_at, loans.due_at, loans.returned_at, loans.renewals, loans.version
+FROM loans
+INNER JOIN book_copies ON book_copies.id = loans.copy_id
+WHERE loans.id = $1`
+	var loan Loan
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&loan.ID,
+		&loan.CopyID,
+		&loan.BookID,
+		&loan.UserID,
+		&loan.CheckedOutAt,
+		&loan.DueAt,
+		&loan.ReturnedAt,
+		&loan.Renewals,
+		&loan.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &loan, nil
+}
+
+// GetAllForUser returns a page of loans for a specific user. If activeOnly is true
+// then loans which have already been returned are left out.
+func (m LoanModel) GetAllForUser(userID uuid.UUID, activeOnly bool, filters data.Filters) ([]*Loan, data.Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), id, copy_id, (SELECT book_id FROM book_copies WHERE book_copies.id = loans.copy_id),
+user_id, created_at, due_at, returned_at, renewals, version
+FROM loans
+WHERE user_id = $1
+AND (returned_at IS NULL OR NOT $2)
+ORDER BY %s %s, id ASC
+LIMIT $3 OFFSET $4`, filters.SortColumn(), filters.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{userID, activeOnly, filters.Limit(), filters.Offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	loans := []*Loan{}
+	for rows.Next() {
+		var loan Loan
+		err := rows.Scan(
+			&totalRecords,
+			&loan.ID,
+			&loan.CopyID,
+			&loan.BookID,
+			&loan.UserID,
+			&loan.CheckedOutAt,
+			&loan.DueAt,
+			&loan.ReturnedAt,
+			&loan.Renewals,
+			&loan.Version,
+		)
+		if err != nil {
+			return nil, data.Metadata{}, err
+		}
+		loans = append(loans, &loan)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	metadata := data.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return loans, metadata, nil
+}
+
+// CountActiveForUser returns how many copies a user currently has out on loan.
+func (m LoanModel) CountActiveForUser(userID uuid.UUID) (int, error) {
+	query := `
+SELECT count(*)
+FROM loans
+WHERE user_id = $1 AND returned_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// Return closes an active loan and puts the copy back on the shelf. ErrEditConflict is
+// returned if the loan has changed (or was already returned) since it was read.
+func (m LoanModel) Return(loan *Loan) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE loans
+SET returned_at = NOW(), version = version + 1
+WHERE id = $1 AND version = $2 AND returned_at IS NULL
+RETURNING returned_at, version`
+	err = tx.QueryRowContext(ctx, query, loan.ID, loan.Version).Scan(&loan.ReturnedAt, &loan.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+UPDATE book_copies
+SET status = 'available', version = version + 1
+WHERE id = $1 AND status = 'on_loan'`
+	_, err = tx.ExecContext(ctx, query, loan.CopyID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Renew moves the due date of an active loan to loan.DueAt and increments its renewal
+// count. ErrEditConflict is returned if the loan has changed (or was returned) since it
+// was read.
+func (m LoanModel) Renew(loan *Loan) error {
+	query := `
+UPDATE loans
+SET due_at = $3, renewals = renewals + 1, version = version + 1
+WHERE id = $1 AND version = $2 AND returned_at IS NULL
+RETURNING renewals, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, loan.ID, loan.Version, loan.DueAt).Scan(&loan.Renewals, &loan.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
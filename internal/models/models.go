@@ -5,6 +5,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/Danik14/library/internal/cql"
 	"github.com/Danik14/library/internal/data"
 	uuid "github.com/satori/go.uuid"
 )
@@ -28,10 +29,155 @@ var (
 type Models struct {
 	Books interface {
 		Insert(book *Book) error
+		InsertAll(books []*Book) error
 		Get(id uuid.UUID) (*Book, error)
+		GetByISBN(isbn string) (*Book, error)
 		Update(book *Book) error
 		Delete(id uuid.UUID) error
-		GetAll(title string, author string, genres []string, filters data.Filters) ([]*Book, data.Metadata, error)
+		GetAll(title string, author string, genres []string, branchID uuid.UUID, filters data.Filters) ([]*Book, data.Metadata, error)
+		Each(title string, author string, genres []string, branchID uuid.UUID, filters data.Filters, fn func(*Book) error) error
+		GetAllForAuthor(authorID uuid.UUID, filters data.Filters) ([]*Book, data.Metadata, error)
+		Harvest(from, until time.Time, genre string, afterUpdate time.Time, afterID uuid.UUID, limit int) ([]*Book, error)
+		EarliestUpdate() (time.Time, error)
+		Search(query cql.Node, limit, offset int) ([]*Book, int, error)
+	}
+	Genres interface {
+		Insert(genre *Genre) error
+		Get(id uuid.UUID) (*Genre, error)
+		GetAll() ([]*Genre, error)
+		Taxonomy() (GenreTaxonomy, error)
+		Update(genre *Genre) error
+		Delete(id uuid.UUID) error
+		Merge(source, target *Genre) error
+	}
+	Works interface {
+		Get(id uuid.UUID) (*Work, error)
+		Update(work *Work) error
+		GetEditions(workID uuid.UUID) ([]*Edition, error)
+	}
+	Publishers interface {
+		Insert(publisher *Publisher) error
+		Get(id uuid.UUID) (*Publisher, error)
+		GetAll(name string, filters data.Filters) ([]*Publisher, data.Metadata, error)
+		Update(publisher *Publisher) error
+		Delete(id uuid.UUID) error
+	}
+	Authors interface {
+		Insert(author *Author) error
+		Get(id uuid.UUID) (*Author, error)
+		GetAll(name string, filters data.Filters) ([]*Author, data.Metadata, error)
+		Update(author *Author) error
+		Delete(id uuid.UUID) error
+		GetAllForBook(bookID uuid.UUID) ([]*BookAuthor, error)
+	}
+	Branches interface {
+		Insert(branch *Branch) error
+		Get(id uuid.UUID) (*Branch, error)
+		GetAll() ([]*Branch, error)
+		Update(branch *Branch) error
+		Delete(id uuid.UUID) error
+		AvailabilityForBook(bookID uuid.UUID) ([]*BranchAvailability, error)
+	}
+	Copies interface {
+		Insert(bookCopy *BookCopy) error
+		Get(id uuid.UUID) (*BookCopy, error)
+		GetByBarcode(barcode string) (*BookCopy, error)
+		GetAllForBook(bookID uuid.UUID) ([]*BookCopy, error)
+		Update(bookCopy *BookCopy) error
+		Delete(id uuid.UUID) error
+	}
+	Audits interface {
+		Insert(audit *Audit) error
+		Get(id uuid.UUID) (*Audit, error)
+		GetAll(branchID uuid.UUID, status string, filters data.Filters) ([]*Audit, data.Metadata, error)
+		AddScans(audit *Audit, barcodes []string) (int, error)
+		Close(audit *Audit) error
+		Report(audit *Audit) (*AuditReport, error)
+		MarkMissingLost(audit *Audit, copyIDs []uuid.UUID) ([]uuid.UUID, error)
+	}
+	Suggestions interface {
+		Insert(suggestion *Suggestion) error
+		Get(id uuid.UUID) (*Suggestion, error)
+		GetAll(status string, filters data.Filters) ([]*Suggestion, data.Metadata, error)
+		Vote(suggestion *Suggestion, userID uuid.UUID) error
+		Unvote(suggestion *Suggestion, userID uuid.UUID) error
+		Review(suggestion *Suggestion) error
+	}
+	Orders interface {
+		Insert(order *PurchaseOrder) error
+		Get(id uuid.UUID) (*PurchaseOrder, error)
+		GetAll(branchID, fundID uuid.UUID, status string, vendor string, filters data.Filters) ([]*PurchaseOrder, data.Metadata, error)
+		Update(order *PurchaseOrder) error
+		Cancel(order *PurchaseOrder) error
+		Receive(order *PurchaseOrder, book *Book, copies []*BookCopy) error
+		Invoice(order *PurchaseOrder) error
+	}
+	Funds interface {
+		Insert(fund *Fund) error
+		Get(id uuid.UUID) (*Fund, error)
+		GetAll() ([]*Fund, error)
+		Update(fund *Fund) error
+		InsertAllocation(allocation *FundAllocation) error
+		GetAllocations(fundID uuid.UUID, fiscalYear int) ([]*FundAllocation, error)
+		GetTransactions(fundID uuid.UUID, fiscalYear int) ([]*FundTransaction, error)
+		Balances(fiscalYear int, fundID uuid.UUID) ([]*FundBalance, error)
+	}
+	DigitalResources interface {
+		Insert(resource *DigitalResource) error
+		Get(id uuid.UUID) (*DigitalResource, error)
+		GetAllForBooks(bookIDs []uuid.UUID) (map[uuid.UUID][]*DigitalResource, error)
+		Delete(id uuid.UUID) error
+	}
+	Transfers interface {
+		Insert(transfer *Transfer) error
+		Get(id uuid.UUID) (*Transfer, error)
+		GetActiveForCopy(copyID uuid.UUID) (*Transfer, error)
+		GetAll(branchID uuid.UUID, status string, filters data.Filters) ([]*Transfer, data.Metadata, error)
+		Ship(transfer *Transfer) error
+		Receive(transfer *Transfer, expiresAt time.Time) error
+		Cancel(transfer *Transfer) error
+	}
+	Loans interface {
+		Checkout(loan *Loan) error
+		Get(id uuid.UUID) (*Loan, error)
+		GetAllForUser(userID uuid.UUID, activeOnly bool, filters data.Filters) ([]*Loan, data.Metadata, error)
+		CountActiveForUser(userID uuid.UUID) (int, error)
+		Return(loan *Loan) error
+		Renew(loan *Loan) error
+	}
+	Holds interface {
+		Insert(hold *Hold) error
+		Get(id uuid.UUID) (*Hold, error)
+		GetAllForUser(userID uuid.UUID, activeOnly bool) ([]*Hold, error)
+		GetQueueForBook(bookID uuid.UUID) ([]*Hold, error)
+		QueuePosition(bookID, userID uuid.UUID) (int, error)
+		CountActiveForUser(userID uuid.UUID) (int, error)
+		Cancel(hold *Hold) error
+		Allocate(bookID uuid.UUID, expiresAt time.Time) (*Hold, error)
+		ExpireReady(now time.Time) ([]uuid.UUID, error)
+	}
+	Fines interface {
+		Insert(fine *Fine) error
+		Get(id uuid.UUID) (*Fine, error)
+		Waive(charge *Fine, waiver *Fine) error
+		GetAllForUser(userID uuid.UUID) ([]*Fine, error)
+		Balance(userID uuid.UUID) (int64, error)
+		AccrueForLoan(loanID uuid.UUID, asOf time.Time) (*Fine, error)
+		AccrueOverdue(asOf time.Time) (int, error)
+		GetAllRules() ([]*FineRule, error)
+		SaveRule(rule *FineRule) error
+	}
+	Reminders interface {
+		GetPending(now time.Time, dueSoon time.Duration) ([]*Reminder, error)
+		Claim(reminder *Reminder) (bool, error)
+		Release(reminder *Reminder) error
+	}
+	Reviews interface {
+		Insert(review *Review) error
+		Get(id uuid.UUID) (*Review, error)
+		GetAllForBook(bookID uuid.UUID, filters data.Filters) ([]*Review, data.Metadata, error)
+		Update(review *Review) error
+		Delete(id uuid.UUID) error
 	}
 	Users interface {
 		Insert(user *User) error
@@ -42,6 +188,17 @@ type Models struct {
 		Delete(id uuid.UUID) error
 		GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	}
+	PatronTypes interface {
+		Get(code string) (*PatronType, error)
+		GetAll() ([]*PatronType, error)
+		Save(patronType *PatronType) error
+		Delete(code string) error
+	}
+	Policies interface {
+		GetAll() ([]*CirculationPolicy, error)
+		Save(policy *CirculationPolicy) error
+		Delete(patronType, itemType string) error
+	}
 	Tokens interface {
 		DeleteAllForUser(scope string, userID uuid.UUID) error
 		Insert(token *Token) error
@@ -57,16 +214,36 @@ type Models struct {
 // the initialized BookModel.
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Users:       UserModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Books:       BookModel{DB: db},
-		Tokens:      TokenModel{DB: db},
+		Users:            UserModel{DB: db},
+		PatronTypes:      PatronTypeModel{DB: db},
+		Policies:         CirculationPolicyModel{DB: db},
+		Permissions:      PermissionModel{DB: db},
+		Books:            BookModel{DB: db},
+		Genres:           GenreModel{DB: db},
+		Works:            WorkModel{DB: db},
+		Publishers:       PublisherModel{DB: db},
+		Authors:          AuthorModel{DB: db},
+		Branches:         BranchModel{DB: db},
+		Copies:           BookCopyModel{DB: db},
+		Audits:           AuditModel{DB: db},
+		Suggestions:      SuggestionModel{DB: db},
+		Orders:           PurchaseOrderModel{DB: db},
+		Funds:            FundModel{DB: db},
+		DigitalResources: DigitalResourceModel{DB: db},
+		Transfers:        TransferModel{DB: db},
+		Loans:            LoanModel{DB: db},
+		Holds:            HoldModel{DB: db},
+		Fines:            FineModel{DB: db},
+		Reminders:        ReminderModel{DB: db},
+		Reviews:          ReviewModel{DB: db},
+		Tokens:           TokenModel{DB: db},
 	}
 }
 
 func NewMockModels() Models {
 	return Models{
-		Books: MockBookModel{},
+		Books:  MockBookModel{},
+		Genres: MockGenreModel{},
 		// Users:       MockUserModel{},
 		// Tokens:      MockTokenModel{},
 		// Permissions: MockPermissionModel{},
@@ -0,0 +1,454 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Define constants for the lifecycle of a purchase order. An order is placed with a
+// vendor and is then either received or cancelled.
+const (
+	OrderStatusOrdered   = "ordered"
+	OrderStatusReceived  = "received"
+	OrderStatusCancelled = "cancelled"
+)
+
+var OrderStatuses = []string{OrderStatusOrdered, OrderStatusReceived, OrderStatusCancelled}
+
+// PurchaseOrder is an order placed with a vendor for copies of a book, which are shelved
+// at a branch when they arrive. It is paid for from a fund, in the fiscal year it was
+// placed in, and UnitPrice is in minor units of the fund's currency. Orders made from
+// a purchase suggestion record it.
+type PurchaseOrder struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	SuggestionID *uuid.UUID `json:"suggestion_id,omitempty"`
+	Title        string     `json:"title"`
+	Author       string     `json:"author,omitempty"`
+	ISBN13       string     `json:"isbn13,omitempty"`
+	Vendor       string     `json:"vendor"`
+	Quantity     int32      `json:"quantity"`
+	UnitPrice    int64      `json:"unit_price"`
+	FundID       *uuid.UUID `json:"fund_id,omitempty"`
+	// Currency is the currency of the order's fund. It is read from the fund and never
+	// written back to the purchase_orders table.
+	Currency   string     `json:"currency,omitempty"`
+	FiscalYear int        `json:"fiscal_year"`
+	BranchID   uuid.UUID  `json:"branch_id"`
+	OrderedBy  *uuid.UUID `json:"ordered_by,omitempty"`
+	Status     string     `json:"status"`
+	ReceivedAt *time.Time `json:"received_at,omitempty"`
+	// The invoice for the order records what was actually paid, which may differ from
+	// the ordered total.
+	InvoiceNumber  string     `json:"invoice_number,omitempty"`
+	InvoicedAmount *int64     `json:"invoiced_amount,omitempty"`
+	InvoicedAt     *time.Time `json:"invoiced_at,omitempty"`
+	// BookID is the book the order was catalogued as when it was received.
+	BookID  *uuid.UUID `json:"book_id,omitempty"`
+	Version int32      `json:"version"`
+}
+
+// Total returns the price of all the copies ordered.
+func (o *PurchaseOrder) Total() int64 {
+	return int64(o.Quantity) * o.UnitPrice
+}
+
+// IsInvoiced reports whether the invoice for the order has been recorded.
+func (o *PurchaseOrder) IsInvoiced() bool {
+	return o.InvoicedAt != nil
+}
+
+type PurchaseOrderModel struct {
+	DB *sql.DB
+}
+
+// Insert places an order and encumbers its total against its fund, returning
+// ErrInsufficientFunds if the fund can't cover it. If it is made from a suggestion, the
+// suggestion is marked as ordered in the same transaction, and ErrEditConflict is
+// returned if it is no longer open.
+func (m PurchaseOrderModel) Insert(order *PurchaseOrder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if order.SuggestionID != nil {
+		query := `
+UPDATE purchase_suggestions
+SET status = 'ordered', version = version + 1
+WHERE id = $1 AND status IN ('pending', 'accepted')`
+		result, err := tx.ExecContext(ctx, query, order.SuggestionID)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrEditConflict
+		}
+	}
+
+	query := `
+INSERT INTO purchase_orders (suggestion_id, title, author, isbn13, vendor, quantity, unit_price, fund_id, fiscal_year, branch_id, ordered_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING id, created_at, COALESCE((SELECT currency FROM funds WHERE funds.id = purchase_orders.fund_id), ''), status, version`
+	args := []any{order.SuggestionID, order.Title, order.Author, order.ISBN13, order.Vendor, order.Quantity, order.UnitPrice,
+		order.FundID, order.FiscalYear, order.BranchID, order.OrderedBy}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&order.ID, &order.CreatedAt, &order.Currency, &order.Status, &order.Version)
+	if err != nil {
+		return err
+	}
+
+	err = encumber(ctx, tx, order)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m PurchaseOrderModel) Get(id uuid.UUID) (*PurchaseOrder, error) {
+	query := `
+SELECT id, created_at, suggestion_id, title, author, isbn13, vendor, quantity, unit_price, fund_id,
+COALESCE((SELECT currency FROM funds WHERE funds.id = purchase_orders.fund_id), ''), fiscal_year, branch_id, ordered_by,
+status, received_at, invoice_number, invoiced_amount, invoiced_at, book_id, version
+FROM purchase_orders
+WHERE id = $1`
+
+	var order PurchaseOrder
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&order.ID,
+		&order.CreatedAt,
+		&order.SuggestionID,
+		&order.Title,
+		&order.Author,
+		&order.ISBN13,
+		&order.Vendor,
+		&order.Quantity,
+		&order.UnitPrice,
+		&order.FundID,
+		&order.Currency,
+		&order.FiscalYear,
+		&order.BranchID,
+		&order.OrderedBy,
+		&order.Status,
+		&order.ReceivedAt,
+		&order.InvoiceNumber,
+		&order.InvoicedAmount,
+		&order.InvoicedAt,
+		&order.BookID,
+		&order.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &order, nil
+}
+
+// GetAll returns a page of orders, optionally only those for a branch, paid from a
+// fund, with a given status or placed with a vendor.
+func (m PurchaseOrderModel) GetAll(branchID, fundID uuid.UUID, status string, vendor string, filters data.Filters) ([]*PurchaseOrder, data.Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), id, created_at, suggestion_id, title, author, isbn13, vendor, quantity, unit_price, fund_id,
+COALESCE((SELECT currency FROM funds WHERE funds.id = purchase_orders.fund_id), ''), fiscal_year, branch_id,
+ordered_by, status, received_at, invoice_number, invoiced_amount, invoiced_at, book_id, version
+FROM purchase_orders
+WHERE ($1::uuid IS NULL OR branch_id = $1)
+AND ($2::uuid IS NULL OR fund_id = $2)
+AND (status = $3 OR $3 = '')
+AND (lower(vendor) = lower($4) OR $4 = '')
+ORDER BY %s %s, id ASC
+LIMIT $5 OFFSET $6`, filters.SortColumn(), filters.SortDirection())
+
+	var branch, fund *uuid.UUID
+	if branchID != uuid.Nil {
+		branch = &branchID
+	}
+	if fundID != uuid.Nil {
+		fund = &fundID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, branch, fund, status, vendor, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	orders := []*PurchaseOrder{}
+	for rows.Next() {
+		var order PurchaseOrder
+		err := rows.Scan(
+			&totalRecords,
+			&order.ID,
+			&order.CreatedAt,
+			&order.SuggestionID,
+			&order.Title,
+			&order.Author,
+			&order.ISBN13,
+			&order.Vendor,
+			&order.Quantity,
+			&order.UnitPrice,
+			&order.FundID,
+			&order.Currency,
+			&order.FiscalYear,
+			&order.BranchID,
+			&order.OrderedBy,
+			&order.Status,
+			&order.ReceivedAt,
+			&order.InvoiceNumber,
+			&order.InvoicedAmount,
+			&order.InvoicedAt,
+			&order.BookID,
+			&order.Version,
+		)
+		if err != nil {
+			return nil, data.Metadata{}, err
+		}
+		orders = append(orders, &order)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	metadata := data.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return orders, metadata, nil
+}
+
+// Update saves the changes to an order which hasn't been received, cancelled or
+// invoiced yet. Its encumbrance is released and its new total encumbered against its
+// (possibly new) fund and fiscal year, so ErrInsufficientFunds is returned if the fund
+// can't cover it.
+// The unit price is taken to be in the currency of the new fund, so the caller must
+// make sure it was given in that currency.
+func (m PurchaseOrderModel) Update(order *PurchaseOrder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE purchase_orders
+SET title = $1, author = $2, isbn13 = $3, vendor = $4, quantity = $5, unit_price = $6, fund_id = $7, fiscal_year = $8,
+branch_id = $9, version = version + 1
+WHERE id = $10 AND version = $11 AND status = 'ordered' AND invoiced_at IS NULL
+RETURNING COALESCE((SELECT currency FROM funds WHERE funds.id = purchase_orders.fund_id), ''), version`
+	args := []any{order.Title, order.Author, order.ISBN13, order.Vendor, order.Quantity, order.UnitPrice, order.FundID,
+		order.FiscalYear, order.BranchID, order.ID, order.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&order.Currency, &order.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = release(ctx, tx, order.ID)
+	if err != nil {
+		return err
+	}
+	err = encumber(ctx, tx, order)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Cancel cancels an order which hasn't been received or invoiced, releasing its
+// encumbrance. A suggestion the order was made from is accepted again so that it can
+// be reordered, unless the book has been suggested again in the meantime.
+func (m PurchaseOrderModel) Cancel(order *PurchaseOrder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE purchase_orders
+SET status = 'cancelled', version = version + 1
+WHERE id = $1 AND version = $2 AND status = 'ordered' AND invoiced_at IS NULL
+RETURNING status, version`
+	err = tx.QueryRowContext(ctx, query, order.ID, order.Version).Scan(&order.Status, &order.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = release(ctx, tx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	if order.SuggestionID != nil {
+		query = `
+UPDATE purchase_suggestions
+SET status = 'accepted', version = version + 1
+WHERE id = $1 AND status = 'ordered'
+AND NOT EXISTS (
+	SELECT 1 FROM purchase_suggestions AS other
+	WHERE other.isbn13 = purchase_suggestions.isbn13 AND other.isbn13 <> '' AND other.status IN ('pending', 'accepted')
+)`
+		_, err = tx.ExecContext(ctx, query, order.SuggestionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Receive records that an order has arrived, in a single transaction with adding its
+// copies to the catalog. If book has no ID it is a new record and is added first;
+// otherwise the copies are added to the existing book. ErrDuplicateISBN,
+// ErrDuplicateBarcode and ErrDuplicateAccessionNumber are returned if the book or any
+// of the copies clash with the catalog. The copies are new on the shelf, so the caller
+// should call HoldModel.Allocate() for the book.
+func (m PurchaseOrderModel) Receive(order *PurchaseOrder, book *Book, copies []*BookCopy) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if book.ID == uuid.Nil {
+		err = insertBook(ctx, tx, book)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+UPDATE purchase_orders
+SET status = 'received', received_at = NOW(), book_id = $3, version = version + 1
+WHERE id = $1 AND version = $2 AND status = 'ordered'
+RETURNING status, received_at, book_id, version`
+	err = tx.QueryRowContext(ctx, query, order.ID, order.Version, book.ID).Scan(&order.Status, &order.ReceivedAt, &order.BookID, &order.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	for _, bookCopy := range copies {
+		bookCopy.BookID = book.ID
+		err = tx.QueryRowContext(ctx, insertCopyQuery, insertCopyArgs(bookCopy)...).Scan(&bookCopy.ID, &bookCopy.CreatedAt, &bookCopy.Version)
+		if err != nil {
+			return copyConstraintError(err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Invoice records the invoice for an order which hasn't been cancelled, with the
+// InvoiceNumber and InvoicedAmount set by the caller. The order's encumbrance is
+// released and the invoiced amount charged to its fund as an expenditure, in the same
+// fiscal year. What was invoiced is what was spent, so the fund may be overspent.
+func (m PurchaseOrderModel) Invoice(order *PurchaseOrder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE purchase_orders
+SET invoice_number = $1, invoiced_amount = $2, invoiced_at = NOW(), version = version + 1
+WHERE id = $3 AND version = $4 AND status <> 'cancelled' AND invoiced_at IS NULL
+RETURNING invoiced_at, version`
+	args := []any{order.InvoiceNumber, order.InvoicedAmount, order.ID, order.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&order.InvoicedAt, &order.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = release(ctx, tx, order.ID)
+	if err != nil {
+		return err
+	}
+	if entry := expenditure(order); entry != nil {
+		err = insertFundTransaction(ctx, tx, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func ValidatePurchaseOrder(v *validator.Validator, order *PurchaseOrder) {
+	v.Check(order.Title != "", "title", "must be provided")
+	v.Check(len(order.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(len(order.Author) <= 500, "author", "must not be more than 500 bytes long")
+
+	order.ISBN13 = ToISBN13(order.ISBN13)
+	v.Check(order.ISBN13 == "" || ValidISBN13(order.ISBN13), "isbn", "must be a valid ISBN-10 or ISBN-13")
+
+	v.Check(order.Vendor != "", "vendor", "must be provided")
+	v.Check(len(order.Vendor) <= 200, "vendor", "must not be more than 200 bytes long")
+	v.Check(order.Quantity > 0, "quantity", "must be greater than zero")
+	v.Check(order.Quantity <= 1000, "quantity", "must not be more than 1000")
+	v.Check(order.UnitPrice >= 0, "unit_price", "must not be negative")
+	v.Check(order.UnitPrice <= MaxAmount, "unit_price", fmt.Sprintf("must not be more than %d", int64(MaxAmount)))
+	v.Check(order.FundID != nil, "fund_id", "must be provided")
+	v.Check(order.FiscalYear >= 1900 && order.FiscalYear <= 9999, "fiscal_year", "must be a valid year")
+	v.Check(order.BranchID != uuid.Nil, "branch_id", "must be provided")
+}
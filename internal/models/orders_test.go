@@ -0,0 +1,161 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Danik14/library/internal/assert"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+func newTestOrder(t *testing.T, m PurchaseOrderModel, branch *Branch, suggestion *Suggestion) *PurchaseOrder {
+	t.Helper()
+
+	order := &PurchaseOrder{
+		Title:      "Test order",
+		Author:     "Test Author",
+		ISBN13:     newTestISBN13(),
+		Vendor:     "Test vendor",
+		Quantity:   2,
+		UnitPrice:  1000,
+		FiscalYear: 2026,
+		BranchID:   branch.ID,
+	}
+	if suggestion != nil {
+		order.SuggestionID = &suggestion.ID
+		order.ISBN13 = suggestion.ISBN13
+	}
+	if err := m.Insert(order); err != nil {
+		t.Fatal(err)
+	}
+	cleanup(t, m.DB, `DELETE FROM purchase_orders WHERE id = $1`, order.ID)
+	return order
+}
+
+func TestPurchaseOrderCancel(t *testing.T) {
+	db := newTestDB(t)
+	m := PurchaseOrderModel{DB: db}
+	suggestions := SuggestionModel{DB: db}
+
+	branch := newTestBranch(t, db)
+	suggestion := newTestSuggestion(t, suggestions, newTestUser(t, db))
+
+	order := newTestOrder(t, m, branch, suggestion)
+	stored, err := suggestions.Get(suggestion.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, stored.Status, SuggestionStatusOrdered)
+
+	assert.NilError(t, m.Cancel(order))
+	assert.Equal(t, order.Status, OrderStatusCancelled)
+
+	// The suggestion is open again, but as accepted rather than pending, since staff
+	// had already decided to buy the book.
+	stored, err = suggestions.Get(suggestion.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, stored.Status, SuggestionStatusAccepted)
+
+	// A cancelled order can't be cancelled again.
+	assert.Equal(t, errors.Is(m.Cancel(order), ErrEditConflict), true)
+}
+
+func TestPurchaseOrderReceive(t *testing.T) {
+	db := newTestDB(t)
+	m := PurchaseOrderModel{DB: db}
+	books := BookModel{DB: db}
+	orders := PurchaseOrderModel{DB: db}
+
+	branch := newTestBranch(t, db)
+	order := newTestOrder(t, m, branch, nil)
+
+	newBook := func() *Book {
+		return &Book{Title: order.Title, Author: order.Author, Year: 2026, Pages: 100, Genres: []string{"fiction"}, ISBN13: order.ISBN13}
+	}
+	newCopies := func(barcodes ...string) []*BookCopy {
+		copies := []*BookCopy{}
+		for _, barcode := range barcodes {
+			copies = append(copies, &BookCopy{
+				Barcode:         barcode,
+				ItemType:        DefaultItemType,
+				HomeBranchID:    branch.ID,
+				CurrentBranchID: branch.ID,
+				Condition:       "new",
+				Status:          CopyStatusAvailable,
+			})
+		}
+		return copies
+	}
+	deleteBook := func(isbn string) {
+		cleanup(t, db, `
+WITH deleted AS (DELETE FROM books WHERE isbn13 = $1 RETURNING work_id)
+DELETE FROM works WHERE id IN (SELECT work_id FROM deleted)`, isbn)
+	}
+	deleteBook(order.ISBN13)
+
+	t.Run("Duplicate barcode", func(t *testing.T) {
+		// The second copy clashes with the first, so nothing is received: not the new
+		// book, nor the first copy, nor the order's status.
+		barcode := "T" + uuid.NewV4().String()
+		err := m.Receive(order, newBook(), newCopies(barcode, barcode))
+		assert.Equal(t, errors.Is(err, ErrDuplicateBarcode), true)
+
+		_, err = books.GetByISBN(order.ISBN13)
+		assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+		var copies int
+		assert.NilError(t, db.QueryRow(`SELECT count(*) FROM book_copies WHERE barcode = $1`, barcode).Scan(&copies))
+		assert.Equal(t, copies, 0)
+
+		stored, err := orders.Get(order.ID)
+		assert.NilError(t, err)
+		assert.Equal(t, stored.Status, OrderStatusOrdered)
+		assert.Equal(t, stored.BookID == nil, true)
+	})
+
+	t.Run("Received", func(t *testing.T) {
+		stored, err := orders.Get(order.ID)
+		assert.NilError(t, err)
+
+		book := newBook()
+		copies := newCopies("T"+uuid.NewV4().String(), "T"+uuid.NewV4().String())
+		assert.NilError(t, m.Receive(stored, book, copies))
+		assert.Equal(t, stored.Status, OrderStatusReceived)
+		assert.Equal(t, *stored.BookID, book.ID)
+
+		shelved, err := BookCopyModel{DB: db}.GetAllForBook(book.ID)
+		assert.NilError(t, err)
+		assert.Equal(t, len(shelved), 2)
+
+		// An order is only received once.
+		err = m.Receive(stored, book, newCopies("T"+uuid.NewV4().String()))
+		assert.Equal(t, errors.Is(err, ErrEditConflict), true)
+	})
+}
+
+func TestValidatePurchaseOrder(t *testing.T) {
+	fundID := uuid.NewV4()
+
+	tests := []struct {
+		name      string
+		unitPrice int64
+		wantValid bool
+	}{
+		{name: "Free", unitPrice: 0, wantValid: true},
+		{name: "Largest price", unitPrice: MaxAmount, wantValid: true},
+		{name: "Negative", unitPrice: -1, wantValid: false},
+		{name: "Too large", unitPrice: MaxAmount + 1, wantValid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &PurchaseOrder{Title: "Dune", Vendor: "Test vendor", Quantity: 1000, UnitPrice: tt.unitPrice, FundID: &fundID, FiscalYear: 2026, BranchID: uuid.NewV4()}
+			v := validator.New()
+			ValidatePurchaseOrder(v, order)
+			assert.Equal(t, v.Valid(), tt.wantValid)
+			// The largest order must still be totalled without overflowing.
+			if tt.wantValid {
+				assert.Equal(t, order.Total()/int64(order.Quantity), tt.unitPrice)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"strconv"
@@ -79,3 +80,9 @@ func (c *CivilTime) UnmarshalJSON(b []byte) error {
 func (c CivilTime) MarshalJSON() ([]byte, error) {
 	return []byte(`"` + time.Time(c).Format("2006-01-02") + `"`), nil
 }
+
+// Value implements the driver.Valuer interface, so that a CivilTime can be stored in
+// a date column.
+func (c CivilTime) Value() (driver.Value, error) {
+	return time.Time(c), nil
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Danik14/library/internal/validator"
+)
+
+var (
+	ErrPatronTypeInUse = errors.New("patron type in use")
+)
+
+// DefaultPatronType is the patron type given to new users.
+const DefaultPatronType = "standard"
+
+// PatronType holds the borrowing limits shared by a category of patrons, such as
+// students, staff or external readers. Patrons who owe more than the fine cap can't
+// borrow, renew or place holds until they have paid.
+type PatronType struct {
+	Code           string `json:"code"`
+	Name           string `json:"name"`
+	MaxLoans       int    `json:"max_loans"`
+	LoanPeriodDays int    `json:"loan_period_days"`
+	MaxHolds       int    `json:"max_holds"`
+	MaxRenewals    int    `json:"max_renewals"`
+	FineCap        int64  `json:"fine_cap"`
+	Version        int32  `json:"version"`
+}
+
+// LoanPeriod returns the loan period of the patron type as a duration.
+func (t *PatronType) LoanPeriod() time.Duration {
+	return time.Duration(t.LoanPeriodDays) * 24 * time.Hour
+}
+
+type PatronTypeModel struct {
+	DB *sql.DB
+}
+
+func (m PatronTypeModel) Get(code string) (*PatronType, error) {
+	query := `
+SELECT code, name, max_loans, loan_period_days, max_holds, max_renewals, fine_cap, version
+FROM patron_types
+WHERE code = $1`
+	var patronType PatronType
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, code).Scan(
+		&patronType.Code,
+		&patronType.Name,
+		&patronType.MaxLoans,
+		&patronType.LoanPeriodDays,
+		&patronType.MaxHolds,
+		&patronType.MaxRenewals,
+		&patronType.FineCap,
+		&patronType.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &patronType, nil
+}
+
+func (m PatronTypeModel) GetAll() ([]*PatronType, error) {
+	query := `
+SELECT code, name, max_loans, loan_period_days, max_holds, max_renewals, fine_cap, version
+FROM patron_types
+ORDER BY code ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	patronTypes := []*PatronType{}
+	for rows.Next() {
+		var patronType PatronType
+		err := rows.Scan(
+			&patronType.Code,
+			&patronType.Name,
+			&patronType.MaxLoans,
+			&patronType.LoanPeriodDays,
+			&patronType.MaxHolds,
+			&patronType.MaxRenewals,
+			&patronType.FineCap,
+			&patronType.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		patronTypes = append(patronTypes, &patronType)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return patronTypes, nil
+}
+
+// Save creates a patron type, or replaces its name and limits if it already exists. A
+// patron type with a version of 0 is created; otherwise the saved version must match.
+// If the patron type already exists when creating it, or has changed since it was
+// read, ErrEditConflict is returned.
+func (m PatronTypeModel) Save(patronType *PatronType) error {
+	query := `
+INSERT INTO patron_types (code, name, max_loans, loan_period_days, max_holds, max_renewals, fine_cap)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (code) DO UPDATE
+SET name = EXCLUDED.name, max_loans = EXCLUDED.max_loans, loan_period_days = EXCLUDED.loan_period_days,
+max_holds = EXCLUDED.max_holds, max_renewals = EXCLUDED.max_renewals, fine_cap = EXCLUDED.fine_cap,
+version = patron_types.version + 1
+WHERE patron_types.version = $8
+RETURNING version`
+	args := []any{patronType.Code, patronType.Name, patronType.MaxLoans, patronType.LoanPeriodDays,
+		patronType.MaxHolds, patronType.MaxRenewals, patronType.FineCap, patronType.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&patronType.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a patron type. Types which are still assigned to any users can't be
+// deleted, and ErrPatronTypeInUse is returned instead.
+func (m PatronTypeModel) Delete(code string) error {
+	query := `
+DELETE FROM patron_types WHERE code = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, code)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: update or delete on table "patron_types" violates foreign key constraint "users_patron_type_fkey" on table "users"`:
+			return ErrPatronTypeInUse
+		default:
+			return err
+		}
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func ValidatePatronType(v *validator.Validator, patronType *PatronType) {
+	v.Check(validator.Matches(patronType.Code, ItemTypeRX), "code", "must be a lowercase identifier")
+	v.Check(len(patronType.Code) <= 50, "code", "must not be more than 50 bytes long")
+
+	v.Check(patronType.Name != "", "name", "must be provided")
+	v.Check(len(patronType.Name) <= 200, "name", "must not be more than 200 bytes long")
+
+	v.Check(patronType.MaxLoans >= 0, "max_loans", "must not be negative")
+	v.Check(patronType.LoanPeriodDays > 0, "loan_period_days", "must be more than 0")
+	v.Check(patronType.LoanPeriodDays <= 365, "loan_period_days", "must not be more than 365")
+	v.Check(patronType.MaxHolds >= 0, "max_holds", "must not be negative")
+	v.Check(patronType.MaxRenewals >= 0, "max_renewals", "must not be negative")
+	v.Check(patronType.FineCap >= 0, "fine_cap", "must not be negative")
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Danik14/library/internal/validator"
+)
+
+// AnyType is used in place of a patron type or item type in a circulation policy
+// which applies to all of them.
+const AnyType = "any"
+
+// CirculationPolicy holds the lending rules for one combination of patron type and
+// item type. Copies of item types which aren't loanable can only be used in the
+// library. A nil loan period or renewal limit leaves the patron type's own limit in
+// place.
+type CirculationPolicy struct {
+	PatronType     string `json:"patron_type"`
+	ItemType       string `json:"item_type"`
+	Loanable       bool   `json:"loanable"`
+	LoanPeriodDays *int   `json:"loan_period_days"`
+	MaxRenewals    *int   `json:"max_renewals"`
+	Version        int32  `json:"version"`
+}
+
+// ResolvedPolicy is the outcome of applying the circulation policies to a patron type
+// and an item type. Policy is the policy which matched, or nil if none did, and
+// Explanation says in words where each of the rules came from.
+type ResolvedPolicy struct {
+	PatronType     string             `json:"patron_type"`
+	ItemType       string             `json:"item_type"`
+	Loanable       bool               `json:"loanable"`
+	LoanPeriodDays int                `json:"loan_period_days"`
+	MaxRenewals    int                `json:"max_renewals"`
+	Policy         *CirculationPolicy `json:"policy"`
+	Explanation    string             `json:"explanation"`
+}
+
+// LoanPeriod returns the resolved loan period as a duration.
+func (p *ResolvedPolicy) LoanPeriod() time.Duration {
+	return time.Duration(p.LoanPeriodDays) * 24 * time.Hour
+}
+
+// ResolvePolicy picks the most specific of the policies which apply to a patron type
+// and item type, and layers it over the patron type's limits. A policy for the exact
+// pair wins, then one for the item type and any patron type, then one for the patron
+// type and any item type, and finally the policy for any of both. If no policy
+// matches, the item is loanable on the patron type's terms.
+func ResolvePolicy(policies []*CirculationPolicy, patronType *PatronType, itemType string) *ResolvedPolicy {
+	resolved := &ResolvedPolicy{
+		PatronType:     patronType.Code,
+		ItemType:       itemType,
+		Loanable:       true,
+		LoanPeriodDays: patronType.LoanPeriodDays,
+		MaxRenewals:    patronType.MaxRenewals,
+	}
+
+	candidates := [][2]string{
+		{patronType.Code, itemType},
+		{AnyType, itemType},
+		{patronType.Code, AnyType},
+		{AnyType, AnyType},
+	}
+	for _, candidate := range candidates {
+		for _, policy := range policies {
+			if policy.PatronType == candidate[0] && policy.ItemType == candidate[1] {
+				resolved.Policy = policy
+				break
+			}
+		}
+		if resolved.Policy != nil {
+			break
+		}
+	}
+
+	policy := resolved.Policy
+	if policy == nil {
+		resolved.Explanation = fmt.Sprintf("no policy applies to %s patrons borrowing %s items, so the limits of the patron type are used", patronType.Code, itemType)
+		return resolved
+	}
+
+	explanation := fmt.Sprintf("policy for %s patrons and %s items applies", policy.PatronType, policy.ItemType)
+	if !policy.Loanable {
+		resolved.Loanable = false
+		resolved.Explanation = explanation + "; items are for use in the library only"
+		return resolved
+	}
+	if policy.LoanPeriodDays != nil {
+		resolved.LoanPeriodDays = *policy.LoanPeriodDays
+		explanation += fmt.Sprintf("; loan period of %d days set by the policy", resolved.LoanPeriodDays)
+	} else {
+		explanation += fmt.Sprintf("; loan period of %d days taken from the patron type", resolved.LoanPeriodDays)
+	}
+	if policy.MaxRenewals != nil {
+		resolved.MaxRenewals = *policy.MaxRenewals
+		explanation += fmt.Sprintf("; %d renewals allowed by the policy", resolved.MaxRenewals)
+	} else {
+		explanation += fmt.Sprintf("; %d renewals allowed by the patron type", resolved.MaxRenewals)
+	}
+	resolved.Explanation = explanation
+
+	return resolved
+}
+
+// loanableSQL returns an SQL expression which is true if items of the item type given
+// by the itemType expression can be loaned to patrons of the type given by the
+// patronType expression. Policies take precedence in the same order as in
+// ResolvePolicy().
+func loanableSQL(patronType, itemType string) string {
+	return fmt.Sprintf(`COALESCE((
+	SELECT circulation_policies.loanable FROM circulation_policies
+	WHERE circulation_policies.patron_type IN (%[1]s, 'any') AND circulation_policies.item_type IN (%[2]s, 'any')
+	ORDER BY circulation_policies.item_type = 'any' ASC, circulation_policies.patron_type = 'any' ASC
+	LIMIT 1
+), true)`, patronType, itemType)
+}
+
+type CirculationPolicyModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns every circulation policy, ordered by patron type and item type.
+// There is at most one policy for each pair of types, so the list isn't paginated.
+func (m CirculationPolicyModel) GetAll() ([]*CirculationPolicy, error) {
+	query := `
+SELECT patron_type, item_type, loanable, loan_period_days, max_renewals, version
+FROM circulation_policies
+ORDER BY patron_type ASC, item_type ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []*CirculationPolicy{}
+	for rows.Next() {
+		var policy CirculationPolicy
+		err := rows.Scan(
+			&policy.PatronType,
+			&policy.ItemType,
+			&policy.Loanable,
+			&policy.LoanPeriodDays,
+			&policy.MaxRenewals,
+			&policy.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, &policy)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// Save creates the policy for a pair of types, or replaces it if one already exists.
+func (m CirculationPolicyModel) Save(policy *CirculationPolicy) error {
+	query := `
+INSERT INTO circulation_policies (patron_type, item_type, loanable, loan_period_days, max_renewals)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (patron_type, item_type) DO UPDATE
+SET loanable = EXCLUDED.loanable, loan_period_days = EXCLUDED.loan_period_days, max_renewals = EXCLUDED.max_renewals,
+version = circulation_policies.version + 1
+RETURNING version`
+	args := []any{policy.PatronType, policy.ItemType, policy.Loanable, policy.LoanPeriodDays, policy.MaxRenewals}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&policy.Version)
+}
+
+func (m CirculationPolicyModel) Delete(patronType, itemType string) error {
+	query := `
+DELETE FROM circulation_policies WHERE patron_type = $1 AND item_type = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, patronType, itemType)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func ValidateCirculationPolicy(v *validator.Validator, policy *CirculationPolicy) {
+	v.Check(validator.Matches(policy.PatronType, ItemTypeRX), "patron_type", "must be a lowercase identifier")
+	v.Check(validator.Matches(policy.ItemType, ItemTypeRX), "item_type", "must be a lowercase identifier")
+
+	if policy.LoanPeriodDays != nil {
+		v.Check(*policy.LoanPeriodDays > 0, "loan_period_days", "must be more than 0")
+		v.Check(*policy.LoanPeriodDays <= 365, "loan_period_days", "must not be more than 365")
+	}
+	if policy.MaxRenewals != nil {
+		v.Check(*policy.MaxRenewals >= 0, "max_renewals", "must not be negative")
+	}
+}
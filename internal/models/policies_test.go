@@ -0,0 +1,93 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/Danik14/library/internal/assert"
+)
+
+func TestResolvePolicy(t *testing.T) {
+	days := func(n int) *int { return &n }
+
+	staff := &PatronType{Code: "staff", LoanPeriodDays: 60, MaxRenewals: 5}
+	policies := []*CirculationPolicy{
+		{PatronType: AnyType, ItemType: "reference", Loanable: false},
+		{PatronType: AnyType, ItemType: "dvd", Loanable: true, LoanPeriodDays: days(3)},
+		{PatronType: "staff", ItemType: "dvd", Loanable: true, LoanPeriodDays: days(7), MaxRenewals: days(1)},
+		{PatronType: "staff", ItemType: AnyType, Loanable: true, MaxRenewals: days(10)},
+		{PatronType: AnyType, ItemType: AnyType, Loanable: true, LoanPeriodDays: days(14)},
+	}
+
+	tests := []struct {
+		name           string
+		policies       []*CirculationPolicy
+		patronType     *PatronType
+		itemType       string
+		wantLoanable   bool
+		wantLoanPeriod int
+		wantRenewals   int
+		wantMatched    bool
+	}{
+		{
+			name:           "No policies",
+			policies:       nil,
+			patronType:     staff,
+			itemType:       "book",
+			wantLoanable:   true,
+			wantLoanPeriod: 60,
+			wantRenewals:   5,
+			wantMatched:    false,
+		},
+		{
+			name:           "Exact match wins",
+			policies:       policies,
+			patronType:     staff,
+			itemType:       "dvd",
+			wantLoanable:   true,
+			wantLoanPeriod: 7,
+			wantRenewals:   1,
+			wantMatched:    true,
+		},
+		{
+			name:           "Item type beats patron type",
+			policies:       policies,
+			patronType:     staff,
+			itemType:       "reference",
+			wantLoanable:   false,
+			wantLoanPeriod: 60,
+			wantRenewals:   5,
+			wantMatched:    true,
+		},
+		{
+			name:           "Patron type beats catch-all",
+			policies:       policies,
+			patronType:     staff,
+			itemType:       "book",
+			wantLoanable:   true,
+			wantLoanPeriod: 60,
+			wantRenewals:   10,
+			wantMatched:    true,
+		},
+		{
+			name:           "Catch-all",
+			policies:       policies,
+			patronType:     &PatronType{Code: "student", LoanPeriodDays: 21, MaxRenewals: 2},
+			itemType:       "book",
+			wantLoanable:   true,
+			wantLoanPeriod: 14,
+			wantRenewals:   2,
+			wantMatched:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved := ResolvePolicy(tt.policies, tt.patronType, tt.itemType)
+
+			assert.Equal(t, resolved.Loanable, tt.wantLoanable)
+			assert.Equal(t, resolved.LoanPeriodDays, tt.wantLoanPeriod)
+			assert.Equal(t, resolved.MaxRenewals, tt.wantRenewals)
+			assert.Equal(t, resolved.Policy != nil, tt.wantMatched)
+		})
+	}
+}
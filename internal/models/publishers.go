@@ -0,0 +1,197 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+type Publisher struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	Place     string    `json:"place,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+type PublisherModel struct {
+	DB *sql.DB
+}
+
+func (m PublisherModel) Insert(publisher *Publisher) error {
+	query := `
+INSERT INTO publishers (name, place)
+VALUES ($1, $2)
+RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, publisher.Name, publisher.Place).Scan(&publisher.ID, &publisher.CreatedAt, &publisher.Version)
+}
+
+func (m PublisherModel) Get(id uuid.UUID) (*Publisher, error) {
+	query := `
+SELECT id, created_at, name, place, version
+FROM publishers
+WHERE id = $1`
+	var publisher Publisher
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&publisher.ID,
+		&publisher.CreatedAt,
+		&publisher.Name,
+		&publisher.Place,
+		&publisher.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &publisher, nil
+}
+
+func (m PublisherModel) GetAll(name string, filters data.Filters) ([]*Publisher, data.Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), id, created_at, name, place, version
+FROM publishers
+WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+ORDER BY %s %s, id ASC
+LIMIT $2 OFFSET $3`, filters.SortColumn(), filters.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	publishers := []*Publisher{}
+	for rows.Next() {
+		var publisher Publisher
+		err := rows.Scan(
+			&totalRecords,
+			&publisher.ID,
+			&publisher.CreatedAt,
+			&publisher.Name,
+			&publisher.Place,
+			&publisher.Version,
+		)
+		if err != nil {
+			return nil, data.Metadata{}, err
+		}
+		publishers = append(publishers, &publisher)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	metadata := data.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return publishers, metadata, nil
+}
+
+// Update saves changes to a publisher. The books it published show its name and
+// place, so if either changes the books count as updated too, and harvesters pick them
+// up again.
+func (m PublisherModel) Update(publisher *Publisher) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldName, oldPlace string
+	err = tx.QueryRowContext(ctx, `SELECT name, place FROM publishers WHERE id = $1 FOR UPDATE`, publisher.ID).Scan(&oldName, &oldPlace)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query := `
+UPDATE publishers
+SET name = $1, place = $2, version = version + 1
+WHERE id = $3 AND version = $4
+RETURNING version`
+	args := []any{publisher.Name, publisher.Place, publisher.ID, publisher.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&publisher.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if publisher.Name != oldName || publisher.Place != oldPlace {
+		_, err = tx.ExecContext(ctx, `UPDATE books SET updated_at = NOW() WHERE publisher_id = $1`, publisher.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a publisher. Books which were published by it are kept, but no longer
+// have a publisher recorded, so they count as updated.
+func (m PublisherModel) Delete(id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE books SET updated_at = NOW() WHERE publisher_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM publishers WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+func ValidatePublisher(v *validator.Validator, publisher *Publisher) {
+	v.Check(publisher.Name != "", "name", "must be provided")
+	v.Check(len(publisher.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(publisher.Place) <= 200, "place", "must not be more than 200 bytes long")
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Define constants for the kinds of reminder email sent about a loan.
+const (
+	ReminderKindDueSoon = "due_soon"
+	ReminderKindOverdue = "overdue"
+)
+
+// Reminder is an email reminding a borrower about a loan, along with the details
+// needed to write it.
+type Reminder struct {
+	LoanID    uuid.UUID
+	Kind      string
+	DueAt     time.Time
+	Email     string
+	FirstName string
+	Title     string
+}
+
+type ReminderModel struct {
+	DB *sql.DB
+}
+
+// GetPending returns the reminders which are due to be sent as of now: one for each
+// active loan which falls due within dueSoon, and one for each active loan which is
+// overdue. Reminders which have already been sent for the loan's current due date are
+// left out.
+func (m ReminderModel) GetPending(now time.Time, dueSoon time.Duration) ([]*Reminder, error) {
+	query := `
+SELECT pending.id, pending.kind, pending.due_at, users.email, users.firstName, books.title
+FROM (
+	SELECT loans.id, loans.copy_id, loans.user_id, loans.due_at,
+	CASE WHEN loans.due_at < $1 THEN 'overdue' ELSE 'due_soon' END AS kind
+	FROM loans
+	WHERE loans.returned_at IS NULL AND loans.due_at < $2
+) AS pending
+INNER JOIN users ON users.id = pending.user_id
+INNER JOIN book_copies ON book_copies.id = pending.copy_id
+INNER JOIN books ON books.id = book_copies.book_id
+WHERE NOT EXISTS (
+	SELECT 1 FROM reminders
+	WHERE reminders.loan_id = pending.id AND reminders.kind = pending.kind AND reminders.due_at = pending.due_at
+)
+ORDER BY pending.due_at ASC, pending.id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, now, now.Add(dueSoon))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []*Reminder{}
+	for rows.Next() {
+		var reminder Reminder
+		err := rows.Scan(
+			&reminder.LoanID,
+			&reminder.Kind,
+			&reminder.DueAt,
+			&reminder.Email,
+			&reminder.FirstName,
+			&reminder.Title,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, &reminder)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
+
+// Claim records that a reminder is about to be sent. It returns false if the reminder
+// has already been claimed, in which case it must not be sent again.
+func (m ReminderModel) Claim(reminder *Reminder) (bool, error) {
+	query := `
+INSERT INTO reminders (loan_id, kind, due_at)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, reminder.LoanID, reminder.Kind, reminder.DueAt)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// Release removes the claim on a reminder which couldn't be sent, so that sending it
+// is tried again on the next run.
+func (m ReminderModel) Release(reminder *Reminder) error {
+	query := `
+DELETE FROM reminders WHERE loan_id = $1 AND kind = $2 AND due_at = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, reminder.LoanID, reminder.Kind, reminder.DueAt)
+	return err
+}
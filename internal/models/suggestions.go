@@ -0,0 +1,263 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Danik14/library/internal/data"
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	ErrDuplicateSuggestion = errors.New("duplicate suggestion")
+)
+
+// Define constants for the lifecycle of a purchase suggestion. Staff review pending
+// suggestions, accepting or rejecting them, and a suggestion is ordered once a purchase
+// order has been placed for it. Only pending and accepted suggestions are open.
+const (
+	SuggestionStatusPending  = "pending"
+	SuggestionStatusAccepted = "accepted"
+	SuggestionStatusRejected = "rejected"
+	SuggestionStatusOrdered  = "ordered"
+)
+
+var SuggestionStatuses = []string{SuggestionStatusPending, SuggestionStatusAccepted, SuggestionStatusRejected, SuggestionStatusOrdered}
+
+// Suggestion is a patron's request for the library to buy a book it doesn't own. Other
+// patrons vote for the suggestions they'd like to see bought.
+type Suggestion struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	SuggestedBy *uuid.UUID `json:"suggested_by,omitempty"`
+	Title       string     `json:"title"`
+	Author      string     `json:"author,omitempty"`
+	ISBN13      string     `json:"isbn13,omitempty"`
+	Note        string     `json:"note,omitempty"`
+	Status      string     `json:"status"`
+	// Votes is the number of users who voted for the suggestion, including the one who
+	// made it. It is counted on read.
+	Votes      int        `json:"votes"`
+	ReviewedBy *uuid.UUID `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	ReviewNote string     `json:"review_note,omitempty"`
+	Version    int32      `json:"version"`
+}
+
+// IsOpen reports whether the suggestion can still be voted for and ordered.
+func (s *Suggestion) IsOpen() bool {
+	return s.Status == SuggestionStatusPending || s.Status == SuggestionStatusAccepted
+}
+
+type SuggestionModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a suggestion along with the vote of the user who made it. If the book
+// has an open suggestion already, ErrDuplicateSuggestion is returned.
+func (m SuggestionModel) Insert(suggestion *Suggestion) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+INSERT INTO purchase_suggestions (suggested_by, title, author, isbn13, note)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, created_at, status, version`
+	args := []any{suggestion.SuggestedBy, suggestion.Title, suggestion.Author, suggestion.ISBN13, suggestion.Note}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&suggestion.ID, &suggestion.CreatedAt, &suggestion.Status, &suggestion.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "purchase_suggestions_isbn13_idx"`:
+			return ErrDuplicateSuggestion
+		default:
+			return err
+		}
+	}
+
+	if suggestion.SuggestedBy != nil {
+		query = `
+INSERT INTO suggestion_votes (suggestion_id, user_id)
+VALUES ($1, $2)`
+		_, err = tx.ExecContext(ctx, query, suggestion.ID, suggestion.SuggestedBy)
+		if err != nil {
+			return err
+		}
+		suggestion.Votes = 1
+	}
+
+	return tx.Commit()
+}
+
+func (m SuggestionModel) Get(id uuid.UUID) (*Suggestion, error) {
+	query := `
+SELECT id, created_at, suggested_by, title, author, isbn13, note, status,
+(SELECT count(*) FROM suggestion_votes WHERE suggestion_votes.suggestion_id = purchase_suggestions.id),
+reviewed_by, reviewed_at, review_note, version
+FROM purchase_suggestions
+WHERE id = $1`
+
+	var suggestion Suggestion
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&suggestion.ID,
+		&suggestion.CreatedAt,
+		&suggestion.SuggestedBy,
+		&suggestion.Title,
+		&suggestion.Author,
+		&suggestion.ISBN13,
+		&suggestion.Note,
+		&suggestion.Status,
+		&suggestion.Votes,
+		&suggestion.ReviewedBy,
+		&suggestion.ReviewedAt,
+		&suggestion.ReviewNote,
+		&suggestion.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &suggestion, nil
+}
+
+// GetAll returns a page of suggestions, optionally only those with a given status.
+// Sorting by -votes puts the most wanted books first.
+func (m SuggestionModel) GetAll(status string, filters data.Filters) ([]*Suggestion, data.Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), id, created_at, suggested_by, title, author, isbn13, note, status,
+(SELECT count(*) FROM suggestion_votes WHERE suggestion_votes.suggestion_id = purchase_suggestions.id) AS votes,
+reviewed_by, reviewed_at, review_note, version
+FROM purchase_suggestions
+WHERE (status = $1 OR $1 = '')
+ORDER BY %s %s, id ASC
+LIMIT $2 OFFSET $3`, filters.SortColumn(), filters.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	suggestions := []*Suggestion{}
+	for rows.Next() {
+		var suggestion Suggestion
+		err := rows.Scan(
+			&totalRecords,
+			&suggestion.ID,
+			&suggestion.CreatedAt,
+			&suggestion.SuggestedBy,
+			&suggestion.Title,
+			&suggestion.Author,
+			&suggestion.ISBN13,
+			&suggestion.Note,
+			&suggestion.Status,
+			&suggestion.Votes,
+			&suggestion.ReviewedBy,
+			&suggestion.ReviewedAt,
+			&suggestion.ReviewNote,
+			&suggestion.Version,
+		)
+		if err != nil {
+			return nil, data.Metadata{}, err
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	metadata := data.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return suggestions, metadata, nil
+}
+
+// Vote adds a user's vote for a suggestion and updates its vote count. Voting twice
+// counts once.
+func (m SuggestionModel) Vote(suggestion *Suggestion, userID uuid.UUID) error {
+	query := `
+WITH vote AS (
+	INSERT INTO suggestion_votes (suggestion_id, user_id)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING
+	RETURNING 1
+)
+SELECT count(*) + (SELECT count(*) FROM vote) FROM suggestion_votes WHERE suggestion_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, suggestion.ID, userID).Scan(&suggestion.Votes)
+}
+
+// Unvote withdraws a user's vote for a suggestion, if they had voted for it, and
+// updates its vote count.
+func (m SuggestionModel) Unvote(suggestion *Suggestion, userID uuid.UUID) error {
+	query := `
+WITH vote AS (
+	DELETE FROM suggestion_votes
+	WHERE suggestion_id = $1 AND user_id = $2
+	RETURNING 1
+)
+SELECT count(*) - (SELECT count(*) FROM vote) FROM suggestion_votes WHERE suggestion_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, suggestion.ID, userID).Scan(&suggestion.Votes)
+}
+
+// Review records a member of staff accepting or rejecting an open suggestion.
+func (m SuggestionModel) Review(suggestion *Suggestion) error {
+	query := `
+UPDATE purchase_suggestions
+SET status = $1, reviewed_by = $2, reviewed_at = NOW(), review_note = $3, version = version + 1
+WHERE id = $4 AND version = $5 AND status IN ('pending', 'accepted')
+RETURNING reviewed_at, version`
+	args := []any{suggestion.Status, suggestion.ReviewedBy, suggestion.ReviewNote, suggestion.ID, suggestion.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&suggestion.ReviewedAt, &suggestion.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidateSuggestion(v *validator.Validator, suggestion *Suggestion) {
+	v.Check(suggestion.Title != "", "title", "must be provided")
+	v.Check(len(suggestion.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(len(suggestion.Author) <= 500, "author", "must not be more than 500 bytes long")
+	v.Check(len(suggestion.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+
+	suggestion.ISBN13 = ToISBN13(suggestion.ISBN13)
+	v.Check(suggestion.ISBN13 == "" || ValidISBN13(suggestion.ISBN13), "isbn", "must be a valid ISBN-10 or ISBN-13")
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/Danik14/library/internal/assert"
+)
+
+func newTestSuggestion(t *testing.T, m SuggestionModel, user *User) *Suggestion {
+	t.Helper()
+
+	suggestion := &Suggestion{SuggestedBy: &user.ID, Title: "Test suggestion", ISBN13: newTestISBN13()}
+	if err := m.Insert(suggestion); err != nil {
+		t.Fatal(err)
+	}
+	cleanup(t, m.DB, `DELETE FROM purchase_suggestions WHERE id = $1`, suggestion.ID)
+	return suggestion
+}
+
+func TestSuggestionVote(t *testing.T) {
+	db := newTestDB(t)
+	m := SuggestionModel{DB: db}
+
+	author := newTestUser(t, db)
+	voter := newTestUser(t, db)
+	suggestion := newTestSuggestion(t, m, author)
+	assert.Equal(t, suggestion.Votes, 1)
+
+	steps := []struct {
+		name      string
+		user      *User
+		unvote    bool
+		wantVotes int
+	}{
+		{name: "Author votes again", user: author, wantVotes: 1},
+		{name: "Another user votes", user: voter, wantVotes: 2},
+		{name: "Another user votes again", user: voter, wantVotes: 2},
+		{name: "Another user withdraws", user: voter, unvote: true, wantVotes: 1},
+		{name: "Another user withdraws again", user: voter, unvote: true, wantVotes: 1},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			var err error
+			if step.unvote {
+				err = m.Unvote(suggestion, step.user.ID)
+			} else {
+				err = m.Vote(suggestion, step.user.ID)
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, suggestion.Votes, step.wantVotes)
+
+			stored, err := m.Get(suggestion.ID)
+			assert.NilError(t, err)
+			assert.Equal(t, stored.Votes, step.wantVotes)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// newTestDB connects to the migrated database given by TEST_DB_DSN, for tests of
+// behaviour which lives in SQL. The test is skipped if it isn't set. Tests which use it
+// clean up the rows they add, but the database shouldn't hold anything of value.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// cleanup runs a statement which removes a row added by a test, once the test ends.
+func cleanup(t *testing.T, db *sql.DB, query string, args ...any) {
+	t.Cleanup(func() {
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Errorf("cleanup: %v", err)
+		}
+	})
+}
+
+func newTestUser(t *testing.T, db *sql.DB) *User {
+	t.Helper()
+
+	user := &User{
+		FirstName: "Test",
+		LastName:  "User",
+		Email:     fmt.Sprintf("%s@example.com", uuid.NewV4()),
+		DOB:       CivilTime(time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Activated: true,
+	}
+	if err := user.HashedPassword.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := (UserModel{DB: db}).Insert(user); err != nil {
+		t.Fatal(err)
+	}
+	cleanup(t, db, `DELETE FROM users WHERE id = $1`, user.ID)
+	return user
+}
+
+func newTestBranch(t *testing.T, db *sql.DB) *Branch {
+	t.Helper()
+
+	branch := &Branch{Name: "Test branch " + uuid.NewV4().String(), Timezone: "UTC"}
+	if err := (BranchModel{DB: db}).Insert(branch); err != nil {
+		t.Fatal(err)
+	}
+	cleanup(t, db, `DELETE FROM branches WHERE id = $1`, branch.ID)
+	return branch
+}
+
+// newTestISBN13 returns a random ISBN-13 with a valid check digit, so that tests don't
+// clash with books already in the database.
+func newTestISBN13() string {
+	isbn := fmt.Sprintf("979%09d", rand.Intn(1_000_000_000))
+	sum := 0
+	for i, digit := range isbn {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(digit-'0') * weight
+	}
+	return isbn + fmt.Sprint((10-sum%10)%10)
+}
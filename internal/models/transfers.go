@@ -0,0 +1,330 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Danik14/library/internal/data"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Define constants for the lifecycle of a transfer. A transfer is requested, shipped
+// by the sending branch (in transit) and finally received at its destination. Only
+// transfers which haven't been shipped yet can be cancelled.
+const (
+	TransferStatusRequested = "requested"
+	TransferStatusInTransit = "in_transit"
+	TransferStatusReceived  = "received"
+	TransferStatusCancelled = "cancelled"
+)
+
+var TransferStatuses = []string{TransferStatusRequested, TransferStatusInTransit, TransferStatusReceived, TransferStatusCancelled}
+
+// Transfer moves a copy from one branch to another. While a transfer is active the copy
+// has the in_transit status and can't be lent or set aside for another hold. Transfers
+// made to fill a hold at its pickup branch record the hold they are for.
+type Transfer struct {
+	ID           uuid.UUID  `json:"id"`
+	RequestedAt  time.Time  `json:"requested_at"`
+	CopyID       uuid.UUID  `json:"copy_id"`
+	BookID       uuid.UUID  `json:"book_id"`
+	FromBranchID uuid.UUID  `json:"from_branch_id"`
+	ToBranchID   uuid.UUID  `json:"to_branch_id"`
+	HoldID       *uuid.UUID `json:"hold_id,omitempty"`
+	RequestedBy  *uuid.UUID `json:"requested_by,omitempty"`
+	Status       string     `json:"status"`
+	ShippedAt    *time.Time `json:"shipped_at,omitempty"`
+	ReceivedAt   *time.Time `json:"received_at,omitempty"`
+	Version      int32      `json:"version"`
+}
+
+// IsActive reports whether the transfer is still waiting to be shipped or on its way.
+func (t *Transfer) IsActive() bool {
+	return t.Status == TransferStatusRequested || t.Status == TransferStatusInTransit
+}
+
+type TransferModel struct {
+	DB *sql.DB
+}
+
+// Insert requests a transfer of an available copy from the branch it is currently at.
+// The copy is taken out of circulation in the same transaction, and ErrCopyUnavailable
+// is returned if it isn't on the shelf.
+func (m TransferModel) Insert(transfer *Transfer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE book_copies
+SET status = 'in_transit', version = version + 1
+WHERE id = $1 AND status = 'available'
+RETURNING book_id, current_branch_id`
+	err = tx.QueryRowContext(ctx, query, transfer.CopyID).Scan(&transfer.BookID, &transfer.FromBranchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrCopyUnavailable
+		default:
+			return err
+		}
+	}
+
+	query = `
+INSERT INTO transfers (copy_id, from_branch_id, to_branch_id, requested_by)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at, status, version`
+	args := []any{transfer.CopyID, transfer.FromBranchID, transfer.ToBranchID, transfer.RequestedBy}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&transfer.ID, &transfer.RequestedAt, &transfer.Status, &transfer.Version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m TransferModel) Get(id uuid.UUID) (*Transfer, error) {
+	query := `
+SELECT transfers.id, transfers.created_at, transfers.copy_id, book_copies.book_id, transfers.from_branch_id, transfers.to_branch_id,
+transfers.hold_id, transfers.requested_by, transfers.status, transfers.shipped_at, transfers.received_at, transfers.version
+FROM transfers
+INNER JOIN book_copies ON book_copies.id = transfers.copy_id
+WHERE transfers.id = $1`
+
+	return m.get(query, id)
+}
+
+// GetActiveForCopy returns the transfer which a copy is currently part of, so that a
+// scanned barcode can be matched to its transfer.
+func (m TransferModel) GetActiveForCopy(copyID uuid.UUID) (*Transfer, error) {
+	query := `
+SELECT transfers.id, transfers.created_at, transfers.copy_id, book_copies.book_id, transfers.from_branch_id, transfers.to_branch_id,
+transfers.hold_id, transfers.requested_by, transfers.status, transfers.shipped_at, transfers.received_at, transfers.version
+FROM transfers
+INNER JOIN book_copies ON book_copies.id = transfers.copy_id
+WHERE transfers.copy_id = $1 AND transfers.status IN ('requested', 'in_transit')`
+
+	return m.get(query, copyID)
+}
+
+func (m TransferModel) get(query string, arg any) (*Transfer, error) {
+	var transfer Transfer
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, arg).Scan(
+		&transfer.ID,
+		&transfer.RequestedAt,
+		&transfer.CopyID,
+		&transfer.BookID,
+		&transfer.FromBranchID,
+		&transfer.ToBranchID,
+		&transfer.HoldID,
+		&transfer.RequestedBy,
+		&transfer.Status,
+		&transfer.ShippedAt,
+		&transfer.ReceivedAt,
+		&transfer.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &transfer, nil
+}
+
+// GetAll returns a page of transfers, optionally only those leaving or arriving at a
+// branch and only those with a given status. This gives each branch its list of
+// copies to send off and to expect.
+func (m TransferModel) GetAll(branchID uuid.UUID, status string, filters data.Filters) ([]*Transfer, data.Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), transfers.id, transfers.created_at, transfers.copy_id, book_copies.book_id, transfers.from_branch_id, transfers.to_branch_id,
+transfers.hold_id, transfers.requested_by, transfers.status, transfers.shipped_at, transfers.received_at, transfers.version
+FROM transfers
+INNER JOIN book_copies ON book_copies.id = transfers.copy_id
+WHERE ($1::uuid IS NULL OR transfers.from_branch_id = $1 OR transfers.to_branch_id = $1)
+AND (transfers.status = $2 OR $2 = '')
+ORDER BY transfers.%s %s, transfers.id ASC
+LIMIT $3 OFFSET $4`, filters.SortColumn(), filters.SortDirection())
+
+	var branch *uuid.UUID
+	if branchID != uuid.Nil {
+		branch = &branchID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, branch, status, filters.Limit(), filters.Offset())
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	transfers := []*Transfer{}
+	for rows.Next() {
+		var transfer Transfer
+		err := rows.Scan(
+			&totalRecords,
+			&transfer.ID,
+			&transfer.RequestedAt,
+			&transfer.CopyID,
+			&transfer.BookID,
+			&transfer.FromBranchID,
+			&transfer.ToBranchID,
+			&transfer.HoldID,
+			&transfer.RequestedBy,
+			&transfer.Status,
+			&transfer.ShippedAt,
+			&transfer.ReceivedAt,
+			&transfer.Version,
+		)
+		if err != nil {
+			return nil, data.Metadata{}, err
+		}
+		transfers = append(transfers, &transfer)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	metadata := data.CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return transfers, metadata, nil
+}
+
+// Ship records that a requested transfer has left the sending branch.
+func (m TransferModel) Ship(transfer *Transfer) error {
+	query := `
+UPDATE transfers
+SET status = 'in_transit', shipped_at = NOW(), version = version + 1
+WHERE id = $1 AND version = $2 AND status = 'requested'
+RETURNING status, shipped_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, transfer.ID, transfer.Version).Scan(&transfer.Status, &transfer.ShippedAt, &transfer.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Receive records that a transfer has arrived, moving the copy to its new branch. If
+// the transfer was made for a hold which is still in transit, the copy goes on the
+// hold shelf and the hold is ready for pickup until expiresAt. Otherwise the copy goes
+// back into circulation, and the caller should call HoldModel.Allocate() for it.
+func (m TransferModel) Receive(transfer *Transfer, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE transfers
+SET status = 'received', received_at = NOW(), version = version + 1
+WHERE id = $1 AND version = $2 AND status = 'in_transit'
+RETURNING status, received_at, version`
+	err = tx.QueryRowContext(ctx, query, transfer.ID, transfer.Version).Scan(&transfer.Status, &transfer.ReceivedAt, &transfer.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+WITH ready AS (
+	UPDATE holds
+	SET status = 'ready', expires_at = $3, version = version + 1
+	WHERE id = $4 AND copy_id = $1 AND status = 'in_transit'
+	RETURNING id
+)
+UPDATE book_copies
+SET current_branch_id = $2,
+status = CASE WHEN EXISTS (SELECT 1 FROM ready) THEN 'on_hold' ELSE 'available' END,
+version = version + 1
+WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, transfer.CopyID, transfer.ToBranchID, expiresAt, transfer.HoldID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Cancel cancels a transfer which hasn't been shipped yet and puts the copy back on the
+// shelf. A hold which the copy was being sent for goes back to the front of the queue,
+// so the caller should call HoldModel.Allocate() to find it another copy; the cancelled
+// copy won't be chosen for it again.
+func (m TransferModel) Cancel(transfer *Transfer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE transfers
+SET status = 'cancelled', version = version + 1
+WHERE id = $1 AND version = $2 AND status = 'requested'
+RETURNING status, version`
+	err = tx.QueryRowContext(ctx, query, transfer.ID, transfer.Version).Scan(&transfer.Status, &transfer.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+UPDATE book_copies
+SET status = 'available', version = version + 1
+WHERE id = $1 AND status = 'in_transit'`
+	_, err = tx.ExecContext(ctx, query, transfer.CopyID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+UPDATE holds
+SET status = 'waiting', copy_id = NULL, version = version + 1
+WHERE id = $1 AND copy_id = $2 AND status = 'in_transit'`
+	_, err = tx.ExecContext(ctx, query, transfer.HoldID, transfer.CopyID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -35,6 +35,7 @@ type User struct {
 	HashedPassword password  `json:"-"`
 	DOB            CivilTime `json:"dob"` // date of birth
 	Activated      bool      `json:"activated"`
+	PatronType     string    `json:"patronType"` // decides the user's borrowing limits
 	Version        int32     `json:"version"`
 }
 
@@ -78,7 +79,7 @@ func (u UserModel) Insert(user *User) error {
 	// return &User{CreatedAt: time.Now(), FirstName: firstName, LastName: lastName, Email: email, HashedPassword: password, DOB: dob, Version: version}, nil
 	// Define the SQL query for inserting a new record in the movies table and returning
 	// the system-generated data.
-	query := `INSERT INTO users (firstname, lastname, email, hashedpassword, dob, activated) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, createdAt, version;`
+	query := `INSERT INTO users (firstname, lastname, email, hashedpassword, dob, activated) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, createdAt, patron_type, version;`
 	// Create an args slice containing the values for the placeholder parameters from
 	// the movie struct. Declaring this slice immediately next to our SQL query helps to
 	// make it nice and clear *what values are being used where* in the query.
@@ -94,7 +95,7 @@ func (u UserModel) Insert(user *User) error {
 	defer cancel()
 
 	// Use QueryRowContext() and pass the context as the first argument.
-	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.PatronType, &user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -108,7 +109,7 @@ func (u UserModel) Insert(user *User) error {
 
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-	SELECT id, createdAt, firstName, lastName, email, hashedPassword, dob, version, activated FROM users
+	SELECT id, createdAt, firstName, lastName, email, hashedPassword, dob, version, activated, patron_type FROM users
 	WHERE email = $1`
 	var user User
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -123,6 +124,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.DOB,
 		&user.Version,
 		&user.Activated,
+		&user.PatronType,
 	)
 	if err != nil {
 		switch {
@@ -137,7 +139,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 
 func (u UserModel) GetAll(firstName string, lastName string, email string, filters data.Filters) ([]*User, data.Metadata, error) {
 	// Construct the SQL query to retrieve all movie records.
-	query := fmt.Sprintf(`SELECT count(*) OVER(), id, createdAt, firstName, lastName, email, hashedPassword, dob, version, activated FROM users
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, createdAt, firstName, lastName, email, hashedPassword, dob, version, activated, patron_type FROM users
 	WHERE (to_tsvector('simple', firstName) @@ plainto_tsquery('simple', $1) OR $1 = '')
 	AND (to_tsvector('simple', lastName) @@ plainto_tsquery('simple', $2) OR $2 = '')
 	AND (to_tsvector('simple', email) @@ plainto_tsquery('simple', $3) OR $3 = '')
@@ -182,6 +184,7 @@ func (u UserModel) GetAll(firstName string, lastName string, email string, filte
 			&user.DOB,
 			&user.Version,
 			&user.Activated,
+			&user.PatronType,
 		)
 		if err != nil {
 			return nil, data.Metadata{}, err
@@ -208,7 +211,7 @@ func (u UserModel) Get(id uuid.UUID) (*User, error) {
 	// 	return nil, ErrRecordNotFound
 	// }
 	// Define the SQL query for retrieving the movie data.
-	query := `SELECT id, createdAt, firstName, lastName, email, hashedPassword, dob, version, activated FROM users WHERE id = $1`
+	query := `SELECT id, createdAt, firstName, lastName, email, hashedPassword, dob, version, activated, patron_type FROM users WHERE id = $1`
 
 	// Declare a Movie struct to hold the data returned by the query.
 	var user User // Execute the query using the QueryRow() method, passing in the provided id value
@@ -232,6 +235,7 @@ func (u UserModel) Get(id uuid.UUID) (*User, error) {
 		&user.DOB,
 		&user.Version,
 		&user.Activated,
+		&user.PatronType,
 	)
 	// Handle any errors. If there was no matching movie found, Scan() will return
 	// a sql.ErrNoRows error. We check for this and return our custom ErrRecordNotFound
@@ -253,8 +257,8 @@ func (u UserModel) Update(user *User) error {
 	// number.
 	query := `
 	UPDATE users
-	SET firstName = $1, lastName = $2, email = $3, hashedPassword = $4, dob = $5, version = version + 1, activated=$6
-	WHERE id = $7 AND version = $8
+	SET firstName = $1, lastName = $2, email = $3, hashedPassword = $4, dob = $5, version = version + 1, activated=$6, patron_type = $7
+	WHERE id = $8 AND version = $9
 	RETURNING version`
 	// Create an args slice containing the values for the placeholder parameters.
 	args := []any{
@@ -264,6 +268,7 @@ func (u UserModel) Update(user *User) error {
 		user.HashedPassword.hash,
 		pq.FormatTimestamp(time.Time(user.DOB)),
 		user.Activated,
+		user.PatronType,
 		user.ID,
 		user.Version,
 	}
@@ -379,7 +384,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	// Set up the SQL query.
 	//createdAt, firstName, lastName, email, hashedPassword, dob, version, activated
 	query := `
-SELECT users.id, users.createdAt, users.firstName, users.lastName, users.email, users.hashedPassword, users.dob, users.version, users.activated
+SELECT users.id, users.createdAt, users.firstName, users.lastName, users.email, users.hashedPassword, users.dob, users.version, users.activated, users.patron_type
 FROM users
 INNER JOIN tokens
 ON users.id = tokens.user_id
@@ -406,6 +411,7 @@ AND tokens.expiry > $3`
 		&user.DOB,
 		&user.Version,
 		&user.Activated,
+		&user.PatronType,
 	)
 	if err != nil {
 		switch {
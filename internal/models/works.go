@@ -0,0 +1,137 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Danik14/library/internal/validator"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Work is the abstract creation which every edition of a book (translations, reprints,
+// hardcover and paperback, ...) is a version of.
+type Work struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Title     string    `json:"title"`
+	Version   int32     `json:"version"`
+}
+
+// Edition is a short summary of one of the books belonging to a work.
+type Edition struct {
+	ID              uuid.UUID  `json:"id"`
+	Title           string     `json:"title"`
+	Edition         string     `json:"edition,omitempty"`
+	Publisher       string     `json:"publisher,omitempty"`
+	PublishedOn     *CivilTime `json:"published_on,omitempty"`
+	Format          string     `json:"format,omitempty"`
+	AvailableCopies int        `json:"available_copies"`
+}
+
+type WorkModel struct {
+	DB *sql.DB
+}
+
+func (m WorkModel) Get(id uuid.UUID) (*Work, error) {
+	query := `
+SELECT id, created_at, title, version
+FROM works
+WHERE id = $1`
+	var work Work
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&work.ID, &work.CreatedAt, &work.Title, &work.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &work, nil
+}
+
+func (m WorkModel) Update(work *Work) error {
+	query := `
+UPDATE works
+SET title = $1, version = version + 1
+WHERE id = $2 AND version = $3
+RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, work.Title, work.ID, work.Version).Scan(&work.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetEditions returns every edition of a work, oldest publication first.
+func (m WorkModel) GetEditions(workID uuid.UUID) ([]*Edition, error) {
+	query := `
+SELECT id, title, edition, COALESCE((SELECT name FROM publishers WHERE publishers.id = books.publisher_id), ''),
+published_on, format,
+(SELECT count(*) FROM book_copies WHERE book_copies.book_id = books.id AND book_copies.status = 'available')
+FROM books
+WHERE work_id = $1
+ORDER BY published_on ASC NULLS LAST, year ASC, id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	editions := []*Edition{}
+	for rows.Next() {
+		var edition Edition
+		err := rows.Scan(
+			&edition.ID,
+			&edition.Title,
+			&edition.Edition,
+			&edition.Publisher,
+			&edition.PublishedOn,
+			&edition.Format,
+			&edition.AvailableCopies,
+		)
+		if err != nil {
+			return nil, err
+		}
+		editions = append(editions, &edition)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return editions, nil
+}
+
+// deleteWorkIfEmpty deletes a work once none of its editions are left, as part of the
+// transaction which moved or deleted its last book.
+func deleteWorkIfEmpty(ctx context.Context, tx *sql.Tx, workID uuid.UUID) error {
+	query := `
+DELETE FROM works
+WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM books WHERE books.work_id = works.id)`
+
+	_, err := tx.ExecContext(ctx, query, workID)
+	return err
+}
+
+func ValidateWork(v *validator.Validator, work *Work) {
+	v.Check(work.Title != "", "title", "must be provided")
+	v.Check(len(work.Title) <= 500, "title", "must not be more than 500 bytes long")
+}
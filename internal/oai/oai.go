@@ -0,0 +1,290 @@
+// Package oai implements the Open Archives Initiative Protocol for Metadata Harvesting
+// (OAI-PMH) 2.0, through which aggregators harvest the catalog as Dublin Core records.
+// It parses and checks requests and describes the responses; fetching the books is
+// left to the caller.
+package oai
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Danik14/library/internal/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Define constants for the verbs, which name the requests a repository answers.
+const (
+	VerbIdentify            = "Identify"
+	VerbListMetadataFormats = "ListMetadataFormats"
+	VerbListSets            = "ListSets"
+	VerbListIdentifiers     = "ListIdentifiers"
+	VerbListRecords         = "ListRecords"
+	VerbGetRecord           = "GetRecord"
+)
+
+// Define constants for the error codes of the protocol.
+const (
+	CodeBadArgument             = "badArgument"
+	CodeBadResumptionToken      = "badResumptionToken"
+	CodeBadVerb                 = "badVerb"
+	CodeCannotDisseminateFormat = "cannotDisseminateFormat"
+	CodeIDDoesNotExist          = "idDoesNotExist"
+	CodeNoRecordsMatch          = "noRecordsMatch"
+	CodeNoMetadataFormats       = "noMetadataFormats"
+	CodeNoSetHierarchy          = "noSetHierarchy"
+)
+
+// Error is an error reported to the harvester. Errors are part of an ordinary
+// response rather than an HTTP error status.
+type Error struct {
+	Code    string `xml:"code,attr"`
+	Message string `xml:",chardata"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func newError(code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// arguments lists the arguments each verb takes. With exclusive set the verb can
+// instead be given a resumption token and nothing else.
+var arguments = map[string]struct {
+	required  []string
+	optional  []string
+	exclusive bool
+}{
+	VerbIdentify:            {},
+	VerbListMetadataFormats: {optional: []string{"identifier"}},
+	VerbListSets:            {exclusive: true},
+	VerbListIdentifiers:     {required: []string{"metadataPrefix"}, optional: []string{"from", "until", "set"}, exclusive: true},
+	VerbListRecords:         {required: []string{"metadataPrefix"}, optional: []string{"from", "until", "set"}, exclusive: true},
+	VerbGetRecord:           {required: []string{"identifier", "metadataPrefix"}},
+}
+
+// Request is a request from a harvester. It is echoed back in the response, along
+// with the base URL of the repository.
+type Request struct {
+	Verb            string `xml:"verb,attr,omitempty"`
+	Identifier      string `xml:"identifier,attr,omitempty"`
+	MetadataPrefix  string `xml:"metadataPrefix,attr,omitempty"`
+	From            string `xml:"from,attr,omitempty"`
+	Until           string `xml:"until,attr,omitempty"`
+	Set             string `xml:"set,attr,omitempty"`
+	ResumptionToken string `xml:"resumptionToken,attr,omitempty"`
+	BaseURL         string `xml:",chardata"`
+}
+
+// ParseRequest reads a request from the query string or form values, checking that the
+// verb is known and that it has been given the arguments it takes, each only once. For
+// a badVerb or badArgument error the returned request holds only the base URL, as the
+// protocol requires.
+func ParseRequest(baseURL string, values url.Values) (*Request, *Error) {
+	req := &Request{BaseURL: baseURL}
+
+	verbs := values["verb"]
+	if len(verbs) != 1 {
+		return req, newError(CodeBadVerb, "exactly one verb must be given")
+	}
+	args, ok := arguments[verbs[0]]
+	if !ok {
+		return req, newError(CodeBadVerb, "%q is not a verb", verbs[0])
+	}
+
+	allowed := map[string]bool{"verb": true}
+	for _, name := range append(args.required, args.optional...) {
+		allowed[name] = true
+	}
+	if args.exclusive {
+		allowed["resumptionToken"] = true
+	}
+	for name, value := range values {
+		switch {
+		case !allowed[name]:
+			return req, newError(CodeBadArgument, "%s does not take the %s argument", verbs[0], name)
+		case len(value) > 1:
+			return req, newError(CodeBadArgument, "the %s argument must not be repeated", name)
+		}
+	}
+
+	if values.Has("resumptionToken") {
+		if len(values) > 2 {
+			return req, newError(CodeBadArgument, "resumptionToken must be the only argument besides verb")
+		}
+	} else {
+		for _, name := range args.required {
+			if values.Get(name) == "" {
+				return req, newError(CodeBadArgument, "the %s argument is required", name)
+			}
+		}
+	}
+
+	parsed := &Request{
+		Verb:            verbs[0],
+		Identifier:      values.Get("identifier"),
+		MetadataPrefix:  values.Get("metadataPrefix"),
+		From:            values.Get("from"),
+		Until:           values.Get("until"),
+		Set:             values.Get("set"),
+		ResumptionToken: values.Get("resumptionToken"),
+		BaseURL:         baseURL,
+	}
+	return parsed, nil
+}
+
+// Selection is what ListIdentifiers and ListRecords harvest: the records in a metadata
+// format which were updated between From and Until, either of which can be zero, and
+// which are in Set if one is given. When a harvest is resumed, After and AfterID mark
+// the last record of the previous response.
+type Selection struct {
+	MetadataPrefix string    `json:"prefix"`
+	From           time.Time `json:"from"`
+	Until          time.Time `json:"until"`
+	Set            string    `json:"set,omitempty"`
+	After          time.Time `json:"after"`
+	AfterID        uuid.UUID `json:"after_id"`
+	Resumed        bool      `json:"-"`
+}
+
+// Selection reads the selection of a ListIdentifiers or ListRecords request, either
+// from its arguments or from its resumption token.
+func (r *Request) Selection() (*Selection, *Error) {
+	if r.ResumptionToken != "" {
+		js, err := base64.RawURLEncoding.DecodeString(r.ResumptionToken)
+		if err != nil {
+			return nil, newError(CodeBadResumptionToken, "the resumption token is invalid")
+		}
+		var s Selection
+		if err := json.Unmarshal(js, &s); err != nil || s.MetadataPrefix == "" {
+			return nil, newError(CodeBadResumptionToken, "the resumption token is invalid")
+		}
+		s.Resumed = true
+		return &s, nil
+	}
+
+	s := &Selection{MetadataPrefix: r.MetadataPrefix, Set: r.Set}
+
+	var fromDay, untilDay bool
+	var err error
+	if r.From != "" {
+		s.From, fromDay, err = parseDatestamp(r.From)
+		if err != nil {
+			return nil, newError(CodeBadArgument, "from must be a date or a UTC time in seconds")
+		}
+	}
+	if r.Until != "" {
+		s.Until, untilDay, err = parseDatestamp(r.Until)
+		if err != nil {
+			return nil, newError(CodeBadArgument, "until must be a date or a UTC time in seconds")
+		}
+		// A date means the whole of that day.
+		if untilDay {
+			s.Until = s.Until.Add(24*time.Hour - time.Second)
+		}
+	}
+	if r.From != "" && r.Until != "" {
+		if fromDay != untilDay {
+			return nil, newError(CodeBadArgument, "from and until must have the same granularity")
+		}
+		if s.From.After(s.Until) {
+			return nil, newError(CodeBadArgument, "from must not be later than until")
+		}
+	}
+
+	return s, nil
+}
+
+// ResumptionToken returns the token which resumes the harvest after the given record.
+func (s *Selection) ResumptionToken(after time.Time, afterID uuid.UUID) string {
+	next := *s
+	next.After, next.AfterID = after, afterID
+	js, _ := json.Marshal(next)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// parseDatestamp parses a date, or a time to the second in UTC, and reports whether it
+// was a date.
+func parseDatestamp(s string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse("2006-01-02T15:04:05Z", s)
+	return t, false, err
+}
+
+// Datestamp formats a time at the granularity the repository supports.
+func Datestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// Identifier returns the OAI identifier of a book, following the oai-identifier
+// scheme: "oai:" followed by the repository identifier and the book's ID.
+func Identifier(repository string, id uuid.UUID) string {
+	return "oai:" + repository + ":" + id.String()
+}
+
+// ParseIdentifier returns the ID of the book with an OAI identifier, and reports
+// whether the identifier belongs to the repository.
+func ParseIdentifier(repository, identifier string) (uuid.UUID, bool) {
+	prefix := "oai:" + repository + ":"
+	if !strings.HasPrefix(identifier, prefix) {
+		return uuid.Nil, false
+	}
+	id, err := uuid.FromString(strings.TrimPrefix(identifier, prefix))
+	return id, err == nil
+}
+
+// Sets describes the genres as a set hierarchy. The spec of a sub-genre's set is the
+// spec of its parent followed by a colon and its own name, so that harvesting a set
+// includes its sub-genres, as filtering books by genre does. The returned map gives
+// the spec of each genre by name.
+func Sets(genres []*models.Genre) ([]Set, map[string]string) {
+	byID := map[uuid.UUID]*models.Genre{}
+	for _, genre := range genres {
+		byID[genre.ID] = genre
+	}
+
+	specs := map[string]string{}
+	var spec func(genre *models.Genre, depth int) string
+	spec = func(genre *models.Genre, depth int) string {
+		s := setSpecPart(genre.Name)
+		// The depth guards against a cycle in the hierarchy.
+		if genre.ParentID != nil && depth < len(genres) {
+			if parent, ok := byID[*genre.ParentID]; ok {
+				s = spec(parent, depth+1) + ":" + s
+			}
+		}
+		return s
+	}
+
+	sets := make([]Set, 0, len(genres))
+	for _, genre := range genres {
+		s := spec(genre, 0)
+		specs[genre.Name] = s
+		sets = append(sets, Set{Spec: s, Name: genre.Name})
+	}
+	return sets, specs
+}
+
+// setSpecPart turns a genre name into a part of a set spec, which may only contain
+// unreserved URI characters. Spaces become hyphens and other characters underscores.
+func setSpecPart(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("-_.!~*'()", r):
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,151 @@
+package oai
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Danik14/library/internal/assert"
+	"github.com/Danik14/library/internal/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantCode string
+	}{
+		{name: "Identify", query: "verb=Identify"},
+		{name: "No verb", query: "", wantCode: CodeBadVerb},
+		{name: "Unknown verb", query: "verb=ListBooks", wantCode: CodeBadVerb},
+		{name: "Repeated verb", query: "verb=Identify&verb=ListSets", wantCode: CodeBadVerb},
+		{name: "Unexpected argument", query: "verb=Identify&set=fantasy", wantCode: CodeBadArgument},
+		{name: "Repeated argument", query: "verb=ListRecords&metadataPrefix=oai_dc&set=a&set=b", wantCode: CodeBadArgument},
+		{name: "Missing metadataPrefix", query: "verb=ListRecords&from=2023-01-01", wantCode: CodeBadArgument},
+		{name: "Resumption token", query: "verb=ListRecords&resumptionToken=abc"},
+		{name: "Resumption token with arguments", query: "verb=ListRecords&resumptionToken=abc&metadataPrefix=oai_dc", wantCode: CodeBadArgument},
+		{name: "GetRecord", query: "verb=GetRecord&identifier=oai:library.local:1&metadataPrefix=oai_dc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			assert.NilError(t, err)
+
+			req, oaiErr := ParseRequest("http://localhost/oai", values)
+			assert.Equal(t, req.BaseURL, "http://localhost/oai")
+			if tt.wantCode == "" {
+				if oaiErr != nil {
+					t.Fatalf("got error %v", oaiErr)
+				}
+				return
+			}
+			if oaiErr == nil {
+				t.Fatalf("got no error; want %s", tt.wantCode)
+			}
+			assert.Equal(t, oaiErr.Code, tt.wantCode)
+			assert.Equal(t, req.Verb, "")
+		})
+	}
+}
+
+func TestSelection(t *testing.T) {
+	tests := []struct {
+		name      string
+		from      string
+		until     string
+		wantCode  string
+		wantUntil time.Time
+	}{
+		{name: "Days", from: "2023-01-01", until: "2023-01-31", wantUntil: time.Date(2023, time.January, 31, 23, 59, 59, 0, time.UTC)},
+		{name: "Seconds", from: "2023-01-01T00:00:00Z", until: "2023-01-31T12:00:00Z", wantUntil: time.Date(2023, time.January, 31, 12, 0, 0, 0, time.UTC)},
+		{name: "Mixed granularity", from: "2023-01-01", until: "2023-01-31T12:00:00Z", wantCode: CodeBadArgument},
+		{name: "From after until", from: "2023-02-01", until: "2023-01-31", wantCode: CodeBadArgument},
+		{name: "Bad date", from: "01/02/2023", wantCode: CodeBadArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{Verb: VerbListRecords, MetadataPrefix: "oai_dc", From: tt.from, Until: tt.until}
+			s, oaiErr := req.Selection()
+			if tt.wantCode != "" {
+				if oaiErr == nil {
+					t.Fatalf("got no error; want %s", tt.wantCode)
+				}
+				assert.Equal(t, oaiErr.Code, tt.wantCode)
+				return
+			}
+			if oaiErr != nil {
+				t.Fatalf("got error %v", oaiErr)
+			}
+			assert.Equal(t, s.Until, tt.wantUntil)
+		})
+	}
+}
+
+func TestResumptionToken(t *testing.T) {
+	req := &Request{Verb: VerbListIdentifiers, MetadataPrefix: "oai_dc", From: "2023-01-01", Set: "fiction:fantasy"}
+	s, oaiErr := req.Selection()
+	if oaiErr != nil {
+		t.Fatal(oaiErr)
+	}
+
+	after := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	afterID := uuid.NewV4()
+	resumed, oaiErr := (&Request{Verb: VerbListIdentifiers, ResumptionToken: s.ResumptionToken(after, afterID)}).Selection()
+	if oaiErr != nil {
+		t.Fatal(oaiErr)
+	}
+	assert.Equal(t, resumed.Resumed, true)
+	assert.Equal(t, resumed.MetadataPrefix, "oai_dc")
+	assert.Equal(t, resumed.From.Equal(s.From), true)
+	assert.Equal(t, resumed.Set, "fiction:fantasy")
+	assert.Equal(t, resumed.After.Equal(after), true)
+	assert.Equal(t, resumed.AfterID, afterID)
+
+	_, oaiErr = (&Request{Verb: VerbListIdentifiers, ResumptionToken: "not a token"}).Selection()
+	if oaiErr == nil || oaiErr.Code != CodeBadResumptionToken {
+		t.Fatalf("got %v; want %s", oaiErr, CodeBadResumptionToken)
+	}
+}
+
+func TestSets(t *testing.T) {
+	fiction := &models.Genre{ID: uuid.NewV4(), Name: "fiction"}
+	fantasy := &models.Genre{ID: uuid.NewV4(), Name: "high fantasy", ParentID: &fiction.ID}
+	children := &models.Genre{ID: uuid.NewV4(), Name: "children's & young adult"}
+
+	sets, specs := Sets([]*models.Genre{fiction, fantasy, children})
+	assert.Equal(t, len(sets), 3)
+	assert.Equal(t, specs["fiction"], "fiction")
+	assert.Equal(t, specs["high fantasy"], "fiction:high-fantasy")
+	assert.Equal(t, specs["children's & young adult"], "children's-_-young-adult")
+}
+
+func TestResponseWrite(t *testing.T) {
+	book := &models.Book{
+		ID:     uuid.NewV4(),
+		Title:  "Good Omens",
+		Author: "Terry Pratchett, Neil Gaiman",
+		Year:   1990,
+		ISBN13: "9780575048003",
+	}
+
+	resp := NewResponse(&Request{Verb: VerbGetRecord, BaseURL: "http://localhost/oai"}, time.Now())
+	resp.GetRecord = &GetRecord{Record: &Record{
+		Header:   &Header{Identifier: Identifier("library.local", book.ID), Datestamp: "2023-01-01T00:00:00Z"},
+		Metadata: &Metadata{DC: NewDublinCore(book)},
+	}}
+
+	var buf bytes.Buffer
+	assert.NilError(t, resp.Write(&buf))
+	assert.StringContains(t, buf.String(), `<OAI-PMH xmlns="http://www.openarchives.org/OAI/2.0/"`)
+	assert.StringContains(t, buf.String(), `<oai_dc:dc xmlns:oai_dc="http://www.openarchives.org/OAI/2.0/oai_dc/" xmlns:dc="http://purl.org/dc/elements/1.1/"`)
+	assert.StringContains(t, buf.String(), "<dc:creator>Neil Gaiman</dc:creator>")
+	assert.StringContains(t, buf.String(), "<dc:identifier>urn:isbn:9780575048003</dc:identifier>")
+
+	id, ok := ParseIdentifier("library.local", Identifier("library.local", book.ID))
+	assert.Equal(t, ok, true)
+	assert.Equal(t, id, book.ID)
+}
@@ -0,0 +1,198 @@
+package oai
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Danik14/library/internal/models"
+)
+
+// Response is an OAI-PMH response. It holds either errors or the element named after
+// the verb of the request.
+type Response struct {
+	XMLName             xml.Name             `xml:"http://www.openarchives.org/OAI/2.0/ OAI-PMH"`
+	XmlnsXSI            string               `xml:"xmlns:xsi,attr"`
+	SchemaLocation      string               `xml:"xsi:schemaLocation,attr"`
+	ResponseDate        string               `xml:"responseDate"`
+	Request             *Request             `xml:"request"`
+	Errors              []*Error             `xml:"error"`
+	Identify            *Identify            `xml:"Identify"`
+	ListMetadataFormats *ListMetadataFormats `xml:"ListMetadataFormats"`
+	ListSets            *ListSets            `xml:"ListSets"`
+	GetRecord           *GetRecord           `xml:"GetRecord"`
+	ListIdentifiers     *ListIdentifiers     `xml:"ListIdentifiers"`
+	ListRecords         *ListRecords         `xml:"ListRecords"`
+}
+
+// NewResponse returns an empty response to a request.
+func NewResponse(req *Request, now time.Time) *Response {
+	return &Response{
+		XmlnsXSI:       "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: "http://www.openarchives.org/OAI/2.0/ http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd",
+		ResponseDate:   Datestamp(now),
+		Request:        req,
+	}
+}
+
+// Write writes the response as an XML document.
+func (r *Response) Write(w io.Writer) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(r)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+type Identify struct {
+	RepositoryName    string   `xml:"repositoryName"`
+	BaseURL           string   `xml:"baseURL"`
+	ProtocolVersion   string   `xml:"protocolVersion"`
+	AdminEmail        []string `xml:"adminEmail"`
+	EarliestDatestamp string   `xml:"earliestDatestamp"`
+	DeletedRecord     string   `xml:"deletedRecord"`
+	Granularity       string   `xml:"granularity"`
+}
+
+type MetadataFormat struct {
+	Prefix    string `xml:"metadataPrefix"`
+	Schema    string `xml:"schema"`
+	Namespace string `xml:"metadataNamespace"`
+}
+
+// DublinCoreFormat is unqualified Dublin Core, the one metadata format every
+// repository must support and the only one we offer.
+var DublinCoreFormat = MetadataFormat{
+	Prefix:    "oai_dc",
+	Schema:    "http://www.openarchives.org/OAI/2.0/oai_dc.xsd",
+	Namespace: "http://www.openarchives.org/OAI/2.0/oai_dc/",
+}
+
+type ListMetadataFormats struct {
+	Formats []MetadataFormat `xml:"metadataFormat"`
+}
+
+type Set struct {
+	Spec string `xml:"setSpec"`
+	Name string `xml:"setName"`
+}
+
+type ListSets struct {
+	Sets []Set `xml:"set"`
+}
+
+type Header struct {
+	Identifier string   `xml:"identifier"`
+	Datestamp  string   `xml:"datestamp"`
+	SetSpecs   []string `xml:"setSpec"`
+}
+
+type Record struct {
+	Header   *Header   `xml:"header"`
+	Metadata *Metadata `xml:"metadata"`
+}
+
+type Metadata struct {
+	DC *DublinCore `xml:"oai_dc:dc"`
+}
+
+type GetRecord struct {
+	Record *Record `xml:"record"`
+}
+
+// ResumptionToken is sent with an incomplete list. The last part of a list which was
+// resumed has an empty token, telling the harvester that the list is complete.
+type ResumptionToken struct {
+	Token string `xml:",chardata"`
+}
+
+type ListIdentifiers struct {
+	Headers         []*Header        `xml:"header"`
+	ResumptionToken *ResumptionToken `xml:"resumptionToken"`
+}
+
+type ListRecords struct {
+	Records         []*Record        `xml:"record"`
+	ResumptionToken *ResumptionToken `xml:"resumptionToken"`
+}
+
+// DublinCore is a record in unqualified Dublin Core. The element names are written
+// with their prefix, which is declared on the record itself.
+type DublinCore struct {
+	XMLName        xml.Name `xml:"oai_dc:dc"`
+	XmlnsOAIDC     string   `xml:"xmlns:oai_dc,attr"`
+	XmlnsDC        string   `xml:"xmlns:dc,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	Elements
+}
+
+// DCNamespace is the namespace of the Dublin Core elements.
+const DCNamespace = "http://purl.org/dc/elements/1.1/"
+
+// Elements are the Dublin Core elements describing a book, without the record element
+// around them, so that other protocols can wrap them in their own. The dc prefix must
+// be declared by the enclosing element.
+type Elements struct {
+	Title      []string `xml:"dc:title"`
+	Creator    []string `xml:"dc:creator"`
+	Subject    []string `xml:"dc:subject"`
+	Publisher  []string `xml:"dc:publisher"`
+	Date       []string `xml:"dc:date"`
+	Type       []string `xml:"dc:type"`
+	Format     []string `xml:"dc:format"`
+	Identifier []string `xml:"dc:identifier"`
+}
+
+// NewDublinCore describes a book as an oai_dc record.
+func NewDublinCore(book *models.Book) *DublinCore {
+	return &DublinCore{
+		XmlnsOAIDC:     DublinCoreFormat.Namespace,
+		XmlnsDC:        DCNamespace,
+		SchemaLocation: DublinCoreFormat.Namespace + " " + DublinCoreFormat.Schema,
+		Elements:       NewElements(book),
+	}
+}
+
+// NewElements describes a book in Dublin Core. The creators are taken from the display
+// form of the author, in which names are separated by commas, and the genres become
+// subjects.
+func NewElements(book *models.Book) Elements {
+	dc := Elements{
+		Title:   []string{book.Title},
+		Subject: book.Genres,
+		Type:    []string{"Text"},
+	}
+	if book.Author != "" {
+		dc.Creator = strings.Split(book.Author, ", ")
+	}
+	if book.Publisher != "" {
+		dc.Publisher = []string{book.Publisher}
+	}
+	switch {
+	case book.PublishedOn != nil:
+		dc.Date = []string{time.Time(*book.PublishedOn).Format("2006-01-02")}
+	case book.Year > 0:
+		dc.Date = []string{strconv.Itoa(int(book.Year))}
+	}
+	if book.Pages > 0 {
+		dc.Format = append(dc.Format, strconv.Itoa(int(book.Pages))+" pages")
+	}
+	if book.Format != "" {
+		dc.Format = append(dc.Format, book.Format)
+	}
+	for _, isbn := range []string{book.ISBN13, book.ISBN10} {
+		if isbn != "" {
+			dc.Identifier = append(dc.Identifier, "urn:isbn:"+isbn)
+		}
+	}
+	return dc
+}
@@ -0,0 +1,192 @@
+package opds
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+)
+
+// The prefixed names of the Dublin Core and OpenSearch elements are written as they
+// are, and their namespaces are declared on the feed element.
+type atomFeed struct {
+	XMLName         xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	XmlnsDC         string       `xml:"xmlns:dc,attr"`
+	XmlnsOpenSearch string       `xml:"xmlns:opensearch,attr"`
+	ID              string       `xml:"id"`
+	Title           string       `xml:"title"`
+	Updated         string       `xml:"updated"`
+	Links           []atomLink   `xml:"link"`
+	TotalResults    int          `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage    int          `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex      int          `xml:"opensearch:startIndex,omitempty"`
+	Entries         []*atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomAuthor   `xml:"author"`
+	Identifier string         `xml:"dc:identifier,omitempty"`
+	Issued     string         `xml:"dc:issued,omitempty"`
+	Publisher  string         `xml:"dc:publisher,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Content    *atomContent   `xml:"content"`
+	Links      []atomLink     `xml:"link"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Title  string `xml:"title,attr,omitempty"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
+// WriteAtom writes the feed as an OPDS 1.2 Atom document. Navigation entries and
+// publications without an update time are given the time the feed was updated, as
+// Atom requires every entry to have one.
+func WriteAtom(w io.Writer, feed *Feed) error {
+	x := atomFeed{
+		XmlnsDC:         "http://purl.org/dc/terms/",
+		XmlnsOpenSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		ID:              feed.ID,
+		Title:           feed.Title,
+		Updated:         atomTime(feed.Updated),
+		Links:           atomLinks(feed.Links),
+		Entries:         []*atomEntry{},
+	}
+	if feed.Page != nil {
+		x.TotalResults = feed.Page.TotalItems
+		x.ItemsPerPage = feed.Page.ItemsPerPage
+		x.StartIndex = (feed.Page.CurrentPage-1)*feed.Page.ItemsPerPage + 1
+	}
+
+	for _, entry := range feed.Entries {
+		e := &atomEntry{
+			ID:      entry.ID,
+			Title:   entry.Title,
+			Updated: x.Updated,
+			Links:   atomLinks([]Link{entry.Link}),
+		}
+		if entry.Summary != "" {
+			e.Content = &atomContent{Type: "text", Text: entry.Summary}
+		}
+		x.Entries = append(x.Entries, e)
+	}
+
+	for _, publication := range feed.Publications {
+		e := &atomEntry{
+			ID:         publication.ID,
+			Title:      publication.Title,
+			Updated:    x.Updated,
+			Identifier: isbnURN(publication.ISBN),
+			Publisher:  publication.Publisher,
+			Links:      atomLinks(publication.Links),
+		}
+		if !publication.Updated.IsZero() {
+			e.Updated = atomTime(publication.Updated)
+		}
+		for _, name := range publication.Authors {
+			e.Authors = append(e.Authors, atomAuthor{Name: name})
+		}
+		if publication.Year > 0 {
+			e.Issued = strconv.Itoa(publication.Year)
+		}
+		for _, subject := range publication.Subjects {
+			e.Categories = append(e.Categories, atomCategory{Term: subject, Label: subject})
+		}
+		x.Entries = append(x.Entries, e)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(x)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func atomLinks(links []Link) []atomLink {
+	x := make([]atomLink, 0, len(links))
+	for _, link := range links {
+		l := atomLink{Rel: link.Rel, Href: link.Href, Type: link.Type, Title: link.Title}
+		if link.Length > 0 {
+			l.Length = strconv.FormatInt(link.Length, 10)
+		}
+		x = append(x, l)
+	}
+	return x
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func isbnURN(isbn string) string {
+	if isbn == "" {
+		return ""
+	}
+	return "urn:isbn:" + isbn
+}
+
+type openSearchDescription struct {
+	XMLName        xml.Name      `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName      string        `xml:"ShortName"`
+	Description    string        `xml:"Description"`
+	InputEncoding  string        `xml:"InputEncoding"`
+	OutputEncoding string        `xml:"OutputEncoding"`
+	URL            openSearchURL `xml:"Url"`
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// WriteOpenSearch writes an OpenSearch description, which tells OPDS 1.2 clients how
+// to search the catalog. The href of the results link is a template holding
+// {searchTerms} where the search terms go.
+func WriteOpenSearch(w io.Writer, shortName, description string, results Link) error {
+	x := openSearchDescription{
+		ShortName:      shortName,
+		Description:    description,
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+		URL:            openSearchURL{Type: results.Type, Template: results.Href},
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(x)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
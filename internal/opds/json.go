@@ -0,0 +1,116 @@
+package opds
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+type jsonFeed struct {
+	Metadata     jsonFeedMetadata   `json:"metadata"`
+	Links        []jsonLink         `json:"links"`
+	Navigation   []jsonLink         `json:"navigation,omitempty"`
+	Publications []*jsonPublication `json:"publications,omitempty"`
+}
+
+type jsonFeedMetadata struct {
+	Title         string `json:"title"`
+	Modified      string `json:"modified,omitempty"`
+	NumberOfItems int    `json:"numberOfItems,omitempty"`
+	ItemsPerPage  int    `json:"itemsPerPage,omitempty"`
+	CurrentPage   int    `json:"currentPage,omitempty"`
+}
+
+type jsonPublication struct {
+	Metadata jsonPublicationMetadata `json:"metadata"`
+	Links    []jsonLink              `json:"links"`
+}
+
+type jsonPublicationMetadata struct {
+	Type       string   `json:"@type"`
+	Identifier string   `json:"identifier"`
+	Title      string   `json:"title"`
+	Author     []string `json:"author,omitempty"`
+	Publisher  string   `json:"publisher,omitempty"`
+	Published  string   `json:"published,omitempty"`
+	Modified   string   `json:"modified,omitempty"`
+	Subject    []string `json:"subject,omitempty"`
+}
+
+type jsonLink struct {
+	Rel       string `json:"rel,omitempty"`
+	Href      string `json:"href"`
+	Type      string `json:"type,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Templated bool   `json:"templated,omitempty"`
+	Length    int64  `json:"length,omitempty"`
+}
+
+// WriteJSON writes the feed as an OPDS 2.0 document. Navigation entries become the
+// links of the navigation collection.
+func WriteJSON(w io.Writer, feed *Feed) error {
+	x := jsonFeed{
+		Metadata: jsonFeedMetadata{
+			Title:    feed.Title,
+			Modified: jsonTime(feed.Updated),
+		},
+		Links: jsonLinks(feed.Links),
+	}
+	if feed.Page != nil {
+		x.Metadata.NumberOfItems = feed.Page.TotalItems
+		x.Metadata.ItemsPerPage = feed.Page.ItemsPerPage
+		x.Metadata.CurrentPage = feed.Page.CurrentPage
+	}
+
+	for _, entry := range feed.Entries {
+		link := jsonLinks([]Link{entry.Link})[0]
+		link.Title = entry.Title
+		x.Navigation = append(x.Navigation, link)
+	}
+
+	for _, publication := range feed.Publications {
+		p := &jsonPublication{
+			Metadata: jsonPublicationMetadata{
+				Type:       "http://schema.org/Book",
+				Identifier: publication.ID,
+				Title:      publication.Title,
+				Author:     publication.Authors,
+				Publisher:  publication.Publisher,
+				Modified:   jsonTime(publication.Updated),
+				Subject:    publication.Subjects,
+			},
+			Links: jsonLinks(publication.Links),
+		}
+		if publication.Year > 0 {
+			p.Metadata.Published = strconv.Itoa(publication.Year)
+		}
+		x.Publications = append(x.Publications, p)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(x)
+}
+
+func jsonLinks(links []Link) []jsonLink {
+	x := make([]jsonLink, 0, len(links))
+	for _, link := range links {
+		x = append(x, jsonLink{
+			Rel:       link.Rel,
+			Href:      link.Href,
+			Type:      link.Type,
+			Title:     link.Title,
+			Templated: link.Templated,
+			Length:    link.Length,
+		})
+	}
+	return x
+}
+
+func jsonTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,127 @@
+// Package opds describes the catalog as OPDS feeds, which e-reader apps use to browse
+// and download books. A Feed is built once and can be written either as an Atom
+// document for OPDS 1.2 or as JSON for OPDS 2.0.
+package opds
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Danik14/library/internal/models"
+)
+
+// Define constants for the media types of OPDS documents.
+const (
+	MediaTypeNavigation  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	MediaTypeAcquisition = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	MediaTypeJSON        = "application/opds+json"
+	MediaTypeOpenSearch  = "application/opensearchdescription+xml"
+)
+
+// Define constants for the link relations which OPDS gives a meaning to.
+const (
+	RelSelf        = "self"
+	RelStart       = "start"
+	RelUp          = "up"
+	RelSearch      = "search"
+	RelSubsection  = "subsection"
+	RelAlternate   = "alternate"
+	RelFirst       = "first"
+	RelPrevious    = "previous"
+	RelNext        = "next"
+	RelLast        = "last"
+	RelAcquisition = "http://opds-spec.org/acquisition"
+)
+
+// Link is a typed link from a feed or publication to another resource. Templated links
+// hold a URI template, e.g. for searching, rather than a URL. Length is the size of
+// the linked file in bytes, if it is known.
+type Link struct {
+	Rel       string
+	Href      string
+	Type      string
+	Title     string
+	Templated bool
+	Length    int64
+}
+
+// Entry is an entry in a navigation feed, leading to another feed.
+type Entry struct {
+	ID      string
+	Title   string
+	Summary string
+	Link    Link
+}
+
+// Publication describes a book in an acquisition feed. Its acquisition links are
+// where the book can be downloaded or read online.
+type Publication struct {
+	ID        string
+	Title     string
+	Authors   []string
+	Publisher string
+	Year      int
+	ISBN      string
+	Subjects  []string
+	Updated   time.Time
+	Links     []Link
+}
+
+// Page describes which part of a longer list of publications or entries a feed holds.
+type Page struct {
+	TotalItems   int
+	ItemsPerPage int
+	CurrentPage  int
+}
+
+// Feed is a page of a catalog. A navigation feed lists Entries leading to other feeds,
+// and an acquisition feed lists Publications.
+type Feed struct {
+	ID           string
+	Title        string
+	Updated      time.Time
+	Links        []Link
+	Entries      []*Entry
+	Publications []*Publication
+	Page         *Page
+}
+
+// IsAcquisition reports whether the feed lists publications rather than leading to
+// other feeds.
+func (f *Feed) IsAcquisition() bool {
+	return f.Publications != nil
+}
+
+// FromBook describes a book as a publication, with an acquisition link for each of its
+// digital resources. The authors are taken from the display form of the author, in
+// which names are separated by commas.
+func FromBook(book *models.Book, resources []*models.DigitalResource) *Publication {
+	publication := &Publication{
+		ID:        "urn:uuid:" + book.ID.String(),
+		Title:     book.Title,
+		Publisher: book.Publisher,
+		Year:      int(book.Year),
+		Subjects:  book.Genres,
+		Updated:   book.CreatedAt,
+	}
+	if book.Author != "" {
+		publication.Authors = strings.Split(book.Author, ", ")
+	}
+	switch {
+	case book.ISBN13 != "":
+		publication.ISBN = book.ISBN13
+	case book.ISBN10 != "":
+		publication.ISBN = book.ISBN10
+	}
+
+	for _, resource := range resources {
+		publication.Links = append(publication.Links, Link{
+			Rel:    RelAcquisition,
+			Href:   resource.URL,
+			Type:   resource.MediaType,
+			Length: resource.SizeBytes,
+		})
+	}
+
+	return publication
+}
@@ -0,0 +1,102 @@
+package opds
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/Danik14/library/internal/assert"
+	"github.com/Danik14/library/internal/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+func testFeed() *Feed {
+	book := &models.Book{
+		ID:        uuid.FromStringOrNil("7b2d4c1e-0000-4000-8000-000000000001"),
+		CreatedAt: time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC),
+		Title:     "Good Omens",
+		Author:    "Terry Pratchett, Neil Gaiman",
+		Year:      1990,
+		Genres:    []string{"Fantasy"},
+		ISBN13:    "9780575048003",
+	}
+	resources := []*models.DigitalResource{
+		{URL: "https://example.com/good-omens.epub", MediaType: "application/epub+zip", SizeBytes: 1024},
+	}
+
+	return &Feed{
+		ID:           "urn:library:opds:books",
+		Title:        "All books",
+		Updated:      time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC),
+		Links:        []Link{{Rel: RelSelf, Href: "/opds/books?page=2", Type: MediaTypeAcquisition}},
+		Publications: []*Publication{FromBook(book, resources)},
+		Page:         &Page{TotalItems: 21, ItemsPerPage: 20, CurrentPage: 2},
+	}
+}
+
+func TestWriteAtom(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NilError(t, WriteAtom(&buf, testFeed()))
+
+	var feed struct {
+		XMLName    xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Updated    string   `xml:"updated"`
+		StartIndex int      `xml:"http://a9.com/-/spec/opensearch/1.1/ startIndex"`
+		Entries    []struct {
+			ID         string   `xml:"id"`
+			Authors    []string `xml:"author>name"`
+			Identifier string   `xml:"http://purl.org/dc/terms/ identifier"`
+			Links      []struct {
+				Rel    string `xml:"rel,attr"`
+				Href   string `xml:"href,attr"`
+				Length int64  `xml:"length,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	assert.NilError(t, xml.Unmarshal(buf.Bytes(), &feed))
+
+	assert.Equal(t, feed.Updated, "2024-01-02T03:04:05Z")
+	assert.Equal(t, feed.StartIndex, 21)
+	assert.Equal(t, len(feed.Entries), 1)
+
+	entry := feed.Entries[0]
+	assert.Equal(t, entry.ID, "urn:uuid:7b2d4c1e-0000-4000-8000-000000000001")
+	assert.Equal(t, len(entry.Authors), 2)
+	assert.Equal(t, entry.Authors[1], "Neil Gaiman")
+	assert.Equal(t, entry.Identifier, "urn:isbn:9780575048003")
+	assert.Equal(t, len(entry.Links), 1)
+	assert.Equal(t, entry.Links[0].Rel, RelAcquisition)
+	assert.Equal(t, entry.Links[0].Length, int64(1024))
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NilError(t, WriteJSON(&buf, testFeed()))
+
+	var feed struct {
+		Metadata struct {
+			NumberOfItems int `json:"numberOfItems"`
+			CurrentPage   int `json:"currentPage"`
+		} `json:"metadata"`
+		Publications []struct {
+			Metadata struct {
+				Title     string `json:"title"`
+				Published string `json:"published"`
+			} `json:"metadata"`
+			Links []struct {
+				Rel  string `json:"rel"`
+				Type string `json:"type"`
+			} `json:"links"`
+		} `json:"publications"`
+	}
+	assert.NilError(t, json.Unmarshal(buf.Bytes(), &feed))
+
+	assert.Equal(t, feed.Metadata.NumberOfItems, 21)
+	assert.Equal(t, feed.Metadata.CurrentPage, 2)
+	assert.Equal(t, len(feed.Publications), 1)
+	assert.Equal(t, feed.Publications[0].Metadata.Title, "Good Omens")
+	assert.Equal(t, feed.Publications[0].Metadata.Published, "1990")
+	assert.Equal(t, feed.Publications[0].Links[0].Type, "application/epub+zip")
+}
@@ -0,0 +1,207 @@
+// Package sru implements Search/Retrieve via URL (SRU) 1.2, through which other library
+// systems search the catalog with CQL queries and retrieve the books as Dublin Core or
+// MARCXML records. It parses and checks requests and describes the responses; running
+// the query is left to the caller.
+package sru
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Danik14/library/internal/cql"
+)
+
+// Version is the version of the protocol we answer in.
+const Version = "1.2"
+
+// Define constants for the operations.
+const (
+	OperationExplain        = "explain"
+	OperationSearchRetrieve = "searchRetrieve"
+)
+
+// Define constants for the diagnostics we report, numbered as in the SRU diagnostics
+// list.
+const (
+	DiagGeneralSystemError         = 1
+	DiagUnsupportedOperation       = 4
+	DiagUnsupportedVersion         = 5
+	DiagUnsupportedParameterValue  = 6
+	DiagMandatoryParameterMissing  = 7
+	DiagUnsupportedParameter       = 8
+	DiagQuerySyntaxError           = 10
+	DiagUnsupportedIndex           = 16
+	DiagUnsupportedRelation        = 19
+	DiagMaskingNotSupported        = 28
+	DiagUnsupportedBooleanOperator = 37
+	DiagFirstRecordOutOfRange      = 61
+	DiagUnknownSchemaForRetrieval  = 66
+	DiagUnsupportedRecordPacking   = 71
+)
+
+// DefaultMaximumRecords is how many records are sent if the client doesn't say, and
+// MaxMaximumRecords the most sent at once.
+const (
+	DefaultMaximumRecords = 10
+	MaxMaximumRecords     = 100
+)
+
+// Diagnostic is an error or warning reported to the client. Like OAI-PMH errors,
+// diagnostics are part of an ordinary response rather than an HTTP error status.
+type Diagnostic struct {
+	URI     string `xml:"uri"`
+	Details string `xml:"details,omitempty"`
+	Message string `xml:"message,omitempty"`
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s", d.URI, d.Message)
+}
+
+// NewDiagnostic returns the diagnostic with a number from the SRU diagnostics list.
+// Details name what caused it, such as the parameter or index.
+func NewDiagnostic(code int, details, message string) *Diagnostic {
+	return &Diagnostic{URI: "info:srw/diagnostic/1/" + strconv.Itoa(code), Details: details, Message: message}
+}
+
+// QueryDiagnostic returns the diagnostic for an error from parsing or translating a
+// CQL query, or nil if the error isn't the query's fault.
+func QueryDiagnostic(err error) *Diagnostic {
+	switch {
+	case errors.Is(err, cql.ErrSyntax):
+		return NewDiagnostic(DiagQuerySyntaxError, "", err.Error())
+	case errors.Is(err, cql.ErrUnsupportedIndex):
+		return NewDiagnostic(DiagUnsupportedIndex, "", err.Error())
+	case errors.Is(err, cql.ErrUnsupportedRelation):
+		return NewDiagnostic(DiagUnsupportedRelation, "", err.Error())
+	case errors.Is(err, cql.ErrUnsupportedBoolean):
+		return NewDiagnostic(DiagUnsupportedBooleanOperator, "", err.Error())
+	case errors.Is(err, cql.ErrMasking):
+		return NewDiagnostic(DiagMaskingNotSupported, "", err.Error())
+	}
+	return nil
+}
+
+// Schema is a record schema records can be retrieved in. It can be asked for by its
+// short name or its identifier.
+type Schema struct {
+	Name       string
+	Identifier string
+	Title      string
+}
+
+var (
+	DublinCoreSchema = Schema{Name: "dc", Identifier: "info:srw/schema/1/dc-v1.1", Title: "Dublin Core"}
+	MARCXMLSchema    = Schema{Name: "marcxml", Identifier: "info:srw/schema/1/marcxml-v1.1", Title: "MARC21 in XML"}
+)
+
+// Schemas lists the record schemas we offer. The first is the default.
+var Schemas = []Schema{DublinCoreSchema, MARCXMLSchema}
+
+// parameters lists the parameters each operation takes. Parameters starting with "x-"
+// are extensions, which may be ignored, and are always allowed.
+var parameters = map[string]map[string]bool{
+	OperationExplain: {"operation": true, "version": true, "recordPacking": true, "stylesheet": true},
+	OperationSearchRetrieve: {"operation": true, "version": true, "query": true, "startRecord": true, "maximumRecords": true,
+		"recordPacking": true, "recordSchema": true, "stylesheet": true},
+}
+
+// Request is a request from a client, with the defaults filled in.
+type Request struct {
+	Operation      string
+	Version        string
+	Query          string
+	StartRecord    int
+	MaximumRecords int
+	RecordSchema   Schema
+	RecordPacking  string
+}
+
+// ParseRequest reads a request from the query string, checking that the operation and
+// version are supported and the parameters are valid. An empty query string is taken
+// as an explain request, so that the base URL describes the server. The returned
+// request always has an operation, for the response to be named after.
+func ParseRequest(values url.Values) (*Request, *Diagnostic) {
+	req := &Request{
+		Operation:      values.Get("operation"),
+		Version:        Version,
+		StartRecord:    1,
+		MaximumRecords: DefaultMaximumRecords,
+		RecordSchema:   Schemas[0],
+		RecordPacking:  "xml",
+	}
+
+	switch {
+	case req.Operation == "" && len(values) == 0:
+		req.Operation = OperationExplain
+		return req, nil
+	case req.Operation == "":
+		req.Operation = OperationSearchRetrieve
+		return req, NewDiagnostic(DiagMandatoryParameterMissing, "operation", "the operation parameter is required")
+	}
+	allowed, ok := parameters[req.Operation]
+	if !ok {
+		op := req.Operation
+		req.Operation = OperationSearchRetrieve
+		return req, NewDiagnostic(DiagUnsupportedOperation, op, "only explain and searchRetrieve are supported")
+	}
+
+	for name, value := range values {
+		switch {
+		case strings.HasPrefix(name, "x-"):
+		case !allowed[name]:
+			return req, NewDiagnostic(DiagUnsupportedParameter, name, "the parameter is not supported")
+		case len(value) > 1:
+			return req, NewDiagnostic(DiagUnsupportedParameterValue, name, "the parameter must not be repeated")
+		}
+	}
+
+	if version := values.Get("version"); version != "" && version != "1.1" && version != "1.2" {
+		return req, NewDiagnostic(DiagUnsupportedVersion, Version, "only versions 1.1 and 1.2 are supported")
+	}
+	if packing := values.Get("recordPacking"); packing != "" && packing != "xml" {
+		return req, NewDiagnostic(DiagUnsupportedRecordPacking, packing, "records can only be packed as xml")
+	}
+	if req.Operation == OperationExplain {
+		return req, nil
+	}
+
+	req.Query = values.Get("query")
+	if req.Query == "" {
+		return req, NewDiagnostic(DiagMandatoryParameterMissing, "query", "the query parameter is required")
+	}
+	if s := values.Get("startRecord"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return req, NewDiagnostic(DiagUnsupportedParameterValue, "startRecord", "startRecord must be a positive integer")
+		}
+		req.StartRecord = n
+	}
+	if s := values.Get("maximumRecords"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return req, NewDiagnostic(DiagUnsupportedParameterValue, "maximumRecords", "maximumRecords must be a non-negative integer")
+		}
+		// Asking for more records than we send at once isn't an error: the client is
+		// told where the next page starts.
+		if n > MaxMaximumRecords {
+			n = MaxMaximumRecords
+		}
+		req.MaximumRecords = n
+	}
+	if s := values.Get("recordSchema"); s != "" {
+		found := false
+		for _, schema := range Schemas {
+			if s == schema.Name || s == schema.Identifier {
+				req.RecordSchema, found = schema, true
+			}
+		}
+		if !found {
+			return req, NewDiagnostic(DiagUnknownSchemaForRetrieval, s, "records can be retrieved as dc or marcxml")
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,106 @@
+package sru
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/Danik14/library/internal/assert"
+	"github.com/Danik14/library/internal/cql"
+	"github.com/Danik14/library/internal/models"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		wantOperation string
+		wantCode      int
+	}{
+		{name: "Empty", query: "", wantOperation: OperationExplain},
+		{name: "Explain", query: "operation=explain&version=1.2", wantOperation: OperationExplain},
+		{name: "Search", query: "operation=searchRetrieve&version=1.2&query=hobbit&maximumRecords=500&recordSchema=marcxml", wantOperation: OperationSearchRetrieve},
+		{name: "Extension", query: "operation=searchRetrieve&query=hobbit&x-debug=1", wantOperation: OperationSearchRetrieve},
+		{name: "No operation", query: "query=hobbit", wantOperation: OperationSearchRetrieve, wantCode: DiagMandatoryParameterMissing},
+		{name: "Unknown operation", query: "operation=scan", wantOperation: OperationSearchRetrieve, wantCode: DiagUnsupportedOperation},
+		{name: "Unknown version", query: "operation=explain&version=2.0", wantOperation: OperationExplain, wantCode: DiagUnsupportedVersion},
+		{name: "No query", query: "operation=searchRetrieve", wantOperation: OperationSearchRetrieve, wantCode: DiagMandatoryParameterMissing},
+		{name: "Sort keys", query: "operation=searchRetrieve&query=hobbit&sortKeys=title", wantOperation: OperationSearchRetrieve, wantCode: DiagUnsupportedParameter},
+		{name: "Bad start", query: "operation=searchRetrieve&query=hobbit&startRecord=0", wantOperation: OperationSearchRetrieve, wantCode: DiagUnsupportedParameterValue},
+		{name: "Unknown schema", query: "operation=searchRetrieve&query=hobbit&recordSchema=mods", wantOperation: OperationSearchRetrieve, wantCode: DiagUnknownSchemaForRetrieval},
+		{name: "String packing", query: "operation=searchRetrieve&query=hobbit&recordPacking=string", wantOperation: OperationSearchRetrieve, wantCode: DiagUnsupportedRecordPacking},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			assert.NilError(t, err)
+
+			req, diag := ParseRequest(values)
+			assert.Equal(t, req.Operation, tt.wantOperation)
+			if tt.wantCode == 0 {
+				if diag != nil {
+					t.Fatalf("got diagnostic %v", diag)
+				}
+				return
+			}
+			if diag == nil {
+				t.Fatalf("got no diagnostic; want %d", tt.wantCode)
+			}
+			assert.Equal(t, diag.URI, fmt.Sprintf("info:srw/diagnostic/1/%d", tt.wantCode))
+		})
+	}
+}
+
+func TestParseRequestDefaults(t *testing.T) {
+	req, diag := ParseRequest(url.Values{"operation": {"searchRetrieve"}, "query": {"hobbit"}, "maximumRecords": {"500"}})
+	if diag != nil {
+		t.Fatal(diag)
+	}
+	assert.Equal(t, req.StartRecord, 1)
+	assert.Equal(t, req.MaximumRecords, MaxMaximumRecords)
+	assert.Equal(t, req.RecordSchema, DublinCoreSchema)
+}
+
+func TestQueryDiagnostic(t *testing.T) {
+	_, err := cql.Parse("title = (")
+	assert.Equal(t, QueryDiagnostic(err).URI, "info:srw/diagnostic/1/10")
+	assert.Equal(t, QueryDiagnostic(fmt.Errorf("%w: dc.date", cql.ErrUnsupportedIndex)).URI, "info:srw/diagnostic/1/16")
+	assert.Equal(t, QueryDiagnostic(cql.ErrMasking).URI, "info:srw/diagnostic/1/28")
+	assert.Equal(t, QueryDiagnostic(fmt.Errorf("connection refused")) == nil, true)
+}
+
+func TestWrite(t *testing.T) {
+	book := &models.Book{
+		ID:     uuid.NewV4(),
+		Title:  "Good Omens",
+		Author: "Terry Pratchett, Neil Gaiman",
+		Year:   1990,
+		ISBN13: "9780575048003",
+	}
+
+	resp := &SearchRetrieveResponse{
+		Version:         Version,
+		NumberOfRecords: 2,
+		Records: &Records{Records: []*Record{
+			NewRecord(book, DublinCoreSchema, 1),
+			NewRecord(book, MARCXMLSchema, 2),
+		}},
+		Diagnostics: NewDiagnostics(NewDiagnostic(DiagUnsupportedParameter, "x-debug", "ignored")),
+	}
+
+	var buf bytes.Buffer
+	assert.NilError(t, Write(&buf, resp))
+	assert.StringContains(t, buf.String(), `<searchRetrieveResponse xmlns="http://www.loc.gov/zing/srw/">`)
+	assert.StringContains(t, buf.String(), `<srw_dc:dc xmlns:srw_dc="info:srw/schema/1/dc-schema" xmlns:dc="http://purl.org/dc/elements/1.1/">`)
+	assert.StringContains(t, buf.String(), "<dc:creator>Neil Gaiman</dc:creator>")
+	assert.StringContains(t, buf.String(), `<record xmlns="http://www.loc.gov/MARC21/slim">`)
+	assert.StringContains(t, buf.String(), `<diagnostic xmlns="http://www.loc.gov/zing/srw/diagnostic/">`)
+
+	buf.Reset()
+	assert.NilError(t, Write(&buf, NewExplainResponse(NewExplain("localhost", 4000, "sru", "Library", ""))))
+	assert.StringContains(t, buf.String(), `<explain xmlns="http://explain.z3950.org/dtd/2.0/">`)
+	assert.StringContains(t, buf.String(), `<name set="bath">isbn</name>`)
+}
@@ -0,0 +1,214 @@
+package sru
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+
+	"github.com/Danik14/library/internal/marc"
+	"github.com/Danik14/library/internal/models"
+	"github.com/Danik14/library/internal/oai"
+)
+
+// SearchRetrieveResponse is the response to a searchRetrieve request, and to requests
+// which couldn't be understood at all.
+type SearchRetrieveResponse struct {
+	XMLName            xml.Name     `xml:"http://www.loc.gov/zing/srw/ searchRetrieveResponse"`
+	Version            string       `xml:"version"`
+	NumberOfRecords    int          `xml:"numberOfRecords"`
+	Records            *Records     `xml:"records"`
+	NextRecordPosition int          `xml:"nextRecordPosition,omitempty"`
+	Diagnostics        *Diagnostics `xml:"diagnostics"`
+}
+
+// ExplainResponse describes the server, in a single ZeeRex record.
+type ExplainResponse struct {
+	XMLName     xml.Name     `xml:"http://www.loc.gov/zing/srw/ explainResponse"`
+	Version     string       `xml:"version"`
+	Record      *Record      `xml:"record"`
+	Diagnostics *Diagnostics `xml:"diagnostics"`
+}
+
+type Records struct {
+	Records []*Record `xml:"record"`
+}
+
+// Diagnostics wraps the diagnostics of a response, which are in their own namespace.
+type Diagnostics struct {
+	Diagnostics []*Diagnostic `xml:"http://www.loc.gov/zing/srw/diagnostic/ diagnostic"`
+}
+
+// NewDiagnostics returns the diagnostics element of a response, or nil if there aren't
+// any.
+func NewDiagnostics(diagnostics ...*Diagnostic) *Diagnostics {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+	return &Diagnostics{Diagnostics: diagnostics}
+}
+
+type Record struct {
+	Schema   string     `xml:"recordSchema"`
+	Packing  string     `xml:"recordPacking"`
+	Data     RecordData `xml:"recordData"`
+	Position int        `xml:"recordPosition,omitempty"`
+}
+
+// RecordData holds a record in one of the schemas.
+type RecordData struct {
+	DC      *DublinCore  `xml:"srw_dc:dc"`
+	MARC    *marc.Record `xml:"record"`
+	Explain *Explain     `xml:"explain"`
+}
+
+// DublinCore is a record in the SRU Dublin Core schema, which holds the same elements as
+// an oai_dc record under a different root element.
+type DublinCore struct {
+	XMLName    xml.Name `xml:"srw_dc:dc"`
+	XmlnsSRWDC string   `xml:"xmlns:srw_dc,attr"`
+	XmlnsDC    string   `xml:"xmlns:dc,attr"`
+	oai.Elements
+}
+
+// NewRecord describes a book as a record in a schema, at a position in the result set.
+func NewRecord(book *models.Book, schema Schema, position int) *Record {
+	record := &Record{Schema: schema.Identifier, Packing: "xml", Position: position}
+	switch schema.Name {
+	case MARCXMLSchema.Name:
+		record.Data.MARC = marc.FromBook(book)
+	default:
+		record.Data.DC = &DublinCore{
+			XmlnsSRWDC: "info:srw/schema/1/dc-schema",
+			XmlnsDC:    oai.DCNamespace,
+			Elements:   oai.NewElements(book),
+		}
+	}
+	return record
+}
+
+// Write writes a response as an XML document.
+func Write(w io.Writer, response any) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(response)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// NewExplainResponse returns an explain response holding the description of the server.
+func NewExplainResponse(explain *Explain, diagnostics ...*Diagnostic) *ExplainResponse {
+	return &ExplainResponse{
+		Version: Version,
+		Record: &Record{
+			Schema:  "http://explain.z3950.org/dtd/2.0/",
+			Packing: "xml",
+			Data:    RecordData{Explain: explain},
+		},
+		Diagnostics: NewDiagnostics(diagnostics...),
+	}
+}
+
+// Explain is a ZeeRex description of the server: where it is, what it holds, the indexes
+// queries can use and the schemas records can be retrieved in.
+type Explain struct {
+	XMLName      xml.Name     `xml:"http://explain.z3950.org/dtd/2.0/ explain"`
+	ServerInfo   ServerInfo   `xml:"serverInfo"`
+	DatabaseInfo DatabaseInfo `xml:"databaseInfo"`
+	IndexInfo    IndexInfo    `xml:"indexInfo"`
+	SchemaInfo   []SchemaInfo `xml:"schemaInfo>schema"`
+	ConfigInfo   ConfigInfo   `xml:"configInfo"`
+}
+
+type ServerInfo struct {
+	Protocol string `xml:"protocol,attr"`
+	Version  string `xml:"version,attr"`
+	Host     string `xml:"host"`
+	Port     int    `xml:"port"`
+	Database string `xml:"database"`
+}
+
+type DatabaseInfo struct {
+	Title   string `xml:"title"`
+	Contact string `xml:"contact,omitempty"`
+}
+
+type IndexInfo struct {
+	Sets    []IndexSet `xml:"set"`
+	Indexes []Index    `xml:"index"`
+}
+
+type IndexSet struct {
+	Name       string `xml:"name,attr"`
+	Identifier string `xml:"identifier,attr"`
+}
+
+type Index struct {
+	Title string    `xml:"title"`
+	Names []NameMap `xml:"map>name"`
+}
+
+type NameMap struct {
+	Set  string `xml:"set,attr"`
+	Name string `xml:",chardata"`
+}
+
+type SchemaInfo struct {
+	Identifier string `xml:"identifier,attr"`
+	Name       string `xml:"name,attr"`
+	Sort       bool   `xml:"sort,attr"`
+	Retrieve   bool   `xml:"retrieve,attr"`
+	Title      string `xml:"title"`
+}
+
+type ConfigInfo struct {
+	Defaults []Setting `xml:"default"`
+	Settings []Setting `xml:"setting"`
+}
+
+type Setting struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// NewExplain describes the server at a host and port, with the database path of its
+// base URL.
+func NewExplain(host string, port int, database, title, contact string) *Explain {
+	explain := &Explain{
+		ServerInfo:   ServerInfo{Protocol: "SRU", Version: Version, Host: host, Port: port, Database: database},
+		DatabaseInfo: DatabaseInfo{Title: title, Contact: contact},
+		IndexInfo: IndexInfo{
+			Sets: []IndexSet{
+				{Name: "cql", Identifier: "info:srw/cql-context-set/1/cql-v1.2"},
+				{Name: "dc", Identifier: "info:srw/cql-context-set/1/dc-v1.1"},
+				{Name: "bath", Identifier: "http://zing.z3950.org/cql/bath/2.0/"},
+			},
+			Indexes: []Index{
+				{Title: "Title or author", Names: []NameMap{{Set: "cql", Name: "serverChoice"}}},
+				{Title: "Title", Names: []NameMap{{Set: "dc", Name: "title"}, {Set: "bath", Name: "title"}}},
+				{Title: "Author", Names: []NameMap{{Set: "dc", Name: "creator"}, {Set: "bath", Name: "author"}}},
+				{Title: "Genre", Names: []NameMap{{Set: "dc", Name: "subject"}, {Set: "bath", Name: "subject"}}},
+				{Title: "ISBN", Names: []NameMap{{Set: "bath", Name: "isbn"}}},
+			},
+		},
+		ConfigInfo: ConfigInfo{
+			Defaults: []Setting{{Type: "numberOfRecords", Value: strconv.Itoa(DefaultMaximumRecords)}},
+			Settings: []Setting{{Type: "maximumRecords", Value: strconv.Itoa(MaxMaximumRecords)}},
+		},
+	}
+	for _, schema := range Schemas {
+		explain.SchemaInfo = append(explain.SchemaInfo, SchemaInfo{
+			Identifier: schema.Identifier,
+			Name:       schema.Name,
+			Retrieve:   true,
+			Title:      schema.Title,
+		})
+	}
+	return explain
+}
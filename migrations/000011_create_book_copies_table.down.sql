@@ -0,0 +1 @@
+DROP TABLE IF EXISTS book_copies;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS book_copies (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+book_id UUID NOT NULL REFERENCES books ON DELETE CASCADE,
+barcode text NOT NULL UNIQUE,
+accession_number text NOT NULL UNIQUE,
+condition text NOT NULL DEFAULT 'good',
+status text NOT NULL DEFAULT 'available',
+version integer NOT NULL DEFAULT 1
+);
+ALTER TABLE book_copies ADD CONSTRAINT book_copies_status_check CHECK (status IN ('available', 'on_loan', 'lost', 'withdrawn'));
+CREATE INDEX IF NOT EXISTS book_copies_book_id_idx ON book_copies (book_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS loans;
+DELETE FROM permissions WHERE code IN ('loans:read', 'loans:write');
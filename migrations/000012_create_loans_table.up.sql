@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS loans (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+copy_id UUID NOT NULL REFERENCES book_copies ON DELETE CASCADE,
+user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+due_at timestamp(0) with time zone NOT NULL,
+returned_at timestamp(0) with time zone,
+version integer NOT NULL DEFAULT 1
+);
+-- A copy can only ever be on one active (not yet returned) loan.
+CREATE UNIQUE INDEX IF NOT EXISTS loans_active_copy_idx ON loans (copy_id) WHERE returned_at IS NULL;
+CREATE INDEX IF NOT EXISTS loans_user_id_idx ON loans (user_id);
+INSERT INTO permissions (code)
+VALUES
+('loans:read'),
+('loans:write');
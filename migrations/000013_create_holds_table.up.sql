@@ -0,0 +1,18 @@
+ALTER TABLE book_copies DROP CONSTRAINT IF EXISTS book_copies_status_check;
+ALTER TABLE book_copies ADD CONSTRAINT book_copies_status_check CHECK (status IN ('available', 'on_loan', 'on_hold', 'lost', 'withdrawn'));
+-- created_at keeps full precision here because it decides each patron's place in the
+-- queue.
+CREATE TABLE IF NOT EXISTS holds (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+book_id UUID NOT NULL REFERENCES books ON DELETE CASCADE,
+user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+copy_id UUID REFERENCES book_copies ON DELETE SET NULL,
+status text NOT NULL DEFAULT 'waiting',
+expires_at timestamp(0) with time zone,
+version integer NOT NULL DEFAULT 1
+);
+ALTER TABLE holds ADD CONSTRAINT holds_status_check CHECK (status IN ('waiting', 'ready', 'fulfilled', 'cancelled', 'expired'));
+-- A patron can only have one active hold on a title at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS holds_active_user_book_idx ON holds (book_id, user_id) WHERE status IN ('waiting', 'ready');
+CREATE INDEX IF NOT EXISTS holds_queue_idx ON holds (book_id, created_at) WHERE status = 'waiting';
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS fines;
+DROP TABLE IF EXISTS fine_rules;
+ALTER TABLE book_copies DROP COLUMN IF EXISTS item_type;
+DELETE FROM permissions WHERE code IN ('fines:read', 'fines:write');
@@ -0,0 +1,41 @@
+ALTER TABLE book_copies ADD COLUMN IF NOT EXISTS item_type text NOT NULL DEFAULT 'book';
+-- All amounts are stored in minor currency units (e.g. cents).
+CREATE TABLE IF NOT EXISTS fine_rules (
+item_type text PRIMARY KEY,
+daily_rate bigint NOT NULL,
+grace_days integer NOT NULL DEFAULT 0,
+max_amount bigint NOT NULL,
+version integer NOT NULL DEFAULT 1
+);
+ALTER TABLE fine_rules ADD CONSTRAINT fine_rules_amounts_check CHECK (daily_rate >= 0 AND grace_days >= 0 AND max_amount >= 0);
+-- The default rule applies to every item type which doesn't have a rule of its own.
+INSERT INTO fine_rules (item_type, daily_rate, grace_days, max_amount)
+VALUES ('default', 10, 0, 500);
+CREATE TABLE IF NOT EXISTS fines (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+loan_id UUID REFERENCES loans ON DELETE SET NULL,
+kind text NOT NULL,
+amount bigint NOT NULL,
+-- Charges record the due date they were worked out from, so that renewing a loan
+-- doesn't cancel out the days it was already late.
+due_at timestamp(0) with time zone,
+-- Charges record how much of them has been waived, so that the same charge can't be
+-- waived more than once. Payments and waivers have no status.
+status text,
+waived bigint NOT NULL DEFAULT 0,
+note text NOT NULL DEFAULT '',
+created_by UUID REFERENCES users ON DELETE SET NULL,
+version integer NOT NULL DEFAULT 1
+);
+ALTER TABLE fines ADD CONSTRAINT fines_kind_check CHECK (kind IN ('charge', 'payment', 'waiver'));
+ALTER TABLE fines ADD CONSTRAINT fines_amount_check CHECK (amount > 0);
+ALTER TABLE fines ADD CONSTRAINT fines_status_check CHECK ((kind = 'charge' AND status IN ('outstanding', 'waived')) OR (kind <> 'charge' AND status IS NULL));
+ALTER TABLE fines ADD CONSTRAINT fines_waived_check CHECK (waived >= 0 AND waived <= amount);
+CREATE INDEX IF NOT EXISTS fines_user_id_idx ON fines (user_id);
+CREATE INDEX IF NOT EXISTS fines_loan_id_idx ON fines (loan_id);
+INSERT INTO permissions (code)
+VALUES
+('fines:read'),
+('fines:write');
@@ -0,0 +1 @@
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS renewals integer NOT NULL DEFAULT 0;
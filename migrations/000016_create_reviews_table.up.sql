@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS reviews (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+book_id UUID NOT NULL REFERENCES books ON DELETE CASCADE,
+user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+rating integer NOT NULL,
+body text NOT NULL DEFAULT '',
+version integer NOT NULL DEFAULT 1,
+-- Each patron gets a single review per book, which they can edit.
+UNIQUE (book_id, user_id)
+);
+ALTER TABLE reviews ADD CONSTRAINT reviews_rating_check CHECK (rating BETWEEN 1 AND 5);
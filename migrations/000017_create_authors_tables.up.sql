@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS authors (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+name text NOT NULL,
+-- Pen names and other spellings the author is known by.
+alternate_names text[] NOT NULL DEFAULT '{}',
+bio text NOT NULL DEFAULT '',
+version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS authors_name_idx ON authors USING GIN (to_tsvector('simple', name));
+CREATE TABLE IF NOT EXISTS book_authors (
+book_id UUID NOT NULL REFERENCES books ON DELETE CASCADE,
+author_id UUID NOT NULL REFERENCES authors ON DELETE RESTRICT,
+role text NOT NULL DEFAULT 'author',
+position integer NOT NULL DEFAULT 0,
+PRIMARY KEY (book_id, author_id, role)
+);
+ALTER TABLE book_authors ADD CONSTRAINT book_authors_role_check CHECK (role IN ('author', 'editor', 'translator', 'illustrator'));
+CREATE INDEX IF NOT EXISTS book_authors_author_id_idx ON book_authors (author_id);
+-- Split the existing free-text author column into one author record per distinct
+-- name, so "A; B & C" becomes three authors credited on the book in that order. Commas
+-- and "and" are left alone, as they also appear within names like "Tolkien, J. R. R.".
+INSERT INTO authors (name)
+SELECT DISTINCT trim(name)
+FROM books, regexp_split_to_table(books.author, '\s*(;|&)\s*') AS name
+WHERE trim(name) <> '';
+INSERT INTO book_authors (book_id, author_id, role, position)
+SELECT books.id, authors.id, 'author', split.position - 1
+FROM books
+CROSS JOIN LATERAL regexp_split_to_table(books.author, '\s*(;|&)\s*') WITH ORDINALITY AS split(name, position)
+INNER JOIN authors ON authors.name = trim(split.name)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS isbn10 text;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS isbn13 text;
+-- Every ISBN-10 has an ISBN-13 equivalent which is always stored alongside it, so
+-- enforcing uniqueness on the ISBN-13 covers both forms.
+CREATE UNIQUE INDEX IF NOT EXISTS books_isbn13_idx ON books (isbn13);
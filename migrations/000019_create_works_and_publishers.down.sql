@@ -0,0 +1,9 @@
+ALTER TABLE holds DROP COLUMN IF EXISTS any_edition;
+ALTER TABLE books DROP CONSTRAINT IF EXISTS books_format_check;
+ALTER TABLE books DROP COLUMN IF EXISTS format;
+ALTER TABLE books DROP COLUMN IF EXISTS published_on;
+ALTER TABLE books DROP COLUMN IF EXISTS edition;
+ALTER TABLE books DROP COLUMN IF EXISTS publisher_id;
+ALTER TABLE books DROP COLUMN IF EXISTS work_id;
+DROP TABLE IF EXISTS works;
+DROP TABLE IF EXISTS publishers;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS publishers (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+name text NOT NULL,
+place text NOT NULL DEFAULT '',
+version integer NOT NULL DEFAULT 1
+);
+CREATE TABLE IF NOT EXISTS works (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+title text NOT NULL,
+version integer NOT NULL DEFAULT 1
+);
+-- Every existing book becomes the only edition of a work of its own. The work reuses
+-- the book's ID so that the backfill is a simple update.
+INSERT INTO works (id, title) SELECT id, title FROM books;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS work_id UUID REFERENCES works ON DELETE RESTRICT;
+UPDATE books SET work_id = id;
+ALTER TABLE books ALTER COLUMN work_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS books_work_id_idx ON books (work_id);
+ALTER TABLE books ADD COLUMN IF NOT EXISTS publisher_id UUID REFERENCES publishers ON DELETE SET NULL;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS edition text NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN IF NOT EXISTS published_on date;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS format text NOT NULL DEFAULT '';
+ALTER TABLE books ADD CONSTRAINT books_format_check CHECK (format IN ('', 'hardcover', 'paperback', 'ebook', 'audiobook', 'other'));
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS any_edition boolean NOT NULL DEFAULT false;
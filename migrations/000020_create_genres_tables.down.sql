@@ -0,0 +1,3 @@
+DROP FUNCTION IF EXISTS genre_with_descendants(text);
+DROP TABLE IF EXISTS genre_synonyms;
+DROP TABLE IF EXISTS genres;
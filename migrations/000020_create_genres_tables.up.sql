@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS genres (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+name text NOT NULL UNIQUE,
+parent_id UUID REFERENCES genres ON DELETE RESTRICT,
+version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS genres_parent_id_idx ON genres (parent_id);
+CREATE TABLE IF NOT EXISTS genre_synonyms (
+synonym text PRIMARY KEY,
+genre_id UUID NOT NULL REFERENCES genres ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS genre_synonyms_genre_id_idx ON genre_synonyms (genre_id);
+-- genre_with_descendants returns the canonical name of the wanted genre (which may be
+-- given as a synonym) along with the names of all of its sub-genres. Unknown genres
+-- only match themselves.
+CREATE OR REPLACE FUNCTION genre_with_descendants(wanted text) RETURNS text[] AS $$
+WITH RECURSIVE tree AS (
+	SELECT id, name FROM genres
+	WHERE name = wanted OR id IN (SELECT genre_id FROM genre_synonyms WHERE synonym = wanted)
+	UNION
+	SELECT genres.id, genres.name FROM genres INNER JOIN tree ON genres.parent_id = tree.id
+)
+SELECT COALESCE(array_agg(name), ARRAY[wanted]) FROM tree
+$$ LANGUAGE sql STABLE;
+-- Normalize the existing free-form genres (lower case, with runs of spaces, hyphens
+-- and underscores collapsed to a single space), turn each distinct value into a genre
+-- and rewrite the arrays without duplicates. Spelling variants such as "sci fi" and
+-- "science fiction" can then be merged through the API.
+UPDATE books SET genres = ARRAY(
+	SELECT normalized FROM (
+		SELECT trim(regexp_replace(lower(genre), '[\s_-]+', ' ', 'g')) AS normalized, min(position) AS position
+		FROM unnest(books.genres) WITH ORDINALITY AS t(genre, position)
+		GROUP BY 1
+	) AS deduplicated
+	WHERE normalized <> ''
+	ORDER BY position
+);
+INSERT INTO genres (name)
+SELECT DISTINCT unnest(genres) FROM books
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+ALTER TABLE book_copies DROP COLUMN IF EXISTS current_branch_id;
+ALTER TABLE book_copies DROP COLUMN IF EXISTS home_branch_id;
+DROP TABLE IF EXISTS branches;
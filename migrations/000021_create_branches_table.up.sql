@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS branches (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+name text NOT NULL UNIQUE,
+address text NOT NULL DEFAULT '',
+opening_hours jsonb NOT NULL DEFAULT '{}',
+timezone text NOT NULL DEFAULT 'UTC',
+version integer NOT NULL DEFAULT 1
+);
+-- Every existing copy is assumed to be shelved at, and belong to, the main library.
+INSERT INTO branches (name) VALUES ('Main Library');
+ALTER TABLE book_copies ADD COLUMN IF NOT EXISTS home_branch_id UUID REFERENCES branches ON DELETE RESTRICT;
+ALTER TABLE book_copies ADD COLUMN IF NOT EXISTS current_branch_id UUID REFERENCES branches ON DELETE RESTRICT;
+UPDATE book_copies SET home_branch_id = (SELECT id FROM branches WHERE name = 'Main Library'),
+current_branch_id = (SELECT id FROM branches WHERE name = 'Main Library');
+ALTER TABLE book_copies ALTER COLUMN home_branch_id SET NOT NULL;
+ALTER TABLE book_copies ALTER COLUMN current_branch_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS book_copies_home_branch_id_idx ON book_copies (home_branch_id);
+CREATE INDEX IF NOT EXISTS book_copies_current_branch_id_idx ON book_copies (current_branch_id);
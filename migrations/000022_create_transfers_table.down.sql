@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS transfers;
+UPDATE holds SET status = 'waiting', copy_id = NULL WHERE status = 'in_transit';
+DROP INDEX IF EXISTS holds_active_user_book_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS holds_active_user_book_idx ON holds (book_id, user_id) WHERE status IN ('waiting', 'ready');
+ALTER TABLE holds DROP CONSTRAINT IF EXISTS holds_status_check;
+ALTER TABLE holds ADD CONSTRAINT holds_status_check CHECK (status IN ('waiting', 'ready', 'fulfilled', 'cancelled', 'expired'));
+ALTER TABLE holds DROP COLUMN IF EXISTS pickup_branch_id;
+UPDATE book_copies SET status = 'available' WHERE status = 'in_transit';
+ALTER TABLE book_copies DROP CONSTRAINT IF EXISTS book_copies_status_check;
+ALTER TABLE book_copies ADD CONSTRAINT book_copies_status_check CHECK (status IN ('available', 'on_loan', 'on_hold', 'lost', 'withdrawn'));
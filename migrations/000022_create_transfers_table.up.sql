@@ -0,0 +1,28 @@
+ALTER TABLE book_copies DROP CONSTRAINT IF EXISTS book_copies_status_check;
+ALTER TABLE book_copies ADD CONSTRAINT book_copies_status_check CHECK (status IN ('available', 'on_loan', 'on_hold', 'in_transit', 'lost', 'withdrawn'));
+-- Holds with a pickup branch wait in the in_transit status while their copy is sent
+-- there. Holds without one are picked up wherever the copy is.
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS pickup_branch_id UUID REFERENCES branches ON DELETE SET NULL;
+ALTER TABLE holds DROP CONSTRAINT IF EXISTS holds_status_check;
+ALTER TABLE holds ADD CONSTRAINT holds_status_check CHECK (status IN ('waiting', 'in_transit', 'ready', 'fulfilled', 'cancelled', 'expired'));
+DROP INDEX IF EXISTS holds_active_user_book_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS holds_active_user_book_idx ON holds (book_id, user_id) WHERE status IN ('waiting', 'in_transit', 'ready');
+CREATE TABLE IF NOT EXISTS transfers (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+copy_id UUID NOT NULL REFERENCES book_copies ON DELETE CASCADE,
+from_branch_id UUID NOT NULL REFERENCES branches ON DELETE RESTRICT,
+to_branch_id UUID NOT NULL REFERENCES branches ON DELETE RESTRICT,
+hold_id UUID REFERENCES holds ON DELETE SET NULL,
+requested_by UUID REFERENCES users ON DELETE SET NULL,
+status text NOT NULL DEFAULT 'requested',
+shipped_at timestamp(0) with time zone,
+received_at timestamp(0) with time zone,
+version integer NOT NULL DEFAULT 1
+);
+ALTER TABLE transfers ADD CONSTRAINT transfers_status_check CHECK (status IN ('requested', 'in_transit', 'received', 'cancelled'));
+ALTER TABLE transfers ADD CONSTRAINT transfers_branches_check CHECK (from_branch_id <> to_branch_id);
+-- A copy can only be on its way to one place at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS transfers_active_copy_idx ON transfers (copy_id) WHERE status IN ('requested', 'in_transit');
+CREATE INDEX IF NOT EXISTS transfers_to_branch_id_idx ON transfers (to_branch_id) WHERE status IN ('requested', 'in_transit');
+CREATE INDEX IF NOT EXISTS transfers_from_branch_id_idx ON transfers (from_branch_id) WHERE status IN ('requested', 'in_transit');
@@ -0,0 +1,12 @@
+-- Each row records a reminder email about a loan. The row is written before the email
+-- is sent, so the primary key stops a reminder from being sent twice for the same due
+-- date, even if the server restarts part way through a run. Renewing a loan changes
+-- its due date, which makes the borrower eligible for new reminders.
+CREATE TABLE IF NOT EXISTS reminders (
+loan_id UUID NOT NULL REFERENCES loans ON DELETE CASCADE,
+kind text NOT NULL,
+due_at timestamp(0) with time zone NOT NULL,
+sent_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+PRIMARY KEY (loan_id, kind, due_at)
+);
+ALTER TABLE reminders ADD CONSTRAINT reminders_kind_check CHECK (kind IN ('due_soon', 'overdue'));
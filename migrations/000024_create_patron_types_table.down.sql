@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS patron_type;
+DROP TABLE IF EXISTS patron_types;
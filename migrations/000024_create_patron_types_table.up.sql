@@ -0,0 +1,22 @@
+-- Loan periods are whole days, and the fine cap is in minor currency units like the
+-- fines themselves.
+CREATE TABLE IF NOT EXISTS patron_types (
+code text PRIMARY KEY,
+name text NOT NULL,
+max_loans integer NOT NULL,
+loan_period_days integer NOT NULL,
+max_holds integer NOT NULL,
+max_renewals integer NOT NULL,
+fine_cap bigint NOT NULL,
+version integer NOT NULL DEFAULT 1
+);
+ALTER TABLE patron_types ADD CONSTRAINT patron_types_limits_check CHECK (max_loans >= 0 AND loan_period_days > 0 AND max_holds >= 0 AND max_renewals >= 0 AND fine_cap >= 0);
+-- The standard type keeps the limits that applied to everybody before patron types
+-- were introduced.
+INSERT INTO patron_types (code, name, max_loans, loan_period_days, max_holds, max_renewals, fine_cap)
+VALUES
+('standard', 'Standard', 10, 21, 5, 2, 1000),
+('student', 'Student', 10, 21, 5, 2, 1000),
+('staff', 'Staff', 30, 60, 15, 5, 5000),
+('external', 'External reader', 3, 14, 2, 1, 500);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS patron_type text NOT NULL DEFAULT 'standard' REFERENCES patron_types ON UPDATE CASCADE ON DELETE RESTRICT;
@@ -0,0 +1,17 @@
+-- Each policy applies to one patron type and one item type, either of which can be
+-- 'any'. Loan periods and renewals left NULL fall back to the patron type's limits.
+CREATE TABLE IF NOT EXISTS circulation_policies (
+patron_type text NOT NULL,
+item_type text NOT NULL,
+loanable boolean NOT NULL DEFAULT true,
+loan_period_days integer,
+max_renewals integer,
+version integer NOT NULL DEFAULT 1,
+PRIMARY KEY (patron_type, item_type)
+);
+ALTER TABLE circulation_policies ADD CONSTRAINT circulation_policies_limits_check CHECK (loan_period_days > 0 AND max_renewals >= 0);
+INSERT INTO circulation_policies (patron_type, item_type, loanable, loan_period_days, max_renewals)
+VALUES
+('any', 'reference', false, NULL, NULL),
+('any', 'new_release', true, 7, 0),
+('any', 'dvd', true, 3, NULL);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS digital_resources;
@@ -0,0 +1,13 @@
+-- A digital resource is a file or link through which a book can be read online or
+-- downloaded, such as an EPUB or PDF. Its media type tells e-reader apps what it is.
+CREATE TABLE IF NOT EXISTS digital_resources (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+book_id UUID NOT NULL REFERENCES books ON DELETE CASCADE,
+url text NOT NULL,
+media_type text NOT NULL,
+size_bytes bigint NOT NULL DEFAULT 0,
+version integer NOT NULL DEFAULT 1,
+UNIQUE (book_id, url)
+);
+ALTER TABLE digital_resources ADD CONSTRAINT digital_resources_size_check CHECK (size_bytes >= 0);
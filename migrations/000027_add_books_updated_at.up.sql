@@ -0,0 +1,5 @@
+-- updated_at is when the book's record was last changed. OAI-PMH harvesters use it to
+-- fetch only the records which changed since their last harvest.
+ALTER TABLE books ADD COLUMN IF NOT EXISTS updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+UPDATE books SET updated_at = created_at;
+CREATE INDEX IF NOT EXISTS books_updated_at_idx ON books (updated_at, id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS audit_missing;
+DROP TABLE IF EXISTS audit_scans;
+DROP TABLE IF EXISTS audits;
+DROP INDEX IF EXISTS book_copies_shelf_idx;
+ALTER TABLE book_copies DROP COLUMN IF EXISTS shelf_mark;
@@ -0,0 +1,36 @@
+ALTER TABLE book_copies ADD COLUMN IF NOT EXISTS shelf_mark text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS book_copies_shelf_idx ON book_copies (current_branch_id, shelf_mark);
+-- An audit is a stocktake of a branch, or of the shelves between two shelf marks at a
+-- branch. Either end of the range can be left empty to leave it open.
+CREATE TABLE IF NOT EXISTS audits (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+branch_id UUID NOT NULL REFERENCES branches ON DELETE CASCADE,
+shelf_from text NOT NULL DEFAULT '',
+shelf_to text NOT NULL DEFAULT '',
+opened_by UUID REFERENCES users ON DELETE SET NULL,
+status text NOT NULL DEFAULT 'open',
+closed_at timestamp(0) with time zone,
+version integer NOT NULL DEFAULT 1
+);
+ALTER TABLE audits ADD CONSTRAINT audits_status_check CHECK (status IN ('open', 'closed'));
+CREATE INDEX IF NOT EXISTS audits_branch_id_idx ON audits (branch_id);
+-- Each barcode scanned during an audit is recorded once, along with the copy it
+-- belonged to at the time. Barcodes which don't belong to any copy are kept too, as
+-- they are reported as unexpected items.
+CREATE TABLE IF NOT EXISTS audit_scans (
+audit_id UUID NOT NULL REFERENCES audits ON DELETE CASCADE,
+barcode text NOT NULL,
+copy_id UUID REFERENCES book_copies ON DELETE SET NULL,
+scanned_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+PRIMARY KEY (audit_id, barcode)
+);
+CREATE INDEX IF NOT EXISTS audit_scans_copy_id_idx ON audit_scans (audit_id, copy_id);
+-- The copies which were missing when an audit was closed. The report of a closed audit
+-- and marking its missing copies as lost go by this list, so that a copy which was on
+-- loan during the audit and is returned afterwards isn't taken for missing.
+CREATE TABLE IF NOT EXISTS audit_missing (
+audit_id UUID NOT NULL REFERENCES audits ON DELETE CASCADE,
+copy_id UUID NOT NULL REFERENCES book_copies ON DELETE CASCADE,
+PRIMARY KEY (audit_id, copy_id)
+);
@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE code IN ('acquisitions:read', 'acquisitions:write');
+DROP TABLE IF EXISTS purchase_orders;
+DROP TABLE IF EXISTS suggestion_votes;
+DROP TABLE IF EXISTS purchase_suggestions;
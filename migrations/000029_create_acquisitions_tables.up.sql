@@ -0,0 +1,56 @@
+-- A purchase suggestion is a patron's request for the library to buy a book it doesn't
+-- own. Each user can vote for a suggestion once; the suggester's own vote is added
+-- along with the suggestion.
+CREATE TABLE IF NOT EXISTS purchase_suggestions (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+suggested_by UUID REFERENCES users ON DELETE SET NULL,
+title text NOT NULL,
+author text NOT NULL DEFAULT '',
+isbn13 text NOT NULL DEFAULT '',
+note text NOT NULL DEFAULT '',
+status text NOT NULL DEFAULT 'pending',
+reviewed_by UUID REFERENCES users ON DELETE SET NULL,
+reviewed_at timestamp(0) with time zone,
+review_note text NOT NULL DEFAULT '',
+version integer NOT NULL DEFAULT 1
+);
+ALTER TABLE purchase_suggestions ADD CONSTRAINT purchase_suggestions_status_check CHECK (status IN ('pending', 'accepted', 'rejected', 'ordered'));
+-- A book can only be suggested once while the suggestion is open, so that patrons
+-- vote for the existing suggestion instead.
+CREATE UNIQUE INDEX IF NOT EXISTS purchase_suggestions_isbn13_idx ON purchase_suggestions (isbn13)
+WHERE isbn13 <> '' AND status IN ('pending', 'accepted');
+CREATE TABLE IF NOT EXISTS suggestion_votes (
+suggestion_id UUID NOT NULL REFERENCES purchase_suggestions ON DELETE CASCADE,
+user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+PRIMARY KEY (suggestion_id, user_id)
+);
+-- A purchase order is placed with a vendor for one or more copies of a book, to be
+-- shelved at a branch. Prices are in minor currency units (e.g. cents). When the order
+-- is received the book it was catalogued as is recorded.
+CREATE TABLE IF NOT EXISTS purchase_orders (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+suggestion_id UUID REFERENCES purchase_suggestions ON DELETE SET NULL,
+title text NOT NULL,
+author text NOT NULL DEFAULT '',
+isbn13 text NOT NULL DEFAULT '',
+vendor text NOT NULL,
+quantity integer NOT NULL,
+unit_price bigint NOT NULL,
+fund text NOT NULL DEFAULT '',
+branch_id UUID NOT NULL REFERENCES branches ON DELETE RESTRICT,
+ordered_by UUID REFERENCES users ON DELETE SET NULL,
+status text NOT NULL DEFAULT 'ordered',
+received_at timestamp(0) with time zone,
+book_id UUID REFERENCES books ON DELETE SET NULL,
+version integer NOT NULL DEFAULT 1
+);
+ALTER TABLE purchase_orders ADD CONSTRAINT purchase_orders_status_check CHECK (status IN ('ordered', 'received', 'cancelled'));
+ALTER TABLE purchase_orders ADD CONSTRAINT purchase_orders_amounts_check CHECK (quantity > 0 AND unit_price >= 0);
+CREATE INDEX IF NOT EXISTS purchase_orders_suggestion_id_idx ON purchase_orders (suggestion_id);
+INSERT INTO permissions (code)
+VALUES
+('acquisitions:read'),
+('acquisitions:write');
@@ -0,0 +1,12 @@
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS fund text NOT NULL DEFAULT '';
+UPDATE purchase_orders SET fund = funds.code FROM funds WHERE funds.id = purchase_orders.fund_id;
+DROP INDEX IF EXISTS purchase_orders_fund_id_idx;
+ALTER TABLE purchase_orders DROP CONSTRAINT IF EXISTS purchase_orders_invoiced_amount_check;
+ALTER TABLE purchase_orders DROP COLUMN IF EXISTS invoiced_at;
+ALTER TABLE purchase_orders DROP COLUMN IF EXISTS invoiced_amount;
+ALTER TABLE purchase_orders DROP COLUMN IF EXISTS invoice_number;
+ALTER TABLE purchase_orders DROP COLUMN IF EXISTS fiscal_year;
+ALTER TABLE purchase_orders DROP COLUMN IF EXISTS fund_id;
+DROP TABLE IF EXISTS fund_transactions;
+DROP TABLE IF EXISTS fund_allocations;
+DROP TABLE IF EXISTS funds;
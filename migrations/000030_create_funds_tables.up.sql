@@ -0,0 +1,61 @@
+-- A fund is a budget that purchases are paid from, such as a department's book fund.
+-- Amounts are in minor units (e.g. cents) of the fund's currency, an ISO 4217 code.
+CREATE TABLE IF NOT EXISTS funds (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+code text NOT NULL UNIQUE,
+name text NOT NULL DEFAULT '',
+currency text NOT NULL,
+version integer NOT NULL DEFAULT 1
+);
+ALTER TABLE funds ADD CONSTRAINT funds_currency_check CHECK (currency ~ '^[A-Z]{3}$');
+-- Money is allocated to a fund for a fiscal year, in one or more allocations. Negative
+-- allocations take money back.
+CREATE TABLE IF NOT EXISTS fund_allocations (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+fund_id UUID NOT NULL REFERENCES funds ON DELETE CASCADE,
+fiscal_year integer NOT NULL,
+amount bigint NOT NULL,
+note text NOT NULL DEFAULT '',
+created_by UUID REFERENCES users ON DELETE SET NULL
+);
+ALTER TABLE fund_allocations ADD CONSTRAINT fund_allocations_amount_check CHECK (amount <> 0);
+CREATE INDEX IF NOT EXISTS fund_allocations_fund_id_idx ON fund_allocations (fund_id, fiscal_year);
+-- Orders are paid for through a ledger of transactions against their fund. Placing an
+-- order encumbers its total, and the encumbrance is released when the order is
+-- invoiced, when the expenditure is recorded instead, or cancelled.
+CREATE TABLE IF NOT EXISTS fund_transactions (
+id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+fund_id UUID NOT NULL REFERENCES funds ON DELETE CASCADE,
+fiscal_year integer NOT NULL,
+order_id UUID REFERENCES purchase_orders ON DELETE SET NULL,
+kind text NOT NULL,
+amount bigint NOT NULL
+);
+ALTER TABLE fund_transactions ADD CONSTRAINT fund_transactions_kind_check CHECK (kind IN ('encumbrance', 'release', 'expenditure'));
+ALTER TABLE fund_transactions ADD CONSTRAINT fund_transactions_amount_check CHECK (amount > 0);
+CREATE INDEX IF NOT EXISTS fund_transactions_fund_id_idx ON fund_transactions (fund_id, fiscal_year);
+CREATE INDEX IF NOT EXISTS fund_transactions_order_id_idx ON fund_transactions (order_id);
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS fund_id UUID REFERENCES funds ON DELETE RESTRICT;
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS fiscal_year integer NOT NULL DEFAULT 0;
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS invoice_number text NOT NULL DEFAULT '';
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS invoiced_amount bigint;
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS invoiced_at timestamp(0) with time zone;
+ALTER TABLE purchase_orders ADD CONSTRAINT purchase_orders_invoiced_amount_check CHECK (invoiced_amount >= 0);
+-- Existing orders named their fund in free text. A fund is created for each name, with
+-- the currency code XXX ("no currency") until staff set the real one, and the open
+-- orders are encumbered against them. The -fiscal-year-start setting isn't known
+-- here, so existing orders are put in the calendar year they were placed in; open
+-- orders can be moved to the right fiscal year by updating their fiscal_year.
+UPDATE purchase_orders SET fiscal_year = EXTRACT(YEAR FROM created_at);
+INSERT INTO funds (code, name, currency)
+SELECT DISTINCT fund, fund, 'XXX' FROM purchase_orders WHERE fund <> '';
+UPDATE purchase_orders SET fund_id = funds.id FROM funds WHERE funds.code = purchase_orders.fund;
+INSERT INTO fund_transactions (fund_id, fiscal_year, order_id, kind, amount)
+SELECT fund_id, fiscal_year, id, 'encumbrance', quantity * unit_price
+FROM purchase_orders
+WHERE fund_id IS NOT NULL AND status = 'ordered' AND quantity * unit_price > 0;
+ALTER TABLE purchase_orders DROP COLUMN IF EXISTS fund;
+CREATE INDEX IF NOT EXISTS purchase_orders_fund_id_idx ON purchase_orders (fund_id);